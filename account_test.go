@@ -0,0 +1,176 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCreateAccountsKeepsExistingBalances(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "2")
+	s.mustInvoke("withdrawCash", "company1", "100", "ref")
+
+	s.mustInvoke("createAccounts", "3")
+	if got, want := s.company("company1").CashBalance, initialCashBalance-Money(10000); got != want {
+		t.Fatalf("company1 has %s, want %s", got, want)
+	}
+	if got := s.company("company3").CashBalance; got != initialCashBalance {
+		t.Fatalf("company3 has %s, want %s", got, initialCashBalance)
+	}
+}
+
+func TestCreateAccountRefusesExistingAccounts(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccount", "northwind")
+	s.mustInvoke("withdrawCash", "northwind", "100", "ref")
+	before := s.company("northwind")
+
+	s.mustFail(codeConflict, "createAccount", "northwind")
+	if got := s.company("northwind"); !reflect.DeepEqual(got, before) {
+		t.Fatalf("the account is %+v after a second createAccount, want %+v", got, before)
+	}
+	var statement Statement
+	s.mustQuery(&statement, "GetStatement", "northwind", "0", timeToMs(s.now))
+	if len(statement.Lines) != 2 {
+		t.Fatalf("northwind has %d journal lines, want the opening balance and the withdrawal", len(statement.Lines))
+	}
+
+	// The refused call took no issuer code
+	s.mustInvoke("createAccount", "southwind")
+	if got := s.company("southwind").IssuerCode; got != "000002" {
+		t.Fatalf("southwind has the issuer code %s, want 000002", got)
+	}
+}
+
+func TestAccountIDsStayOutOfOtherCompaniesKeys(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccount", "acme")
+
+	// "acme:east" would put its journal lines, holdings and requests under
+	// "acme"'s key prefixes
+	s.mustFail(codeInvalidField, "createAccount", "acme:east")
+	s.mustFail(codeInvalidField, "createAccount", "")
+	if bytes, _ := s.stub().GetState(accountPrefix + "acme:east"); bytes != nil {
+		t.Fatalf("the refused account was written: %s", bytes)
+	}
+
+	var statement Statement
+	s.mustQuery(&statement, "GetStatement", "acme", "0", timeToMs(s.now))
+	if len(statement.Lines) != 1 {
+		t.Fatalf("acme has %d journal lines, want only its opening balance", len(statement.Lines))
+	}
+	if got := s.company("acme").CashBalance; got != initialCashBalance {
+		t.Fatalf("acme has a balance of %v, want %v", got, initialCashBalance)
+	}
+}
+
+func TestCashMovementsCarryTheirCodes(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "1")
+	s.mustFail(codeInvalidField, "depositCash", "company1", "-5", "ref")
+	s.mustFail(codeInvalidField, "depositCash", "company1", "5", "")
+	s.mustFail(codeNotFound, "depositCash", "nobody", "5", "ref")
+	s.mustFail(codeInsufficientFunds, "withdrawCash", "company1", (initialCashBalance + 1).String(), "ref")
+}
+
+func TestJournalNumbersLinesPerAccount(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "2")
+	s.mustInvoke("depositCash", "company1", "5", "in")
+	s.mustInvoke("withdrawCash", "company1", "2", "out")
+
+	if got := s.company("company1").JournalEntries; got != 3 {
+		t.Fatalf("company1 has numbered %d lines, want 3", got)
+	}
+	if got := s.company("company2").JournalEntries; got != 1 {
+		t.Fatalf("company2 has numbered %d lines, want 1", got)
+	}
+
+	// An account journalled before it kept a count carries on from its
+	// last line
+	account := s.company("company2")
+	account.JournalEntries = 0
+	s.put(accountPrefix+"company2", account)
+	s.mustInvoke("depositCash", "company2", "5", "in")
+
+	var statement Statement
+	s.mustQuery(&statement, "GetStatement", "company2", "0", timeToMs(s.now))
+	var entries []int
+	for _, line := range statement.Lines {
+		entries = append(entries, line.Entry)
+	}
+	if !reflect.DeepEqual(entries, []int{1, 2}) {
+		t.Fatalf("company2 has lines %v, want [1 2]", entries)
+	}
+}
+
+func TestIssuerCodesAreUnique(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "10")
+	if got := s.company("company10").IssuerCode; got == s.company("company1").IssuerCode {
+		t.Fatalf("company10 and company1 share the issuer code %s", got)
+	}
+
+	s.mustInvoke("createAccount", "northwind1")
+	s.mustInvoke("createAccount", "north-wind2")
+	if a, b := s.company("northwind1").IssuerCode, s.company("north-wind2").IssuerCode; a == b {
+		t.Fatalf("northwind1 and north-wind2 share the issuer code %s", a)
+	}
+
+	// An account opened before codes were allocated takes the next free
+	// one when it first issues, skipping codes registered the old way
+	s.put(issuerCodePrefix+"00000D", "company1")
+	account := s.company("company2")
+	account.IssuerCode = ""
+	s.put(accountPrefix+"company2", account)
+	s.put(accountPrefix+"company11", Account{ID: "company11", Prefix: "20000A", CashBalance: initialCashBalance})
+	s.mustInvoke("setProgram", "company2", `{"authorized":100000}`)
+	s.mustInvoke("setProgram", "company11", `{"authorized":100000}`)
+	cusip := s.issue(`{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":30,"issuer":"company2"}`)
+	if code := cusip[:cusipIssuerCodeLength]; code != "00000E" {
+		t.Fatalf("company2 issued %s, want the issuer code 00000E", cusip)
+	}
+	cusip = s.issue(`{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":30,"issuer":"company11"}`)
+	if code := cusip[:cusipIssuerCodeLength]; code != "00000F" {
+		t.Fatalf("company11 issued %s, want the issuer code 00000F", cusip)
+	}
+}
+
+func TestDropKeyArraysRemovesTheAccountList(t *testing.T) {
+	s := newTestStub(t)
+	s.put("accounts", []string{"company1", "company2"})
+	s.put("PaperKeys", []string{})
+
+	var report MigrationReport
+	err := json.Unmarshal(s.mustInvoke("dropKeyArrays"), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Migrated["accounts"] != 1 || report.Migrated["PaperKeys"] != 1 {
+		t.Fatalf("dropped %v", report.Migrated)
+	}
+	for _, key := range []string{"accounts", "PaperKeys"} {
+		if _, ok := s.State[key]; ok {
+			t.Errorf("%s is still in the state", key)
+		}
+	}
+}
@@ -0,0 +1,694 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Auctions are stored by ID. Their bids are stored apart, by auction and
+// arrival, and are only returned by queries once the auction has closed.
+var auctionPrefix = keyPrefix("auction")
+var auctionBidPrefix = keyPrefix("auctionbid")
+
+// An auction takes bids until it is closed. If the issuer doesn't close
+// it, it expires and the bids are returned.
+var auctionStatuses = statusMachine{
+	document: "auction",
+	initial:  "open",
+	transitions: map[string][]string{
+		"open":    {"closed", "expired"},
+		"closed":  {},
+		"expired": {},
+	},
+}
+
+const (
+	auctionOpen    = "open"
+	auctionClosed  = "closed"
+	auctionExpired = "expired"
+)
+
+// How long the issuer has to close an auction after bidding ends, before
+// anyone may expire it
+const auctionGracePeriod = 24 * time.Hour
+
+// Auction is a Dutch auction of a new issue. Bids are filled from the
+// lowest discount up, and every winner pays the clearing discount, the
+// highest discount that was filled. Whatever is not sold stays with the
+// issuer.
+type Auction struct {
+	ID               string `json:"id"`
+	Issuer           string `json:"issuer"`
+	Ticker           string `json:"ticker"`
+	Par              Money  `json:"par"`
+	Qty              int    `json:"qty"`
+	Maturity         int    `json:"maturity"`
+	DayCount         string `json:"dayCount"`
+	Currency         string `json:"currency"`
+	Reserve          Rate   `json:"reserve"`
+	ClosesOn         string `json:"closesOn"`
+	Status           string `json:"status"`
+	Bids             int    `json:"bids"`
+	AnnouncedOn      string `json:"announcedOn"`
+	ClosedOn         string `json:"closedOn"`
+	CUSIP            string `json:"cusip"`
+	ClearingDiscount Rate   `json:"clearingDiscount"`
+	Allocated        int    `json:"allocated"`
+}
+
+// AuctionBid is an offer to buy quantity of an auction at a discount or
+// any lower one. It holds par for its quantity in cash until the auction
+// closes.
+type AuctionBid struct {
+	ID        string `json:"id"`
+	AuctionID string `json:"auctionId"`
+	Company   string `json:"company"`
+	Discount  Rate   `json:"discount"`
+	Quantity  int    `json:"quantity"`
+	Sequence  int    `json:"sequence"`
+	PlacedOn  string `json:"placedOn"`
+	Allocated int    `json:"allocated"`
+	Amount    Money  `json:"amount"`
+}
+
+// byAuctionPriority orders bids lowest discount first, then by arrival
+type byAuctionPriority []AuctionBid
+
+func (b byAuctionPriority) Len() int      { return len(b) }
+func (b byAuctionPriority) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byAuctionPriority) Less(i, j int) bool {
+	if b[i].Discount != b[j].Discount {
+		return b[i].Discount < b[j].Discount
+	}
+	return b[i].Sequence < b[j].Sequence
+}
+
+// auctionPaper is the paper an auction will issue, before its discount
+// and issue date are known
+func auctionPaper(auction Auction) CP {
+	return CP{
+		Ticker:   auction.Ticker,
+		Par:      auction.Par,
+		Qty:      auction.Qty,
+		Maturity: auction.Maturity,
+		DayCount: auction.DayCount,
+		Currency: auction.Currency,
+		Issuer:   auction.Issuer,
+	}
+}
+
+func auctionBidKey(bid AuctionBid) string {
+	return fmt.Sprintf("%s%s%s%010d", auctionBidPrefix, bid.AuctionID, keySeparator, bid.Sequence)
+}
+
+func GetAuction(auctionID string, stub shim.ChaincodeStubInterface) (Auction, error) {
+	var auction Auction
+
+	auctionBytes, err := stub.GetState(auctionPrefix + auctionID)
+	if err != nil {
+		fmt.Println("Error retrieving auction " + auctionID)
+		return auction, storageError(entityAuction, auctionID, "retrieving")
+	}
+	if auctionBytes == nil {
+		fmt.Println("Auction " + auctionID + " does not exist")
+		return auction, notFound(entityAuction, auctionID)
+	}
+
+	err = json.Unmarshal(auctionBytes, &auction)
+	if err != nil {
+		fmt.Println("Error unmarshalling auction " + auctionID)
+		return auction, storageError(entityAuction, auctionID, "unmarshalling")
+	}
+
+	return auction, nil
+}
+
+func PutAuction(auction Auction, stub shim.ChaincodeStubInterface) error {
+	auctionBytes, err := json.Marshal(&auction)
+	if err != nil {
+		fmt.Println("Error marshalling auction " + auction.ID)
+		return storageError(entityAuction, auction.ID, "marshalling")
+	}
+
+	err = putState(stub, auctionPrefix+auction.ID, auctionBytes)
+	if err != nil {
+		fmt.Println("Error writing auction " + auction.ID)
+		return storageError(entityAuction, auction.ID, "writing")
+	}
+
+	return nil
+}
+
+func PutAuctionBid(bid AuctionBid, stub shim.ChaincodeStubInterface) error {
+	bidBytes, err := json.Marshal(&bid)
+	if err != nil {
+		fmt.Println("Error marshalling bid " + bid.ID)
+		return storageError(entityAuction, auctionBidKey(bid), "marshalling")
+	}
+
+	// Bids are written without history. History can be read while the
+	// auction is open, which would unseal them.
+	err = stub.PutState(auctionBidKey(bid), bidBytes)
+	if err != nil {
+		fmt.Println("Error writing bid " + bid.ID)
+		return storageError(entityAuction, auctionBidKey(bid), "writing")
+	}
+
+	return nil
+}
+
+// auctionBids returns the bids of an auction in arrival order
+func auctionBids(auctionID string, stub shim.ChaincodeStubInterface) ([]AuctionBid, error) {
+	var bids []AuctionBid
+
+	err := scanPrefix(stub, auctionBidPrefix+auctionID+keySeparator, func(key string, value []byte) error {
+		var bid AuctionBid
+		err := json.Unmarshal(value, &bid)
+		if err != nil {
+			fmt.Println("Error unmarshalling " + key)
+			return storageError(entityAuction, key, "unmarshalling")
+		}
+		bids = append(bids, bid)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bids, nil
+}
+
+// GetAuctionBids returns the bids of a closed auction with what each won.
+// Bids stay sealed while the auction is open.
+func GetAuctionBids(auctionID string, stub shim.ChaincodeStubInterface) ([]AuctionBid, error) {
+	auction, err := GetAuction(auctionID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if auction.Status == auctionOpen {
+		fmt.Println("Auction " + auctionID + " is still open")
+		return nil, newError(codeInvalidStatus, entityAuction, auctionID, "status", "The bids of auction "+auctionID+" are sealed until it closes")
+	}
+
+	return auctionBids(auctionID, stub)
+}
+
+func (t *SimpleChaincode) announceAuction(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		json
+	  	{
+			"issuer": "company1",
+			"ticker": "string",
+			"par": 0.00,
+			"qty": 10,
+			"maturity": 30,
+			"dayCount": "ACT/360", // optional, one of ACT/360, ACT/365 or 30/360
+			"currency": "USD", // optional, must be allowed by the issuer's program
+			"reserve": 7.5, // the highest discount the issuer will accept
+			"closesOn": "1456161763790" (deadline for bids in milliseconds as a string)
+		}
+	*/
+	if len(args) != 1 {
+		return nil, badArguments("announceAuction", "auction record")
+	}
+
+	var auction Auction
+	fmt.Println("Unmarshalling Auction")
+	err := json.Unmarshal([]byte(args[0]), &auction)
+	if err != nil {
+		fmt.Println("Error unmarshalling auction")
+		return nil, invalidRecord(entityAuction, err)
+	}
+
+	// Only the issuer itself may auction its paper
+	err = requireCompany(stub, "announceAuction", auction.Issuer)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	if auction.DayCount == "" {
+		auction.DayCount = defaultDayCount
+	}
+	if !validDayCount(auction.DayCount) {
+		fmt.Println("Unknown day count convention " + auction.DayCount)
+		return nil, invalidField(entityAuction, "", "dayCount", "Unknown day count convention "+auction.DayCount)
+	}
+	if auction.Qty <= 0 || auction.Par <= 0 || auction.Maturity <= 0 {
+		fmt.Println("Invalid auction terms")
+		return nil, invalidField(entityAuction, "", "qty", "An auction needs a positive quantity, par and maturity")
+	}
+	if auction.Reserve < 0 {
+		fmt.Println("Invalid reserve " + auction.Reserve.String())
+		return nil, invalidField(entityAuction, "", "reserve", "Invalid reserve discount "+auction.Reserve.String())
+	}
+	if auction.Currency == "" {
+		auction.Currency = defaultCurrency
+	}
+
+	err = checkProgram(stub, auctionPaper(auction), auction.Qty)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityAuction, "")
+	}
+	closesOn, err := msToTime(auction.ClosesOn)
+	if err != nil {
+		fmt.Println("Invalid closing time " + auction.ClosesOn)
+		return nil, invalidField(entityAuction, "", "closesOn", "Invalid closing time "+auction.ClosesOn)
+	}
+	if !closesOn.After(now) {
+		fmt.Println("The auction closes before it is announced")
+		return nil, invalidField(entityAuction, "", "closesOn", "The auction must close after "+timeToMs(now))
+	}
+
+	auction.ID = recordID(stub)
+	err = requireNew(stub, entityAuction, auctionPrefix+auction.ID)
+	if err != nil {
+		return nil, err
+	}
+	auction.Status = auctionStatuses.initial
+	auction.Bids = 0
+	auction.AnnouncedOn = timeToMs(now)
+	auction.ClosedOn = ""
+	auction.CUSIP = ""
+	auction.ClearingDiscount = 0
+	auction.Allocated = 0
+
+	err = PutAuction(auction, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityAuction, actionAnnounced, auctionPrefix+auction.ID, "", auction.Status)
+	fmt.Println("Announced auction " + auction.ID)
+	return json.Marshal(&auction)
+}
+
+func (t *SimpleChaincode) submitAuctionBid(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		json
+	  	{
+			"auctionId": "",
+			"company": "company2",
+			"discount": 7.5,
+			"quantity": 1
+		}
+	*/
+	if len(args) != 1 {
+		return nil, badArguments("submitAuctionBid", "bid record")
+	}
+
+	var bid AuctionBid
+	fmt.Println("Unmarshalling AuctionBid")
+	err := json.Unmarshal([]byte(args[0]), &bid)
+	if err != nil {
+		fmt.Println("Error unmarshalling bid")
+		return nil, invalidRecord(entityAuction, err)
+	}
+
+	// Companies only bid for themselves
+	err = requireCompany(stub, "submitAuctionBid", bid.Company)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	auction, err := GetAuction(bid.AuctionID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if auction.Status != auctionOpen {
+		fmt.Println("Auction " + auction.ID + " is " + auction.Status)
+		return nil, invalidStatus(entityAuction, auction.ID, "Auction "+auction.ID+" is "+auction.Status+" and takes no more bids")
+	}
+	if bid.Company == auction.Issuer {
+		fmt.Println("The issuer cannot bid in its own auction")
+		return nil, invalidField(entityAuction, auction.ID, "company", "The company "+bid.Company+" cannot bid in its own auction")
+	}
+	if bid.Quantity <= 0 {
+		fmt.Println("Invalid quantity " + strconv.Itoa(bid.Quantity))
+		return nil, invalidField(entityAuction, auction.ID, "quantity", "Invalid quantity "+strconv.Itoa(bid.Quantity))
+	}
+	if bid.Discount < 0 || bid.Discount > auction.Reserve {
+		fmt.Println("Invalid discount " + bid.Discount.String())
+		return nil, invalidField(entityAuction, auction.ID, "discount", "Bids must be between 0 and the reserve discount "+auction.Reserve.String())
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityAuction, auction.ID)
+	}
+	closesOn, err := msToTime(auction.ClosesOn)
+	if err != nil {
+		fmt.Println("Error reading the closing time of auction " + auction.ID)
+		return nil, storageError(entityAuction, auction.ID, "reading the closing time of")
+	}
+	if !now.Before(closesOn) {
+		fmt.Println("Auction " + auction.ID + " has closed for bids")
+		return nil, invalidStatus(entityAuction, auction.ID, "Auction "+auction.ID+" closed for bids on "+auction.ClosesOn)
+	}
+
+	// Par is the most the bid can cost
+	err = reserveCash(stub, bid.Company, auction.Par.Times(bid.Quantity))
+	if err != nil {
+		return nil, err
+	}
+
+	auction.Bids++
+	bid.ID = recordID(stub)
+	bid.Sequence = auction.Bids
+	err = requireNew(stub, entityAuction, auctionBidKey(bid))
+	if err != nil {
+		return nil, err
+	}
+	bid.PlacedOn = timeToMs(now)
+	bid.Allocated = 0
+	bid.Amount = 0
+
+	err = PutAuctionBid(bid, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = PutAuction(auction, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityAuction, actionBidReceived, auctionPrefix+auction.ID, auction.Status, auction.Status)
+	fmt.Println("Received bid " + bid.ID + " for auction " + auction.ID)
+	return json.Marshal(&bid)
+}
+
+// allocateAuction fills bids from the lowest discount up and returns the
+// clearing discount and how much was sold
+func allocateAuction(auction Auction, bids []AuctionBid) (Rate, int) {
+	sort.Sort(byAuctionPriority(bids))
+
+	var clearing Rate
+	remaining := auction.Qty
+	for i := range bids {
+		if remaining == 0 {
+			break
+		}
+
+		quantity := bids[i].Quantity
+		if quantity > remaining {
+			quantity = remaining
+		}
+		bids[i].Allocated = quantity
+		remaining -= quantity
+		clearing = bids[i].Discount
+	}
+
+	return clearing, auction.Qty - remaining
+}
+
+func (t *SimpleChaincode) expireAuction(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		auction ID
+	*/
+	if len(args) != 1 {
+		return nil, badArguments("expireAuction", "auction ID")
+	}
+
+	// Anyone may expire an auction the issuer left open
+	auction, err := GetAuction(args[0], stub)
+	if err != nil {
+		return nil, err
+	}
+	if auction.Status != auctionOpen {
+		fmt.Println("Auction " + auction.ID + " is " + auction.Status)
+		return nil, invalidStatus(entityAuction, auction.ID, "Auction "+auction.ID+" is already "+auction.Status)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityAuction, auction.ID)
+	}
+	closesOn, err := msToTime(auction.ClosesOn)
+	if err != nil {
+		fmt.Println("Error reading the closing time of auction " + auction.ID)
+		return nil, storageError(entityAuction, auction.ID, "reading the closing time of")
+	}
+	if now.Before(closesOn.Add(auctionGracePeriod)) {
+		fmt.Println("Auction " + auction.ID + " can still be closed by its issuer")
+		return nil, invalidStatus(entityAuction, auction.ID, "Auction "+auction.ID+" cannot expire until "+timeToMs(closesOn.Add(auctionGracePeriod)))
+	}
+
+	bids, err := auctionBids(auction.ID, stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, bid := range bids {
+		err = reserveCash(stub, bid.Company, -auction.Par.Times(bid.Quantity))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	oldStatus := auction.Status
+	auction.Status = auctionExpired
+	auction.ClosedOn = timeToMs(now)
+	err = PutAuction(auction, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityAuction, actionExpired, auctionPrefix+auction.ID, oldStatus, auction.Status)
+	fmt.Println("Expired auction " + auction.ID)
+	return json.Marshal(&auction)
+}
+
+func (t *SimpleChaincode) closeAuction(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		auction ID
+	*/
+	if len(args) != 1 {
+		return nil, badArguments("closeAuction", "auction ID")
+	}
+
+	auction, err := GetAuction(args[0], stub)
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireCompany(stub, "closeAuction", auction.Issuer)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	if auction.Status != auctionOpen {
+		fmt.Println("Auction " + auction.ID + " is " + auction.Status)
+		return nil, invalidStatus(entityAuction, auction.ID, "Auction "+auction.ID+" is already "+auction.Status)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityAuction, auction.ID)
+	}
+	closesOn, err := msToTime(auction.ClosesOn)
+	if err != nil {
+		fmt.Println("Error reading the closing time of auction " + auction.ID)
+		return nil, storageError(entityAuction, auction.ID, "reading the closing time of")
+	}
+	if now.Before(closesOn) {
+		fmt.Println("Auction " + auction.ID + " is still taking bids")
+		return nil, invalidStatus(entityAuction, auction.ID, "Auction "+auction.ID+" takes bids until "+auction.ClosesOn)
+	}
+
+	bids, err := auctionBids(auction.ID, stub)
+	if err != nil {
+		return nil, err
+	}
+	auction.ClearingDiscount, auction.Allocated = allocateAuction(auction, bids)
+
+	// The program may have been used up while the auction was open, in
+	// which case the auction fails and every bid is returned
+	if auction.Allocated > 0 {
+		err = checkProgram(stub, auctionPaper(auction), auction.Qty)
+		if err != nil {
+			fmt.Println("Auction " + auction.ID + " failed: " + err.Error())
+			auction.ClearingDiscount = 0
+			auction.Allocated = 0
+			for i := range bids {
+				bids[i].Allocated = 0
+			}
+		}
+	}
+
+	if auction.Allocated > 0 {
+		err = issueAuction(stub, &auction, bids, now)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fmt.Println("Auction " + auction.ID + " had no bids, nothing was issued")
+	}
+
+	// Every bid gives back its hold, and winners pay for what they won
+	for _, bid := range bids {
+		err = reserveCash(stub, bid.Company, -auction.Par.Times(bid.Quantity))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, bid := range bids {
+		if bid.Allocated == 0 {
+			err = PutAuctionBid(bid, stub)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		err = payForAuctionBid(stub, auction, &bid, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	oldStatus := auction.Status
+	auction.Status = auctionClosed
+	auction.ClosedOn = timeToMs(now)
+	err = PutAuction(auction, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityAuction, actionClosed, auctionPrefix+auction.ID, oldStatus, auction.Status)
+	fmt.Println("Closed auction " + auction.ID + " at " + auction.ClearingDiscount.String())
+	return json.Marshal(&auction)
+}
+
+// issueAuction creates the paper sold in an auction, owned by the winning
+// bidders with any unsold quantity left to the issuer
+func issueAuction(stub shim.ChaincodeStubInterface, auction *Auction, bids []AuctionBid, now time.Time) error {
+	issuer, err := GetCompany(auction.Issuer, stub)
+	if err != nil {
+		return err
+	}
+
+	cp := auctionPaper(*auction)
+	cp.Discount = auction.ClearingDiscount
+	cp.IssueDate = timeToMs(now)
+	cp.CUSIP, err = nextFreeCUSIP(stub, &issuer)
+	if err != nil {
+		return err
+	}
+
+	for _, bid := range bids {
+		if bid.Allocated == 0 {
+			continue
+		}
+
+		found := false
+		for i := range cp.Owners {
+			if cp.Owners[i].Company == bid.Company {
+				cp.Owners[i].Quantity += bid.Allocated
+				found = true
+			}
+		}
+		if !found {
+			cp.Owners = append(cp.Owners, Owner{Company: bid.Company, Quantity: bid.Allocated})
+		}
+	}
+	if auction.Allocated < auction.Qty {
+		cp.Owners = append(cp.Owners, Owner{Company: auction.Issuer, Quantity: auction.Qty - auction.Allocated})
+		err = adjustHolding(stub, &issuer, cp.CUSIP, auction.Qty-auction.Allocated, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = PutCompany(issuer, stub)
+	if err != nil {
+		return err
+	}
+	err = PutCP(cp, stub)
+	if err != nil {
+		return err
+	}
+
+	auction.CUSIP = cp.CUSIP
+	recordEvent(stub, entityCP, actionIssued, cpPrefix+cp.CUSIP, "", paperStatus(cp))
+	fmt.Println("Issued " + cp.CUSIP + " from auction " + auction.ID)
+	return nil
+}
+
+// payForAuctionBid collects what a winning bid owes at the clearing
+// discount and pays it to the issuer
+func payForAuctionBid(stub shim.ChaincodeStubInterface, auction Auction, bid *AuctionBid, now time.Time) error {
+	cp, err := GetCP(cpPrefix+auction.CUSIP, stub)
+	if err != nil {
+		return err
+	}
+	bid.Amount, err = paperPrice(cp, bid.Allocated, auction.ClearingDiscount, now)
+	if err != nil {
+		fmt.Println("Error pricing the paper " + cp.CUSIP)
+		return newError(codeInvalidRecord, entityCP, cp.CUSIP, "", "Error pricing the paper "+cp.CUSIP)
+	}
+
+	bidder, err := GetCompany(bid.Company, stub)
+	if err != nil {
+		return err
+	}
+	if bidder.availableCash() < bid.Amount {
+		fmt.Println("The company " + bid.Company + " doesn't have enough cash")
+		return insufficientFunds(bid.Company, "The company "+bid.Company+" doesn't have enough cash to pay for its bid")
+	}
+	err = adjustHolding(stub, &bidder, cp.CUSIP, bid.Allocated, bid.Amount)
+	if err != nil {
+		return err
+	}
+
+	issuer, err := GetCompany(auction.Issuer, stub)
+	if err != nil {
+		return err
+	}
+	err = moveCash(stub, &bidder, &issuer, bid.Amount, "auction "+auction.ID+" allocation of "+cp.CUSIP)
+	if err != nil {
+		return err
+	}
+	err = PutCompany(bidder, stub)
+	if err != nil {
+		return err
+	}
+	err = PutCompany(issuer, stub)
+	if err != nil {
+		return err
+	}
+
+	return PutAuctionBid(*bid, stub)
+}
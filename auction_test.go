@@ -0,0 +1,188 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// announce opens an auction of 10 units of company1 paper, taking bids
+// for a day, and returns its ID
+func announce(s *testStub) string {
+	s.t.Helper()
+	s.as(roleIssuer, "company1")
+	closesOn := timeToMs(s.now.Add(24 * time.Hour))
+	var auction Auction
+	result := s.mustInvoke("announceAuction", `{"issuer":"company1","ticker":"AUC","par":1000,"qty":10,"maturity":30,"reserve":8,"closesOn":"`+closesOn+`"}`)
+	if err := json.Unmarshal(result, &auction); err != nil {
+		s.t.Fatal(err)
+	}
+	return auction.ID
+}
+
+// bid submits a bid for company at discount
+func bid(s *testStub, auctionID string, company string, quantity int, discount string) {
+	s.t.Helper()
+	s.as(roleInvestor, company)
+	s.mustInvoke("submitAuctionBid", `{"auctionId":"`+auctionID+`","company":"`+company+`","quantity":`+strconv.Itoa(quantity)+`,"discount":`+discount+`}`)
+}
+
+func TestAuctionAllocatesAtClearingDiscount(t *testing.T) {
+	s, _ := newMarket(t)
+	auctionID := announce(s)
+	bid(s, auctionID, "company2", 6, "5")
+	bid(s, auctionID, "company3", 6, "6")
+
+	s.now = s.now.Add(25 * time.Hour)
+	s.as(roleIssuer, "company1")
+	s.mustInvoke("closeAuction", auctionID)
+
+	var auction Auction
+	s.mustQuery(&auction, "GetAuction", auctionID)
+	if auction.Allocated != 10 || auction.ClearingDiscount.String() != "6" {
+		t.Fatalf("allocated %d at %s, want 10 at 6", auction.Allocated, auction.ClearingDiscount)
+	}
+	cp := s.cp(auction.CUSIP)
+	if got := owner(cp, "company2").Quantity; got != 6 {
+		t.Fatalf("company2 holds %d, want 6", got)
+	}
+	if got := owner(cp, "company3").Quantity; got != 4 {
+		t.Fatalf("company3 holds %d, want 4", got)
+	}
+	if got := s.company("company3").ReservedCash; got != 0 {
+		t.Fatalf("company3 still has %s reserved", got)
+	}
+}
+
+func TestAuctionBidsStaySealed(t *testing.T) {
+	s, _ := newMarket(t)
+	auctionID := announce(s)
+	bid(s, auctionID, "company2", 6, "5")
+
+	s.as(roleAdmin, "admin")
+	_, err := s.query("GetAuctionBids", auctionID)
+	checkCode(t, err, codeInvalidStatus)
+	var history []Version
+	s.mustQuery(&history, "GetHistory", auctionBidKey(AuctionBid{AuctionID: auctionID, Sequence: 1}))
+	if len(history) != 0 {
+		t.Fatalf("the history of an open bid has %d versions, want none", len(history))
+	}
+}
+
+func TestAnyoneMayExpireAnAbandonedAuction(t *testing.T) {
+	s, _ := newMarket(t)
+	auctionID := announce(s)
+	bid(s, auctionID, "company2", 6, "5")
+	if got := s.company("company2").ReservedCash; got == 0 {
+		t.Fatal("the bid reserved no cash")
+	}
+
+	s.as(roleInvestor, "company3")
+	s.now = s.now.Add(25 * time.Hour)
+	s.mustFail(codeInvalidStatus, "expireAuction", auctionID)
+
+	s.now = s.now.Add(24 * time.Hour)
+	s.mustInvoke("expireAuction", auctionID)
+
+	var auction Auction
+	s.mustQuery(&auction, "GetAuction", auctionID)
+	if auction.Status != auctionExpired {
+		t.Fatalf("auction is %s, want %s", auction.Status, auctionExpired)
+	}
+	if got := s.company("company2").ReservedCash; got != 0 {
+		t.Fatalf("company2 still has %s reserved", got)
+	}
+	s.as(roleIssuer, "company1")
+	s.mustFail(codeInvalidStatus, "closeAuction", auctionID)
+}
+
+func TestAllocateAuction(t *testing.T) {
+	type auctionBid struct {
+		id       string
+		discount Rate
+		sequence int
+		quantity int
+	}
+	for _, test := range []struct {
+		name      string
+		qty       int
+		bids      []auctionBid
+		clearing  Rate
+		sold      int
+		allocated map[string]int
+	}{
+		{
+			name:      "an undersubscribed auction clears at its highest bid",
+			qty:       10,
+			bids:      []auctionBid{{"a", 5000000, 1, 4}, {"b", 6000000, 2, 3}},
+			clearing:  6000000,
+			sold:      7,
+			allocated: map[string]int{"a": 4, "b": 3},
+		},
+		{
+			name:      "the marginal bid is filled in part",
+			qty:       10,
+			bids:      []auctionBid{{"a", 7000000, 1, 5}, {"b", 5000000, 2, 4}, {"c", 6000000, 3, 4}},
+			clearing:  7000000,
+			sold:      10,
+			allocated: map[string]int{"a": 2, "b": 4, "c": 4},
+		},
+		{
+			name:      "bids above the clearing discount get nothing",
+			qty:       8,
+			bids:      []auctionBid{{"a", 5000000, 1, 4}, {"b", 6000000, 2, 4}, {"c", 7000000, 3, 3}},
+			clearing:  6000000,
+			sold:      8,
+			allocated: map[string]int{"a": 4, "b": 4, "c": 0},
+		},
+		{
+			name:      "the earlier of two bids at one discount fills first",
+			qty:       5,
+			bids:      []auctionBid{{"a", 6000000, 2, 4}, {"b", 6000000, 1, 4}},
+			clearing:  6000000,
+			sold:      5,
+			allocated: map[string]int{"a": 1, "b": 4},
+		},
+		{
+			name:      "an auction without bids sells nothing",
+			qty:       10,
+			allocated: map[string]int{},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var bids []AuctionBid
+			for _, b := range test.bids {
+				bids = append(bids, AuctionBid{ID: b.id, Discount: b.discount, Sequence: b.sequence, Quantity: b.quantity})
+			}
+
+			clearing, sold := allocateAuction(Auction{Qty: test.qty}, bids)
+			if clearing != test.clearing || sold != test.sold {
+				t.Errorf("cleared %d at %s, want %d at %s", sold, clearing, test.sold, test.clearing)
+			}
+			for _, b := range bids {
+				if b.Allocated != test.allocated[b.ID] {
+					t.Errorf("bid %s was allocated %d, want %d", b.ID, b.Allocated, test.allocated[b.ID])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Roles a caller can hold, taken from the role attribute of its certificate
+const (
+	roleIssuer    = "issuer"
+	roleInvestor  = "investor"
+	roleBank      = "bank"
+	roleCarrier   = "carrier"
+	roleRegistrar = "registrar"
+	roleAuditor   = "auditor"
+	roleAdmin     = "admin"
+)
+
+// Certificate attributes the chaincode reads
+const (
+	roleAttribute    = "role"
+	companyAttribute = "company"
+)
+
+// PermissionError is returned when the caller isn't allowed to do something
+type PermissionError struct {
+	Function string
+	Reason   string
+}
+
+func (e *PermissionError) Error() string {
+	return "Permission denied for " + e.Function + ": " + e.Reason
+}
+
+// hasRole checks the caller's certificate for the given role
+func hasRole(stub shim.ChaincodeStubInterface, role string) (bool, error) {
+	ok, err := stub.VerifyAttribute(roleAttribute, []byte(role))
+	if err != nil {
+		fmt.Println("Error verifying the " + roleAttribute + " attribute: " + err.Error())
+		return false, err
+	}
+	return ok, nil
+}
+
+// authorize checks the caller holds one of the roles allowed to call the
+// invoke function
+func authorize(stub shim.ChaincodeStubInterface, function string) error {
+	// Functions that aren't registered can't be called at all
+	invoke := lookupFunction(kindInvoke, function)
+	if invoke == nil {
+		return unknownFunction(function)
+	}
+	return invoke.authorize(stub)
+}
+
+// requireAdmin checks the caller has the admin role
+func requireAdmin(stub shim.ChaincodeStubInterface, function string) error {
+	admin, err := hasRole(stub, roleAdmin)
+	if err != nil || !admin {
+		return &PermissionError{function, "requires the " + roleAdmin + " role"}
+	}
+	return nil
+}
+
+// callerCompany reads the company the caller acts for from its certificate
+func callerCompany(stub shim.ChaincodeStubInterface) (string, error) {
+	company, err := stub.ReadCertAttribute(companyAttribute)
+	if err != nil {
+		fmt.Println("Error reading the " + companyAttribute + " attribute: " + err.Error())
+		return "", err
+	}
+	return string(company), nil
+}
+
+// requireCompany checks the caller acts for one of the companies, unless it
+// is an admin
+func requireCompany(stub shim.ChaincodeStubInterface, function string, companies ...string) error {
+	admin, err := hasRole(stub, roleAdmin)
+	if err == nil && admin {
+		return nil
+	}
+
+	caller, err := callerCompany(stub)
+	if err != nil {
+		return &PermissionError{function, "the caller certificate has no " + companyAttribute + " attribute"}
+	}
+	for _, company := range companies {
+		if caller == company {
+			return nil
+		}
+	}
+
+	return &PermissionError{function, "the caller acts for " + caller + ", not " + strings.Join(companies, " or ")}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// batchFunction runs several invokes in one transaction
+const batchFunction = "batch"
+
+// BatchStep is one invoke in a batch
+type BatchStep struct {
+	Function string   `json:"function"`
+	Args     []string `json:"args"`
+}
+
+// BatchResult is what one step of a batch returned
+type BatchResult struct {
+	Step     int             `json:"step"`
+	Function string          `json:"function"`
+	Result   json.RawMessage `json:"result,omitempty"`
+}
+
+// stepResult keeps a JSON result as it is and quotes anything else
+func stepResult(result []byte) (json.RawMessage, error) {
+	if len(result) == 0 {
+		return nil, nil
+	}
+	if json.Valid(result) {
+		return json.RawMessage(result), nil
+	}
+	return json.Marshal(string(result))
+}
+
+// recordID is the ID of a record created by the transaction. Outside a
+// batch it is the transaction ID; each step of a batch adds its number.
+func recordID(stub shim.ChaincodeStubInterface) string {
+	inv := invocationOf(stub)
+	if inv == nil || inv.step == 0 {
+		return stub.GetTxID()
+	}
+	return stub.GetTxID() + "-" + strconv.Itoa(inv.step)
+}
+
+// stepError keeps the code of a step's error and says which step it was
+func stepError(step int, function string, err error) *ChaincodeError {
+	failure := *asChaincodeError(err)
+	failure.Message = "Batch step " + strconv.Itoa(step) + " (" + function + ") failed: " + failure.Message
+	return &failure
+}
+
+/*
+	0 json [
+		{ "function": "issuePurchaseOrder", "args": ["{...}"] },
+		{ "function": "issueLetter_Credit", "args": ["{...}"] },
+		{ "function": "transferPaper", "args": ["{...}"] }
+	]
+*/
+// batch runs each step through the same checks and handlers as a single
+// invoke, in order. The first failing step fails the whole transaction so
+// none of the steps are committed.
+func (t *SimpleChaincode) batch(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		fmt.Println("Error obtaining batch steps")
+		return nil, badArguments(batchFunction, "a JSON list of steps")
+	}
+
+	var steps []BatchStep
+	err := json.Unmarshal([]byte(args[0]), &steps)
+	if err != nil {
+		fmt.Println("Error unmarshalling batch steps")
+		return nil, newError(codeInvalidRecord, "", batchFunction, "", "Invalid batch, expecting a JSON list of {function, args} steps")
+	}
+	if len(steps) == 0 {
+		return nil, newError(codeBadArguments, "", batchFunction, "", "A batch needs at least one step")
+	}
+
+	// The steps number their records on the context of the invoke
+	inv := invocationOf(stub)
+	if inv == nil {
+		return nil, newError(codeFailed, "", batchFunction, "", "A batch can only run as an invoke")
+	}
+
+	// Check every step before running any of them
+	for i, step := range steps {
+		label := "Batch step " + strconv.Itoa(i+1)
+		if step.Function == "" {
+			return nil, newError(codeBadArguments, "", batchFunction, "function", label+" has no function")
+		}
+		if step.Function == batchFunction {
+			return nil, newError(codeBadArguments, "", batchFunction, "function", label+": a batch cannot contain another batch")
+		}
+		if lookupFunction(kindInvoke, step.Function) == nil {
+			return nil, stepError(i+1, step.Function, unknownFunction(step.Function))
+		}
+		for _, arg := range step.Args {
+			if strings.HasPrefix(arg, idempotencyArg) {
+				return nil, newError(codeBadArguments, "", batchFunction, "args", label+": an idempotency key applies to the whole batch, not a step")
+			}
+		}
+		err = authorize(stub, step.Function)
+		if err != nil {
+			fmt.Println(label + ": " + err.Error())
+			return nil, stepError(i+1, step.Function, err)
+		}
+	}
+
+	defer func() { inv.step = 0 }()
+
+	var results []BatchResult
+	for i, step := range steps {
+		fmt.Println("Running batch step " + strconv.Itoa(i+1) + ": " + step.Function)
+		inv.step = i + 1
+		result, err := t.invokeFunction(inv, step.Function, step.Args)
+		if err != nil {
+			fmt.Println("Batch step " + strconv.Itoa(i+1) + " failed")
+			return nil, stepError(i+1, step.Function, err)
+		}
+
+		raw, err := stepResult(result)
+		if err != nil {
+			fmt.Println("Error marshalling the result of batch step " + strconv.Itoa(i+1))
+			return nil, err
+		}
+		results = append(results, BatchResult{Step: i + 1, Function: step.Function, Result: raw})
+	}
+
+	resultsBytes, err := json.Marshal(&results)
+	if err != nil {
+		fmt.Println("Error marshalling batch results")
+		return nil, newError(codeFailed, "", batchFunction, "", "Error marshalling batch results")
+	}
+	fmt.Println("All success, ran " + strconv.Itoa(len(steps)) + " batch steps")
+	return resultsBytes, nil
+}
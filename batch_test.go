@@ -0,0 +1,97 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBatchRunsEveryStep(t *testing.T) {
+	s, cusip := newMarket(t)
+	s.mustInvoke("batch", `[
+		{"function":"issueQuote","args":["{\"quoteNo\":\"Q1\",\"qty\":\"3\"}"]},
+		{"function":"transferPaper","args":["{\"CUSIP\":\"`+cusip+`\",\"fromCompany\":\"company1\",\"toCompany\":\"company2\",\"quantity\":2}"]}
+	]`)
+
+	if got := owner(s.cp(cusip), "company2").Quantity; got != 2 {
+		t.Fatalf("company2 holds %d, want 2", got)
+	}
+	var quotes []Quote
+	s.mustQuery(&quotes, "GetAllQuotes")
+	if len(quotes) != 1 {
+		t.Fatalf("got %d quotes, want 1", len(quotes))
+	}
+}
+
+func TestBatchFailureCommitsNothing(t *testing.T) {
+	s, _ := newMarket(t)
+	s.mustFail(codeInvalidField, "batch", `[
+		{"function":"issueQuote","args":["{\"quoteNo\":\"Q1\",\"qty\":\"3\"}"]},
+		{"function":"issueQuote","args":["{\"quoteNo\":\"Q1\",\"qty\":\"x\"}"]}
+	]`)
+
+	var quotes []Quote
+	s.mustQuery(&quotes, "GetAllQuotes")
+	if len(quotes) != 0 {
+		t.Fatalf("got %d quotes after a failed batch, want 0", len(quotes))
+	}
+}
+
+func TestBatchRejectsNestingAndUnknownSteps(t *testing.T) {
+	s, _ := newMarket(t)
+	s.mustFail(codeBadArguments, "batch", `[{"function":"batch","args":["[]"]}]`)
+	s.mustFail(codeUnknownFunction, "batch", `[{"function":"nope","args":[]}]`)
+	s.mustFail(codeBadArguments, "batch", `[]`)
+}
+
+func TestBatchChecksEachStepsRole(t *testing.T) {
+	s, _ := newMarket(t)
+	s.as(roleCarrier, "company2")
+	s.mustFail(codePermission, "batch", `[{"function":"issueQuote","args":["{\"quoteNo\":\"Q1\",\"qty\":\"3\"}"]}]`)
+}
+
+func TestBatchStepsCreateSeparateRecords(t *testing.T) {
+	s, cusip := newMarket(t)
+	trade := `{\"cusip\":\"` + cusip + `\",\"seller\":\"company1\",\"buyer\":\"company2\",\"quantity\":%d,\"discount\":5}`
+	s.mustInvoke("batch", `[
+		{"function":"proposeTrade","args":["`+fmt.Sprintf(trade, 2)+`"]},
+		{"function":"proposeTrade","args":["`+fmt.Sprintf(trade, 3)+`"]}
+	]`)
+
+	tx := s.lastTxID()
+	for step, quantity := range map[string]int{"1": 2, "2": 3} {
+		var got Trade
+		s.mustQuery(&got, "GetTrade", tx+"-"+step)
+		if got.Quantity != quantity {
+			t.Fatalf("trade from step %s is for %d, want %d", step, got.Quantity, quantity)
+		}
+	}
+	if got := owner(s.cp(cusip), "company1").Reserved; got != 5 {
+		t.Fatalf("company1 has %d reserved, want 5", got)
+	}
+
+	// The step goes with the batch's invoke, so the next one is unnumbered
+	s.mustInvoke("proposeTrade", `{"cusip":"`+cusip+`","seller":"company1","buyer":"company2","quantity":1,"discount":5}`)
+	var got Trade
+	s.mustQuery(&got, "GetTrade", s.lastTxID())
+	if got.Quantity != 1 {
+		t.Fatalf("trade %s is for %d, want 1", s.lastTxID(), got.Quantity)
+	}
+}
@@ -23,46 +23,260 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
 
-var quotePrefix = "qt:"
-var propertyPrefix = "pt:"
-var proposalPrefix = "pr:"
-var agreementPrefix = "ag:"
-var deedPrefix = "de:"
-var notificationPrefix = "de:"
-var purchase_orderPrefix = "po:"
-var letter_creditPrefix = "LC:"
-var bill_ladingPrefix = "bl:"
+var quotePrefix = keyPrefix("quote")
+var propertyPrefix = keyPrefix("property")
+var proposalPrefix = keyPrefix("proposal")
+var agreementPrefix = keyPrefix("agreement")
+var deedPrefix = keyPrefix("deed")
+var notificationPrefix = keyPrefix("notification")
+var purchase_orderPrefix = keyPrefix("po")
+var letter_creditPrefix = keyPrefix("lc")
+var bill_ladingPrefix = keyPrefix("bl")
 
-var cpPrefix = "cp:"
-var accountPrefix = "acct:"
-var accountsKey = "accounts"
+var cpPrefix = keyPrefix("cp")
+var accountPrefix = keyPrefix("account")
 
-var recentLeapYear = 2016
+// Issuer codes are kept under issuerCodePrefix with the ID, as a JSON
+// string, of the company they were assigned to
+var issuerCodePrefix = keyPrefix("issuer")
+
+// The number of the next issuer code to allocate is kept, as a JSON number,
+// under issuerSequenceKey
+var issuerSequencePrefix = keyPrefix("issuerseq")
+var issuerSequenceKey = issuerSequencePrefix + "next"
+
+// every new account starts with 10,000,000.00 in cash
+var initialCashBalance = Money(10000000 * 100)
 
 // SimpleChaincode example simple Chaincode implementation
 type SimpleChaincode struct {
 }
 
-func generateCUSIPSuffix(issueDate string, days int) (string, error) {
+// A CUSIP is a six character issuer code, a two character issue number taken
+// from the issuer's series counter and a modulus 10 "double-add-double" check digit.
+// Issue numbers skip I and O so they can't be confused with 1 and 0.
+var cusipIssueChars = "0123456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+const cusipIssuerCodeLength = 6
+
+// cusipIssuerCode encodes an issuer sequence number as the six issuer code
+// characters
+func cusipIssuerCode(sequence int) (string, error) {
+	if sequence < 0 {
+		return "", errors.New("Issuer code out of range " + strconv.Itoa(sequence))
+	}
+
+	base := len(cusipIssueChars)
+	code := make([]byte, cusipIssuerCodeLength)
+	n := sequence
+	for i := len(code) - 1; i >= 0; i-- {
+		code[i] = cusipIssueChars[n%base]
+		n /= base
+	}
+	if n > 0 {
+		return "", errors.New("Issuer code out of range " + strconv.Itoa(sequence))
+	}
+
+	return string(code), nil
+}
+
+// registerIssuerCode assigns an account the next issuer code from the issuer
+// sequence, so codes never depend on the company's name. Codes registered
+// before the sequence was kept are skipped.
+func registerIssuerCode(stub shim.ChaincodeStubInterface, account *Account) error {
+	sequence := 1
+	sequenceBytes, err := stub.GetState(issuerSequenceKey)
+	if err != nil {
+		fmt.Println("Error retrieving the issuer sequence")
+		return storageError(entityIssuerCode, issuerSequenceKey, "retrieving")
+	}
+	if sequenceBytes != nil {
+		err = json.Unmarshal(sequenceBytes, &sequence)
+		if err != nil {
+			fmt.Println("Error unmarshalling the issuer sequence")
+			return storageError(entityIssuerCode, issuerSequenceKey, "unmarshalling")
+		}
+	}
+
+	var code string
+	var holderBytes []byte
+	for {
+		code, err = cusipIssuerCode(sequence)
+		if err != nil {
+			fmt.Println("Error allocating an issuer code for " + account.ID)
+			return newError(codeConflict, entityIssuerCode, issuerSequenceKey, "", "Every issuer code has been allocated")
+		}
+		sequence++
+
+		holderBytes, err = stub.GetState(issuerCodePrefix + code)
+		if err != nil {
+			fmt.Println("Error retrieving issuer code " + code)
+			return storageError(entityIssuerCode, code, "retrieving")
+		}
+		if holderBytes == nil {
+			break
+		}
+		fmt.Println("Issuer code " + code + " is already assigned, trying the next one")
+	}
+
+	idBytes, err := json.Marshal(account.ID)
+	if err != nil {
+		fmt.Println("Error marshalling issuer code " + code)
+		return storageError(entityIssuerCode, code, "marshalling")
+	}
+	err = putState(stub, issuerCodePrefix+code, idBytes)
+	if err != nil {
+		fmt.Println("Error writing issuer code " + code)
+		return storageError(entityIssuerCode, code, "writing")
+	}
+	sequenceBytes, err = json.Marshal(sequence)
+	if err != nil {
+		fmt.Println("Error marshalling the issuer sequence")
+		return storageError(entityIssuerCode, issuerSequenceKey, "marshalling")
+	}
+	err = putState(stub, issuerSequenceKey, sequenceBytes)
+	if err != nil {
+		fmt.Println("Error writing the issuer sequence")
+		return storageError(entityIssuerCode, issuerSequenceKey, "writing")
+	}
+	account.IssuerCode = code
+	return nil
+}
+
+// cusipIssueNumber encodes a series number as the two issue characters
+func cusipIssueNumber(series int) (string, error) {
+	base := len(cusipIssueChars)
+	if series < 0 || series >= base*base {
+		return "", errors.New("Issue number out of range " + strconv.Itoa(series))
+	}
+
+	return string(cusipIssueChars[series/base]) + string(cusipIssueChars[series%base]), nil
+}
+
+// cusipCheckDigit computes the check digit for the first eight characters of a CUSIP
+func cusipCheckDigit(base string) (string, error) {
+	if len(base) != 8 {
+		return "", errors.New("Expecting 8 characters to compute a CUSIP check digit, got " + base)
+	}
+
+	sum := 0
+	for i, c := range []byte(base) {
+		var v int
+		switch {
+		case c >= '0' && c <= '9':
+			v = int(c - '0')
+		case c >= 'A' && c <= 'Z':
+			v = int(c-'A') + 10
+		case c == '*':
+			v = 36
+		case c == '@':
+			v = 37
+		case c == '#':
+			v = 38
+		default:
+			return "", errors.New("Invalid CUSIP character in " + base)
+		}
+
+		// double every second character
+		if i%2 == 1 {
+			v *= 2
+		}
+		sum += v/10 + v%10
+	}
+
+	return strconv.Itoa((10 - sum%10) % 10), nil
+}
+
+// validCUSIP reports whether cusip is nine characters with a correct check digit
+func validCUSIP(cusip string) bool {
+	if len(cusip) != 9 {
+		return false
+	}
+	check, err := cusipCheckDigit(cusip[:8])
+	if err != nil {
+		return false
+	}
+
+	return check == cusip[8:]
+}
+
+// generateCUSIP builds the CUSIP for the next issue in the issuer's series and
+// advances the series counter on the account
+func generateCUSIP(account *Account) (string, error) {
+	issueNumber, err := cusipIssueNumber(account.CUSIPSeries)
+	if err != nil {
+		return "", newError(codeConflict, entityAccount, account.ID, "cusipSeries", "The company "+account.ID+" has used all of its CUSIP issue numbers")
+	}
 
-	t, err := msToTime(issueDate)
+	if account.IssuerCode == "" {
+		return "", newError(codeInvalidRecord, entityAccount, account.ID, "issuerCode", "The company "+account.ID+" has no issuer code")
+	}
+	base := account.IssuerCode + issueNumber
+	check, err := cusipCheckDigit(base)
 	if err != nil {
-		return "", err
+		return "", invalidField(entityAccount, account.ID, "issuerCode", err.Error())
+	}
+
+	account.CUSIPSeries++
+	return base + check, nil
+}
+
+// nextFreeCUSIP takes the next CUSIP in the issuer's series, skipping any
+// already in use
+func nextFreeCUSIP(stub shim.ChaincodeStubInterface, account *Account) (string, error) {
+	// Accounts opened before issuer codes were registered take theirs now
+	if account.IssuerCode == "" {
+		err := registerIssuerCode(stub, account)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	maturityDate := t.AddDate(0, 0, days)
-	month := int(maturityDate.Month())
-	day := maturityDate.Day()
+	for {
+		cusip, err := generateCUSIP(account)
+		if err != nil {
+			fmt.Println("Error generating cusip")
+			return "", err
+		}
+
+		fmt.Println("Getting State on CP " + cusip)
+		cpBytes, err := stub.GetState(cpPrefix + cusip)
+		if err != nil {
+			fmt.Println("Error retrieving cp " + cusip)
+			return "", storageError(entityCP, cusip, "retrieving")
+		}
+		if cpBytes == nil {
+			return cusip, nil
+		}
+		fmt.Println("CUSIP " + cusip + " is already in use, trying the next issue number")
+	}
+}
 
-	suffix := seventhDigit[month] + eigthDigit[day]
-	return suffix, nil
+// paperStatus is the status reported for a paper in events
+func paperStatus(cp CP) string {
+	if cp.Matured {
+		return "matured"
+	}
+	return "outstanding"
+}
 
+// sameTerms reports whether two papers describe the same issue
+func sameTerms(a CP, b CP) bool {
+	return a.Issuer == b.Issuer &&
+		a.Ticker == b.Ticker &&
+		a.Par == b.Par &&
+		a.Discount == b.Discount &&
+		a.Maturity == b.Maturity &&
+		a.DayCount == b.DayCount &&
+		currencyOf(a) == currencyOf(b) &&
+		instrumentOf(a) == instrumentOf(b) &&
+		a.Coupon == b.Coupon &&
+		a.IssueDate == b.IssueDate
 }
 
 const (
@@ -80,9 +294,85 @@ func msToTime(ms string) (time.Time, error) {
 		(msInt%millisPerSecond)*nanosPerMillisecond), nil
 }
 
+// timeToMs formats a time the way msToTime reads it
+func timeToMs(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/nanosPerMillisecond, 10)
+}
+
+// txTime returns the timestamp of the transaction currently being executed
+func txTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ts == nil {
+		return time.Time{}, errors.New("Transaction timestamp not available")
+	}
+
+	return time.Unix(ts.Seconds, int64(ts.Nanos)), nil
+}
+
+// A time sent by a client may be this far from the transaction time
+const clientTimeTolerance = 5 * time.Minute
+
+// parseClientTime reads a time sent by a client, either in milliseconds as
+// stored or in RFC 3339
+func parseClientTime(value string) (time.Time, error) {
+	t, err := msToTime(value)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// stampTime is the transaction time in milliseconds, for a field of the
+// record entity key the client may also have filled in. A client value is
+// only checked: it has to be within clientTimeTolerance of the transaction
+// time.
+func stampTime(stub shim.ChaincodeStubInterface, entity string, key string, field string, client string) (string, error) {
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return "", timestampError(entity, key)
+	}
+	if client == "" {
+		return timeToMs(now), nil
+	}
+
+	t, err := parseClientTime(client)
+	if err != nil {
+		fmt.Println("Invalid " + field + " " + client)
+		return "", invalidField(entity, key, field, "Invalid "+field+" "+client+", expecting milliseconds or RFC 3339")
+	}
+	drift := t.Sub(now)
+	if drift > clientTimeTolerance || drift < -clientTimeTolerance {
+		fmt.Println("The " + field + " " + client + " is too far from the transaction time")
+		return "", invalidField(entity, key, field, "The "+field+" "+client+" is more than "+clientTimeTolerance.String()+" from the transaction time "+timeToMs(now))
+	}
+
+	return timeToMs(now), nil
+}
+
+// maturityDate is the issue date of the paper plus its maturity in days
+func maturityDate(cp CP) (time.Time, error) {
+	t, err := msToTime(cp.IssueDate)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.AddDate(0, 0, cp.Maturity), nil
+}
+
 type Owner struct {
 	Company  string `json:"company"`
 	Quantity int    `json:"quantity"`
+	Reserved int    `json:"reserved"`
+	Pledged  int    `json:"pledged"`
+}
+
+// available is the quantity the owner can still sell or pledge
+func (o Owner) available() int {
+	return o.Quantity - o.Reserved - o.Pledged
 }
 
 
@@ -113,7 +403,7 @@ type Quote struct {
 	IssueDate string  `json:"issueDate"`
 	ModifiedOn    string  `json:"modifiedon"`
 	RequesterOrg    string  `json:"requesterorg"`
-	Price 		string   `json:"price"`
+	Price 		Money    `json:"price"`
 	Country    string  `json:"country"`
 	Parameter1 	string  `json:"parameter1"`
 	Parameter2  string   `json:"parameter2"`
@@ -138,9 +428,9 @@ type PurchaseOrder struct {
 	ShipMethod     string    `json:"shipMethod"`
 	ShipTerm       string    `json:"shipTerm"`
 	DeliveryDate   string    `json:"deliveryDate"`
-	SubTotal       string    `json:"subTotal"`
-	SalesTax       string    `json:"salesTax"`
-	Total          string    `json:"total"`
+	SubTotal       Money     `json:"subTotal"`
+	SalesTax       Money     `json:"salesTax"`
+	Total          Money     `json:"total"`
 	Status         string    `json:"status"`
 	ItemDetails []ItemDetail `json:"itemDetails"`
 	Parameter1     string    `json:"parameter1"`
@@ -169,7 +459,7 @@ type Bill_Lading struct {
 	SCAC           string    `json:"sCAC"`
 	ProNumber      string    `json:"proNumber"`
 	FrieghtChargeTerms string `json:"frieghtChargeTerms"`
-	CODAmount      string    `json:"cODAmount"`
+	CODAmount      Money     `json:"cODAmount"`
 	FeeTerms       string    `json:"feeTerms"`
 	Status         string    `json:"status"`
 	OrderDetails  []OrderDetail `json:"OrderDetails"`  
@@ -185,8 +475,8 @@ type Letter_Credit struct {
 	QuoteNo        string    `json:"quoteno"`
 	LcNo           string    `json:"lcNo"`
 	QuoteValidity  string    `json:"quoteValidity"`
-	TotalAmount    string    `json:"totalAmount"`
-	SalesTax       string    `json:"salesTax"`
+	TotalAmount    Money     `json:"totalAmount"`
+	SalesTax       Money     `json:"salesTax"`
 	Representative string    `json:"representative"`
 	OrgName        string    `json:"orgName"`
 	Address        string    `json:"address"`
@@ -194,6 +484,7 @@ type Letter_Credit struct {
 	ModifiedOn     string    `json:"modifiedon"`
 	RequesterOrg   string    `json:"requesterorg"`
 	Country        string    `json:"country"`
+	Status         string    `json:"status"`
 	ProductDetails []Details    `json:"productDetails"`
 	Parameter1     string    `json:"parameter1"`
 	Parameter2     string    `json:"parameter2"`
@@ -227,7 +518,7 @@ type Proposal struct {
 	ProposalNo string  `json:"proposalNo"`
 	PropId     string  `json:"propid"`
 	ProposedBy    string  `json:"proposedby"`
-	ProposedPrice    string  `json:"proposedprice"`
+	ProposedPrice    Money   `json:"proposedprice"`
 	ProposedDate    string  `json:"proposeddate"`
 	Parameter1 string  `json:"parameter1"`
 	Parameter2 string  `json:"parameter2"`
@@ -250,6 +541,7 @@ type SaleAgreement struct {
 	Parameter5 string  `json:"parameter5"`
 	Parameter6 string  `json:"parameter6"`
 	SignedOn string  `json:"signedon"`
+	Status string  `json:"status"`
 }
 
 type SaleDeed struct {
@@ -283,7 +575,7 @@ type Party struct {
 type Loan struct {
 	Bank     string  `json:"bank"`
 	Branch    string  `json:"branch"`
-	LoanAmount    string  `json:"amount"`
+	LoanAmount    Money   `json:"amount"`
 	LoanType    string  `json:"type"`
 	LoanPercentage    string  `json:"percentage"`
 	ROI    string  `json:"roi"`
@@ -299,7 +591,7 @@ type Registrar struct {
 
 type Settlement struct {
 	SettlementType     string  `json:"type"`
-	SettlementAmount    string  `json:"amount"`
+	SettlementAmount    Money   `json:"amount"`
 	SettlementRef		string `json:"ref"`
 	SettlementDate		string `json:"date"`
 }
@@ -308,20 +600,36 @@ type Settlement struct {
 type CP struct {
 	CUSIP     string  `json:"cusip"`
 	Ticker    string  `json:"ticker"`
-	Par       float64 `json:"par"`
+	Par       Money   `json:"par"`
 	Qty       int     `json:"qty"`
-	Discount  float64 `json:"discount"`
+	Discount  Rate    `json:"discount"`
 	Maturity  int     `json:"maturity"`
+	DayCount  string  `json:"dayCount"`
+	Currency  string  `json:"currency"`
 	Owners    []Owner `json:"owner"`
 	Issuer    string  `json:"issuer"`
 	IssueDate string  `json:"issueDate"`
+	Matured   bool    `json:"matured"`
+
+	InstrumentType string `json:"instrumentType,omitempty"`
+	Coupon         Rate   `json:"coupon,omitempty"`
 }
 
 type Account struct {
-	ID          string   `json:"id"`
-	Prefix      string   `json:"prefix"`
-	CashBalance float64  `json:"cashBalance"`
-	AssetsIds   []string `json:"assetIds"`
+	ID             string   `json:"id"`
+	Prefix         string   `json:"prefix"`
+	CashBalance    Money    `json:"cashBalance"`
+	AssetsIds      []string `json:"assetIds"`
+	CUSIPSeries    int      `json:"cusipSeries"`
+	ReservedCash   Money    `json:"reservedCash"`
+	Program        *Program `json:"program,omitempty"`
+	JournalEntries int      `json:"journalEntries"`
+	IssuerCode     string   `json:"issuerCode"`
+}
+
+// availableCash is the cash balance not held for pending trades
+func (a Account) availableCash() Money {
+	return a.CashBalance - a.ReservedCash
 }
 
 type Transaction struct {
@@ -329,7 +637,7 @@ type Transaction struct {
 	FromCompany string  `json:"fromCompany"`
 	ToCompany   string  `json:"toCompany"`
 	Quantity    int     `json:"quantity"`
-	Discount    float64 `json:"discount"`
+	Discount    Rate    `json:"discount"`
 }
 
 type ItemDetail struct {
@@ -337,17 +645,17 @@ type ItemDetail struct {
 	Quantity    string  `json:"qty"`
 	Description string  `json:"description"`
 	Job         string  `json:"job"`
-	UnitPrice   string  `json:"unitPrice"`
-	LineTotal   string  `json:"lineTotal"`
+	UnitPrice   Money   `json:"unitPrice"`
+	LineTotal   Money   `json:"lineTotal"`
 }
 
 type Details struct {
 	ItemNo      string  `json:"itemNo"`
 	ItemName    string  `json:"itemName"`
-	ListPrice   string  `json:"listPrice"`
+	ListPrice   Money   `json:"listPrice"`
 	Quantity    string  `json:"qty"`
 	Discount    string  `json:"discount"`
-	Amount      string  `json:"amount"`
+	Amount      Money   `json:"amount"`
 	TaxMode     string  `json:"taxMode"`
 	Status      string  `json:"status"`
 }
@@ -385,73 +693,12 @@ type prices struct {
 }
 
 func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	// Initialize the collection of commercial paper keys
-	fmt.Println("Initializing paper keys collection")
-	var blank []string
-	var blank1 []string
-	var blank2 []string
-	var blank3 []string
-	var blank4 []string
-	var blank5 []string
-	var blank6 []string
-	var blank7 []string
-	var blank8 []string
-	var blank9 []string
-
-	blankBytes, _ := json.Marshal(&blank)
-	err := stub.PutState("PaperKeys", blankBytes)
+	// Collections are read with range scans over their key prefixes, so
+	// there are no key collections to create
+	err := checkKeyPrefixes(keyPrefixes())
 	if err != nil {
-		fmt.Println("Failed to initialize paper key collection")
-	}
-
-	blankBytes1, _ := json.Marshal(&blank1)
-	err1 := stub.PutState("PropertyKeys", blankBytes1)
-	if err1 != nil {
-		fmt.Println("Failed to initialize paper key collection")
-	}
-
-	blankBytes2, _ := json.Marshal(&blank2)
-	err2 := stub.PutState("ProposalKeys", blankBytes2)
-	if err2 != nil {
-		fmt.Println("Failed to initialize paper key collection")
-	}
-
-	blankBytes3, _ := json.Marshal(&blank3)
-	err3 := stub.PutState("AgreementKeys", blankBytes3)
-	if err3 != nil {
-		fmt.Println("Failed to initialize paper key collection")
-	}
-
-	blankBytes4, _ := json.Marshal(&blank4)
-	err4 := stub.PutState("DeedKeys", blankBytes4)
-	if err4 != nil {
-		fmt.Println("Failed to initialize paper key collection")
-	}
-
-	blankBytes5, _ := json.Marshal(&blank5)
-	err5 := stub.PutState("NotificationKeys", blankBytes5)
-	if err5 != nil {
-		fmt.Println("Failed to initialize paper key collection")
-	}
-	blankBytes6, _ := json.Marshal(&blank6)
-	err6 := stub.PutState("QuoteKeys", blankBytes6)
-	if err6 != nil {
-		fmt.Println("Failed to initialize paper key collection")
-	}
-	blankBytes7, _ := json.Marshal(&blank7)
-	err7 := stub.PutState("letter_creditKeys", blankBytes7)
-	if err7 != nil {
-		fmt.Println("Failed to initialize paper key collection")
-	}
-	blankBytes8, _ := json.Marshal(&blank8)
-	err8 := stub.PutState("PurchaseOrderKeys", blankBytes8)
-	if err8 != nil {
-		fmt.Println("Failed to initialize paper key collection")
-	}
-	blankBytes9, _ := json.Marshal(&blank9)
-	err9 := stub.PutState("Bill_LadingKeys", blankBytes9)
-	if err9 != nil {
-		fmt.Println("Failed to initialize paper key collection")
+		fmt.Println(err.Error())
+		return nil, err
 	}
 
 	fmt.Println("Initialization complete")
@@ -466,27 +713,60 @@ func (t *SimpleChaincode) createAccounts(stub shim.ChaincodeStubInterface, args
 	numAccounts, err := strconv.Atoi(args[0])
 	if err != nil {
 		fmt.Println("error creating accounts with input")
-		return nil, errors.New("createAccounts accepts a single integer argument")
+		return nil, invalidField(entityAccount, "", "count", "createAccounts accepts a single integer argument")
 	}
 	//create a bunch of accounts
 	var account Account
 	counter := 1
 	for counter <= numAccounts {
+		// Prefixes start quote and purchase order numbers. From company10
+		// on the number is zero padded to keep them six characters long.
 		var prefix string
 		suffix := "000A"
 		if counter < 10 {
 			prefix = strconv.Itoa(counter) + "0" + suffix
 		} else {
-			prefix = strconv.Itoa(counter) + suffix
+			prefix = fmt.Sprintf("%05dA", counter)
 		}
 		var assetIds []string
-		account = Account{ID: "company" + strconv.Itoa(counter), Prefix: prefix, CashBalance: 10000000.0, AssetsIds: assetIds}
+		account = Account{ID: "company" + strconv.Itoa(counter), Prefix: prefix, AssetsIds: assetIds}
+		err = checkAccountID(account.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Accounts that already exist keep their balances, which only
+		// moveCash may change
+		existingBytes, err := stub.GetState(accountPrefix + account.ID)
+		if err != nil {
+			fmt.Println("Error getting state of " + accountPrefix + account.ID)
+			return nil, storageError(entityAccount, account.ID, "retrieving")
+		}
+		if existingBytes != nil {
+			fmt.Println("Account " + account.ID + " already exists, skipping it")
+			counter++
+			continue
+		}
+
+		err = registerIssuerCode(stub, &account)
+		if err != nil {
+			return nil, err
+		}
+		err = moveCash(stub, nil, &account, initialCashBalance, "opening balance")
+		if err != nil {
+			return nil, err
+		}
 		accountBytes, err := json.Marshal(&account)
 		if err != nil {
 			fmt.Println("error creating account" + account.ID)
-			return nil, errors.New("Error creating account " + account.ID)
+			return nil, storageError(entityAccount, account.ID, "marshalling")
+		}
+		err = putState(stub, accountPrefix+account.ID, accountBytes)
+		if err != nil {
+			fmt.Println("error creating account" + account.ID)
+			return nil, storageError(entityAccount, account.ID, "writing")
 		}
-		err = stub.PutState(accountPrefix+account.ID, accountBytes)
+		recordEvent(stub, entityAccount, actionCreated, accountPrefix+account.ID, "", "")
 		counter++
 		fmt.Println("created account" + accountPrefix + account.ID)
 	}
@@ -500,63 +780,59 @@ func (t *SimpleChaincode) createAccount(stub shim.ChaincodeStubInterface, args [
 	// Obtain the username to associate with the account
 	if len(args) != 1 {
 		fmt.Println("Error obtaining username")
-		return nil, errors.New("createAccount accepts a single username argument")
+		return nil, badArguments("createAccount", "username")
 	}
 	username := args[0]
+	err := checkAccountID(username)
+	if err != nil {
+		return nil, err
+	}
+	if username == cashExternal {
+		return nil, invalidField(entityAccount, username, "id", "The name "+cashExternal+" is reserved for the cash journal")
+	}
+
+	// An existing account keeps its issuer code and balances. A key left
+	// with no data is taken to have no account.
+	fmt.Println("Attempting to get state of any existing account for " + username)
+	existingBytes, err := stub.GetState(accountPrefix + username)
+	if err != nil {
+		fmt.Println("Error getting state of " + accountPrefix + username)
+		return nil, storageError(entityAccount, username, "retrieving")
+	}
+	if len(existingBytes) > 0 {
+		fmt.Println("Account already exists for " + username)
+		return nil, alreadyExists(entityAccount, username)
+	}
 
 	// Build an account object for the user
 	var assetIds []string
 	suffix := "000A"
 	prefix := username + suffix
-	var account = Account{ID: username, Prefix: prefix, CashBalance: 10000000.0, AssetsIds: assetIds}
+	var account = Account{ID: username, Prefix: prefix, AssetsIds: assetIds}
+	err = registerIssuerCode(stub, &account)
+	if err != nil {
+		return nil, err
+	}
+	err = moveCash(stub, nil, &account, initialCashBalance, "opening balance")
+	if err != nil {
+		return nil, err
+	}
 	accountBytes, err := json.Marshal(&account)
 	if err != nil {
 		fmt.Println("error creating account" + account.ID)
-		return nil, errors.New("Error creating account " + account.ID)
+		return nil, storageError(entityAccount, account.ID, "marshalling")
 	}
 
-	fmt.Println("Attempting to get state of any existing account for " + account.ID)
-	existingBytes, err := stub.GetState(accountPrefix + account.ID)
-	if err == nil {
-
-		var company Account
-		err = json.Unmarshal(existingBytes, &company)
-		if err != nil {
-			fmt.Println("Error unmarshalling account " + account.ID + "\n--->: " + err.Error())
-
-			if strings.Contains(err.Error(), "unexpected end") {
-				fmt.Println("No data means existing account found for " + account.ID + ", initializing account.")
-				err = stub.PutState(accountPrefix+account.ID, accountBytes)
-
-				if err == nil {
-					fmt.Println("created account" + accountPrefix + account.ID)
-					return nil, nil
-				} else {
-					fmt.Println("failed to create initialize account for " + account.ID)
-					return nil, errors.New("failed to initialize an account for " + account.ID + " => " + err.Error())
-				}
-			} else {
-				return nil, errors.New("Error unmarshalling existing account " + account.ID)
-			}
-		} else {
-			fmt.Println("Account already exists for " + account.ID + " " + company.ID)
-			return nil, errors.New("Can't reinitialize existing user " + account.ID)
-		}
-	} else {
-
-		fmt.Println("No existing account found for " + account.ID + ", initializing account.")
-		err = stub.PutState(accountPrefix+account.ID, accountBytes)
-
-		if err == nil {
-			fmt.Println("created account" + accountPrefix + account.ID)
-			return nil, nil
-		} else {
-			fmt.Println("failed to create initialize account for " + account.ID)
-			return nil, errors.New("failed to initialize an account for " + account.ID + " => " + err.Error())
-		}
-
+	fmt.Println("No existing account found for " + account.ID + ", initializing account.")
+	err = putState(stub, accountPrefix+account.ID, accountBytes)
+	if err != nil {
+		fmt.Println("failed to create initialize account for " + account.ID)
+		return nil, storageError(entityAccount, account.ID, "writing")
 	}
 
+	recordEvent(stub, entityAccount, actionCreated, accountPrefix+account.ID, "", "")
+	fmt.Println("created account" + accountPrefix + account.ID)
+	return nil, nil
 }
 
 
@@ -569,7 +845,7 @@ func (t *SimpleChaincode) issueQuote(stub shim.ChaincodeStubInterface, args []st
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+		return nil, badArguments("issueQuote", "quote record")
 	}
 
 	var quote Quote
@@ -580,7 +856,7 @@ func (t *SimpleChaincode) issueQuote(stub shim.ChaincodeStubInterface, args []st
 	err = json.Unmarshal([]byte(args[0]), &quote)
 	if err != nil {
 		fmt.Println("error invalid Quote issue")
-		return nil, errors.New("Invalid Quote issue")
+		return nil, invalidRecord(entityQuote, err)
 	}
 
 	
@@ -592,55 +868,26 @@ func (t *SimpleChaincode) issueQuote(stub shim.ChaincodeStubInterface, args []st
 	cpRxBytes, err := stub.GetState(quotePrefix + quote.QuoteNo)
 	if cpRxBytes == nil {
 		fmt.Println("QuoteNo does not exist, creating it")
-		cpBytes, err := json.Marshal(&quote)
+		quote.IssueDate, err = stampTime(stub, entityQuote, quote.QuoteNo, "issueDate", quote.IssueDate)
 		if err != nil {
-			fmt.Println("Error marshalling quote")
-			return nil, errors.New("Error issuing quote")
+			return nil, err
 		}
-		err = stub.PutState(quotePrefix+quote.QuoteNo, cpBytes)
+		quote.ModifiedOn, err = stampTime(stub, entityQuote, quote.QuoteNo, "modifiedon", quote.ModifiedOn)
 		if err != nil {
-			fmt.Println("Error issuing paper")
-			return nil, errors.New("Error issuing quote")
+			return nil, err
 		}
-
-		
-
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting Paper Keys")
-		keysBytes, err := stub.GetState("QuoteKeys")
+		cpBytes, err := json.Marshal(&quote)
 		if err != nil {
-			fmt.Println("Error retrieving paper keys")
-			return nil, errors.New("Error retrieving paper keys")
+			fmt.Println("Error marshalling quote")
+			return nil, storageError(entityQuote, quote.QuoteNo, "marshalling")
 		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
+		err = putState(stub, quotePrefix+quote.QuoteNo, cpBytes)
 		if err != nil {
-			fmt.Println("Error unmarshel keys")
-			return nil, errors.New("Error unmarshalling paper keys ")
-		}
-
-		fmt.Println("Appending the new key to Paper Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == quotePrefix+quote.QuoteNo {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, quotePrefix+quote.QuoteNo)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling keys")
-				return nil, errors.New("Error marshalling the keys")
-			}
-			fmt.Println("Put state on QuoteKeys")
-			err = stub.PutState("QuoteKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting keys back")
-				return nil, errors.New("Error writing the keys back")
-			}
+			fmt.Println("Error issuing paper")
+			return nil, storageError(entityQuote, quote.QuoteNo, "writing")
 		}
 
+		recordEvent(stub, entityQuote, actionCreated, quotePrefix+quote.QuoteNo, "", quote.Status)
 		fmt.Println("Issue commercial paper %+v\n", quote)
 		return nil, nil
 	} else {
@@ -651,10 +898,25 @@ func (t *SimpleChaincode) issueQuote(stub shim.ChaincodeStubInterface, args []st
 		err = json.Unmarshal(cpRxBytes, &quoterx)
 		if err != nil {
 			fmt.Println("Error unmarshalling cp " + quote.QuoteNo)
-			return nil, errors.New("Error unmarshalling cp " + quote.QuoteNo)
+			return nil, storageError(entityQuote, quote.QuoteNo, "unmarshalling")
 		}
 
-		quoterx.Qty = quoterx.Qty + quote.Qty
+		// Qty is held as a string, so add the numbers rather than the text
+		existingQty, err := strconv.Atoi(quoterx.Qty)
+		if err != nil {
+			fmt.Println("Error parsing qty of quote " + quote.QuoteNo)
+			return nil, invalidField(entityQuote, quote.QuoteNo, "qty", "Quote "+quote.QuoteNo+" has a qty that is not a whole number: "+quoterx.Qty)
+		}
+		addedQty, err := strconv.Atoi(quote.Qty)
+		if err != nil {
+			fmt.Println("Error parsing qty " + quote.Qty)
+			return nil, invalidField(entityQuote, quote.QuoteNo, "qty", "The qty to add to quote "+quote.QuoteNo+" is not a whole number: "+quote.Qty)
+		}
+		quoterx.Qty = strconv.Itoa(existingQty + addedQty)
+		quoterx.ModifiedOn, err = stampTime(stub, entityQuote, quote.QuoteNo, "modifiedon", quote.ModifiedOn)
+		if err != nil {
+			return nil, err
+		}
 
 		
 
@@ -662,14 +924,15 @@ func (t *SimpleChaincode) issueQuote(stub shim.ChaincodeStubInterface, args []st
 		cpWriteBytes, err := json.Marshal(&quoterx)
 		if err != nil {
 			fmt.Println("Error marshalling cp")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityQuote, quote.QuoteNo, "marshalling")
 		}
-		err = stub.PutState(quotePrefix+quote.QuoteNo, cpWriteBytes)
+		err = putState(stub, quotePrefix+quote.QuoteNo, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error issuing paper")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityQuote, quote.QuoteNo, "writing")
 		}
 
+		recordEvent(stub, entityQuote, actionUpdated, quotePrefix+quote.QuoteNo, quoterx.Status, quoterx.Status)
 		fmt.Println("Updated commercial paper %+v\n", quoterx)
 		return nil, nil
 		
@@ -689,7 +952,7 @@ func (t *SimpleChaincode) ChangeStatusQuote(stub shim.ChaincodeStubInterface, ar
 
                                 fmt.Println("error invalid arguments")
 
-                                return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+                                return nil, badArguments("ChangeStatusQuote", "quote number, status and price")
 
                 }
 
@@ -733,7 +996,7 @@ func (t *SimpleChaincode) ChangeStatusQuote(stub shim.ChaincodeStubInterface, ar
 
                                                 fmt.Println("Error unmarshalling cp " + args[0])
 
-                                                return nil, errors.New("Error unmarshalling cp " + args[0])
+                                                return nil, storageError(entityQuote, args[0], "unmarshalling")
 
                                 }
 
@@ -743,9 +1006,27 @@ func (t *SimpleChaincode) ChangeStatusQuote(stub shim.ChaincodeStubInterface, ar
 
  
 
+                                oldStatus := quoterx.Status
+
                                 quoterx.Status = args[1]
 
-                                quoterx.Price = args[2]
+                                quoterx.Price, err = ParseMoney(args[2], jsonRoundingMode)
+
+                                if err != nil {
+
+                                                fmt.Println("Invalid price " + args[2])
+
+                                                return nil, invalidField(entityQuote, args[0], "price", "Invalid price "+args[2])
+
+                                }
+
+                                quoterx.ModifiedOn, err = stampTime(stub, entityQuote, args[0], "modifiedon", "")
+
+                                if err != nil {
+
+                                                return nil, err
+
+                                }
 
  
 
@@ -761,22 +1042,24 @@ func (t *SimpleChaincode) ChangeStatusQuote(stub shim.ChaincodeStubInterface, ar
 
                                                 fmt.Println("Error marshalling cp")
 
-                                                return nil, errors.New("Error issuing commercial paper")
+                                                return nil, storageError(entityQuote, args[0], "marshalling")
 
                                 }
 
-                                err = stub.PutState(quotePrefix+args[0], cpWriteBytes)
+                                err = putState(stub, quotePrefix+args[0], cpWriteBytes)
 
                                 if err != nil {
 
                                                 fmt.Println("Error issuing paper")
 
-                                                return nil, errors.New("Error issuing commercial paper")
+                                                return nil, storageError(entityQuote, args[0], "writing")
 
                                 }
 
  
 
+                                recordEvent(stub, entityQuote, actionStatusChanged, quotePrefix+args[0], oldStatus, quoterx.Status)
+
                                 fmt.Println("Updated commercial paper %+v\n", quoterx)
 
                                 return nil, nil
@@ -784,7 +1067,8 @@ func (t *SimpleChaincode) ChangeStatusQuote(stub shim.ChaincodeStubInterface, ar
                                
 
                 }
-                return nil, nil
+                fmt.Println("Quote " + args[0] + " does not exist")
+                return nil, notFound(entityQuote, args[0])
 }
 
 
@@ -793,32 +1077,21 @@ func GetAllQuotes(stub shim.ChaincodeStubInterface) ([]Quote, error) {
 
 	var allquote []Quote
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("QuoteKeys")
-	if err != nil {
-		fmt.Println("Error retrieving quote Keys ")
-		return nil, errors.New("Error retrieving quote Keys")
-	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
-	if err != nil {
-		fmt.Println("Error unmarshalling quote keys")
-		return nil, errors.New("Error unmarshalling quote keys")
-	}
-
-	// Get all the cps
-	for _, value := range keys {
-		cpBytes, err := stub.GetState(value)
-
+	// Get all the quotes
+	err := scanCollection(stub, collections["quote"], func(value string, cpBytes []byte) error {
 		var quote Quote
-		err = json.Unmarshal(cpBytes, &quote)
+		err := json.Unmarshal(cpBytes, &quote)
 		if err != nil {
 			fmt.Println("Error retrieving quote " + value)
-			return nil, errors.New("Error retrieving quote " + value)
+			return storageError(entityQuote, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending quote" + value)
 		allquote = append(allquote, quote)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allquote, nil
@@ -831,7 +1104,7 @@ func (t *SimpleChaincode) issueLetter_Credit(stub shim.ChaincodeStubInterface, a
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+		return nil, badArguments("issueLetter_Credit", "letter of credit record")
 	}
 
 	var lc Letter_Credit
@@ -842,7 +1115,7 @@ func (t *SimpleChaincode) issueLetter_Credit(stub shim.ChaincodeStubInterface, a
 	err = json.Unmarshal([]byte(args[0]), &lc)
 	if err != nil {
 		fmt.Println("error invalid lc issue" + args[0])
-		return nil, errors.New("Invalid lc issue" + args[0])
+		return nil, invalidRecord(entityLetterCredit, err)
 	}
 
 	
@@ -854,55 +1127,26 @@ func (t *SimpleChaincode) issueLetter_Credit(stub shim.ChaincodeStubInterface, a
 	cpRxBytes, err := stub.GetState(letter_creditPrefix + lc.LcNo)
 	if cpRxBytes == nil {
 		fmt.Println("lcNo does not exist, creating it")
-		cpBytes, err := json.Marshal(&lc)
+		lc.Status, err = lcStatuses.start(lc.Status)
 		if err != nil {
-			fmt.Println("Error marshalling lc")
-			return nil, errors.New("Error issuing lc")
+			return nil, err
 		}
-		err = stub.PutState(letter_creditPrefix + lc.LcNo, cpBytes)
+		lc.ModifiedOn, err = stampTime(stub, entityLetterCredit, lc.LcNo, "modifiedon", lc.ModifiedOn)
 		if err != nil {
-			fmt.Println("Error issuing lc")
-			return nil, errors.New("Error issuing lc")
+			return nil, err
 		}
-
-		
-
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting lc Keys")
-		keysBytes, err := stub.GetState("letter_creditKeys")
+		cpBytes, err := json.Marshal(&lc)
 		if err != nil {
-			fmt.Println("Error retrieving LcNo")
-			return nil, errors.New("Error retrieving lcNo")
+			fmt.Println("Error marshalling lc")
+			return nil, storageError(entityLetterCredit, lc.LcNo, "marshalling")
 		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
+		err = putState(stub, letter_creditPrefix + lc.LcNo, cpBytes)
 		if err != nil {
-			fmt.Println("Error unmarshel lcNo")
-			return nil, errors.New("Error unmarshalling lcNo ")
-		}
-
-		fmt.Println("Appending the new key to lcNo Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == letter_creditPrefix+lc.LcNo {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, letter_creditPrefix+lc.LcNo)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling lcNo")
-				return nil, errors.New("Error marshalling the lcNo")
-			}
-			fmt.Println("Put state on lcNo")
-			err = stub.PutState("letter_creditKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting lcNo back")
-				return nil, errors.New("Error writing the lcNo back")
-			}
+			fmt.Println("Error issuing lc")
+			return nil, storageError(entityLetterCredit, lc.LcNo, "writing")
 		}
 
+		recordEvent(stub, entityLetterCredit, actionCreated, letter_creditPrefix+lc.LcNo, "", lc.Status)
 		fmt.Println("Issue commercial paper %+v\n", lc)
 		return nil, nil
 	} else {
@@ -913,25 +1157,38 @@ func (t *SimpleChaincode) issueLetter_Credit(stub shim.ChaincodeStubInterface, a
 		err = json.Unmarshal(cpRxBytes, &lcrx)
 		if err != nil {
 			fmt.Println("Error unmarshalling lc " + lc.LcNo)
-			return nil, errors.New("Error unmarshalling lc " + lc.LcNo)
+			return nil, storageError(entityLetterCredit, lc.LcNo, "unmarshalling")
 		}
 
 		//quoterx.Qty = quoterx.Qty + quote.Qty
 
+		oldStatus := lcStatuses.current(lcrx.Status)
+		if lc.Status == "" {
+			lc.Status = oldStatus
+		}
+		err = lcStatuses.move(oldStatus, lc.Status)
+		if err != nil {
+			return nil, err
+		}
+		lc.ModifiedOn, err = stampTime(stub, entityLetterCredit, lc.LcNo, "modifiedon", lc.ModifiedOn)
+		if err != nil {
+			return nil, err
+		}
 		lcrx = lc
 
 
 		cpWriteBytes, err := json.Marshal(&lcrx)
 		if err != nil {
 			fmt.Println("Error marshalling lc")
-			return nil, errors.New("Error issuing lc")
+			return nil, storageError(entityLetterCredit, lc.LcNo, "marshalling")
 		}
-		err = stub.PutState(letter_creditPrefix+lc.LcNo, cpWriteBytes)
+		err = putState(stub, letter_creditPrefix+lc.LcNo, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error lc")
-			return nil, errors.New("Error issuing lc")
+			return nil, storageError(entityLetterCredit, lc.LcNo, "writing")
 		}
 
+		recordEvent(stub, entityLetterCredit, actionUpdated, letter_creditPrefix+lc.LcNo, oldStatus, lcrx.Status)
 		fmt.Println("Updated commercial paper %+v\n", lcrx)
 		return nil, nil
 	}
@@ -939,81 +1196,57 @@ func (t *SimpleChaincode) issueLetter_Credit(stub shim.ChaincodeStubInterface, a
 
 //ChangeStatusLC
 func (t *SimpleChaincode) ChangeStatusLC(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//  0            1
+	// "lcNo" "status"
+	if len(args) != 2 {
+		fmt.Println("error invalid arguments")
+		return nil, badArguments("ChangeStatusLC", "letter of credit number and status")
+	}
 
-   //need one arg
-      if len(args) < 3 {
-		 fmt.Println("error invalid arguments")
-			return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+	fmt.Println("Getting State on lc " + args[0])
+	lcBytes, err := stub.GetState(letter_creditPrefix + args[0])
+	if err != nil {
+		fmt.Println("Error retrieving lc " + args[0])
+		return nil, storageError(entityLetterCredit, args[0], "retrieving")
+	}
+	if lcBytes == nil {
+		fmt.Println("lc " + args[0] + " does not exist")
+		return nil, notFound(entityLetterCredit, args[0])
+	}
 
-                }
+	var lc Letter_Credit
+	fmt.Println("Unmarshalling lc " + args[0])
+	err = json.Unmarshal(lcBytes, &lc)
+	if err != nil {
+		fmt.Println("Error unmarshalling lc " + args[0])
+		return nil, storageError(entityLetterCredit, args[0], "unmarshalling")
+	}
 
- 				 var quote Quote
+	oldStatus := lcStatuses.current(lc.Status)
+	err = lcStatuses.move(oldStatus, args[1])
+	if err != nil {
+		return nil, err
+	}
+	lc.Status = args[1]
+	lc.ModifiedOn, err = stampTime(stub, entityLetterCredit, lc.LcNo, "modifiedon", "")
+	if err != nil {
+		return nil, err
+	}
 
-                var err error
-
-                var account Account
-
-                fmt.Println("Marshalling Quote bytes")
-
-                quote.QuoteNo = account.Prefix + args[0]
-
- 
-
-                fmt.Println("Getting State on CP " + args[0])
-
-                cpRxBytes, err := stub.GetState(quotePrefix + args[0])
-
-                if cpRxBytes != nil {
-
-                    fmt.Println("QuoteNo exists")
-
-                    var quoterx Quote
-
-                    fmt.Println("Unmarshalling CP " + args[0])
-
-                    err = json.Unmarshal(cpRxBytes, &quoterx)
-
-                    if err != nil {
-
-                        fmt.Println("Error unmarshalling cp " + args[0])
-
-                        return nil, errors.New("Error unmarshalling cp " + args[0])
-
-                            }
-
-                            quoterx.Status = args[1]
-
-                             
-                            cpWriteBytes, err := json.Marshal(&quoterx)
-
-                            if err != nil {
-
-                                fmt.Println("Error marshalling cp")
-
-                                return nil, errors.New("Error issuing commercial paper")
-
-                                }
-
-                            err = stub.PutState(quotePrefix+args[0], cpWriteBytes)
-
-                                if err != nil {
-
-                                fmt.Println("Error issuing paper")
-
-                                return nil, errors.New("Error issuing commercial paper")
-
-                                }
-
- 
-
-                                fmt.Println("Updated commercial paper %+v\n", quoterx)
-
-                                return nil, nil
-
-                               
+	lcBytes, err = json.Marshal(&lc)
+	if err != nil {
+		fmt.Println("Error marshalling lc")
+		return nil, storageError(entityLetterCredit, args[0], "marshalling")
+	}
+	err = putState(stub, letter_creditPrefix+args[0], lcBytes)
+	if err != nil {
+		fmt.Println("Error updating lc")
+		return nil, storageError(entityLetterCredit, args[0], "writing")
+	}
 
-                }
-                return nil, nil
+	recordEvent(stub, entityLetterCredit, actionStatusChanged, letter_creditPrefix+args[0], oldStatus, lc.Status)
+	fmt.Println("Updated lc " + args[0] + " from " + oldStatus + " to " + lc.Status)
+	return nil, nil
 }
 
 
@@ -1021,32 +1254,21 @@ func GetAllLcs(stub shim.ChaincodeStubInterface) ([]Letter_Credit, error) {
 
 	var allLc []Letter_Credit
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("letter_creditKeys")
-	if err != nil {
-		fmt.Println("Error retrieving LC Keys ")
-		return nil, errors.New("Error retrieving LC Keys")
-	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
-	if err != nil {
-		fmt.Println("Error unmarshalling LC keys")
-		return nil, errors.New("Error unmarshalling LC keys")
-	}
-
-	// Get all the cps
-	for _, value := range keys {
-		lcBytes, err := stub.GetState(value)
-
+	// Get all the LCs
+	err := scanCollection(stub, collections["lc"], func(value string, lcBytes []byte) error {
 		var lc Letter_Credit
-		err = json.Unmarshal(lcBytes, &lc)
+		err := json.Unmarshal(lcBytes, &lc)
 		if err != nil {
 			fmt.Println("Error retrieving LC " + value)
-			return nil, errors.New("Error retrieving LC " + value)
+			return storageError(entityLetterCredit, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending lc" + value)
 		allLc = append(allLc, lc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allLc, nil
@@ -1061,7 +1283,7 @@ func (t *SimpleChaincode) issuePurchaseOrder(stub shim.ChaincodeStubInterface, a
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+		return nil, badArguments("issuePurchaseOrder", "purchase order record")
 	}
 
 	var po PurchaseOrder
@@ -1072,7 +1294,7 @@ func (t *SimpleChaincode) issuePurchaseOrder(stub shim.ChaincodeStubInterface, a
 	err = json.Unmarshal([]byte(args[0]), &po)
 	if err != nil {
 		fmt.Println("error invalid po issue" + args[0])
-		return nil, errors.New("Invalid po issue" + args[0])
+		return nil, invalidRecord(entityPurchaseOrder, err)
 	}
 
 	
@@ -1084,55 +1306,22 @@ func (t *SimpleChaincode) issuePurchaseOrder(stub shim.ChaincodeStubInterface, a
 	cpRxBytes, err := stub.GetState(purchase_orderPrefix + po.PONo)
 	if cpRxBytes == nil {
 		fmt.Println("PONo does not exist, creating it")
+		po.Status, err = poStatuses.start(po.Status)
+		if err != nil {
+			return nil, err
+		}
 		cpBytes, err := json.Marshal(&po)
 		if err != nil {
 			fmt.Println("Error marshalling po")
-			return nil, errors.New("Error issuing po")
+			return nil, storageError(entityPurchaseOrder, po.PONo, "marshalling")
 		}
-		err = stub.PutState(purchase_orderPrefix + po.PONo, cpBytes)
+		err = putState(stub, purchase_orderPrefix + po.PONo, cpBytes)
 		if err != nil {
 			fmt.Println("Error issuing paper")
-			return nil, errors.New("Error issuing po")
-		}
-
-		
-
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting Paper Keys")
-		keysBytes, err := stub.GetState("PurchaseOrderKeys")
-		if err != nil {
-			fmt.Println("Error retrieving paper keys")
-			return nil, errors.New("Error retrieving paper keys")
-		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
-		if err != nil {
-			fmt.Println("Error unmarshel keys")
-			return nil, errors.New("Error unmarshalling paper keys ")
-		}
-
-		fmt.Println("Appending the new key to Paper Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == purchase_orderPrefix+po.PONo {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, purchase_orderPrefix+po.PONo)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling PONo")
-				return nil, errors.New("Error marshalling the PONo")
-			}
-			fmt.Println("Put state on PONo")
-			err = stub.PutState("PurchaseOrderKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting PONo back")
-				return nil, errors.New("Error writing the PONo back")
-			}
+			return nil, storageError(entityPurchaseOrder, po.PONo, "writing")
 		}
 
+		recordEvent(stub, entityPurchaseOrder, actionCreated, purchase_orderPrefix+po.PONo, "", po.Status)
 		fmt.Println("Issue commercial paper %+v\n", po)
 		return nil, nil
 	} else {
@@ -1143,25 +1332,34 @@ func (t *SimpleChaincode) issuePurchaseOrder(stub shim.ChaincodeStubInterface, a
 		err = json.Unmarshal(cpRxBytes, &porx)
 		if err != nil {
 			fmt.Println("Error unmarshalling po " + po.PONo)
-			return nil, errors.New("Error unmarshalling po " + po.PONo)
+			return nil, storageError(entityPurchaseOrder, po.PONo, "unmarshalling")
 		}
 
 		//quoterx.Qty = quoterx.Qty + quote.Qty
 
+		oldStatus := poStatuses.current(porx.Status)
+		if po.Status == "" {
+			po.Status = oldStatus
+		}
+		err = poStatuses.move(oldStatus, po.Status)
+		if err != nil {
+			return nil, err
+		}
 		porx = po
 
 
 		cpWriteBytes, err := json.Marshal(&porx)
 		if err != nil {
 			fmt.Println("Error marshalling po")
-			return nil, errors.New("Error issuing po")
+			return nil, storageError(entityPurchaseOrder, po.PONo, "marshalling")
 		}
-		err = stub.PutState(purchase_orderPrefix+po.PONo, cpWriteBytes)
+		err = putState(stub, purchase_orderPrefix+po.PONo, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error po")
-			return nil, errors.New("Error issuing po")
+			return nil, storageError(entityPurchaseOrder, po.PONo, "writing")
 		}
 
+		recordEvent(stub, entityPurchaseOrder, actionUpdated, purchase_orderPrefix+po.PONo, oldStatus, porx.Status)
 		fmt.Println("Updated commercial paper %+v\n", porx)
 		return nil, nil
 	}
@@ -1169,112 +1367,73 @@ func (t *SimpleChaincode) issuePurchaseOrder(stub shim.ChaincodeStubInterface, a
 
 //ChangeStatusPO
 func (t *SimpleChaincode) ChangeStatusPO(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//  0            1
+	// "poNo" "status"
+	if len(args) != 2 {
+		fmt.Println("error invalid arguments")
+		return nil, badArguments("ChangeStatusPO", "purchase order number and status")
+	}
 
-   //need one arg
-      if len(args) < 3 {
-		 fmt.Println("error invalid arguments")
-			return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
-
-                }
-
- 				 var quote Quote
-
-                var err error
-
-                var account Account
-
-                fmt.Println("Marshalling Quote bytes")
-
-                quote.QuoteNo = account.Prefix + args[0]
-
- 
-
-                fmt.Println("Getting State on CP " + args[0])
-
-                cpRxBytes, err := stub.GetState(quotePrefix + args[0])
-
-                if cpRxBytes != nil {
-
-                    fmt.Println("QuoteNo exists")
-
-                    var quoterx Quote
-
-                    fmt.Println("Unmarshalling CP " + args[0])
-
-                    err = json.Unmarshal(cpRxBytes, &quoterx)
-
-                    if err != nil {
-
-                        fmt.Println("Error unmarshalling cp " + args[0])
-
-                        return nil, errors.New("Error unmarshalling cp " + args[0])
-
-                            }
-
-                            quoterx.Status = args[1]
-
-                             
-                            cpWriteBytes, err := json.Marshal(&quoterx)
-
-                            if err != nil {
-
-                                fmt.Println("Error marshalling cp")
-
-                                return nil, errors.New("Error issuing commercial paper")
-
-                                }
-
-                            err = stub.PutState(quotePrefix+args[0], cpWriteBytes)
-
-                                if err != nil {
-
-                                fmt.Println("Error issuing paper")
-
-                                return nil, errors.New("Error issuing commercial paper")
-
-                                }
-
- 
-
-                                fmt.Println("Updated commercial paper %+v\n", quoterx)
-
-                                return nil, nil
-
-                               
+	fmt.Println("Getting State on po " + args[0])
+	poBytes, err := stub.GetState(purchase_orderPrefix + args[0])
+	if err != nil {
+		fmt.Println("Error retrieving po " + args[0])
+		return nil, storageError(entityPurchaseOrder, args[0], "retrieving")
+	}
+	if poBytes == nil {
+		fmt.Println("po " + args[0] + " does not exist")
+		return nil, notFound(entityPurchaseOrder, args[0])
+	}
 
-                }
-                return nil, nil
-}
-func GetAllPo(stub shim.ChaincodeStubInterface) ([]PurchaseOrder, error) {
+	var po PurchaseOrder
+	fmt.Println("Unmarshalling po " + args[0])
+	err = json.Unmarshal(poBytes, &po)
+	if err != nil {
+		fmt.Println("Error unmarshalling po " + args[0])
+		return nil, storageError(entityPurchaseOrder, args[0], "unmarshalling")
+	}
 
-	var allPo []PurchaseOrder
+	oldStatus := poStatuses.current(po.Status)
+	err = poStatuses.move(oldStatus, args[1])
+	if err != nil {
+		return nil, err
+	}
+	po.Status = args[1]
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("PurchaseOrderKeys")
+	poBytes, err = json.Marshal(&po)
 	if err != nil {
-		fmt.Println("Error retrieving po Keys ")
-		return nil, errors.New("Error retrieving po Keys")
+		fmt.Println("Error marshalling po")
+		return nil, storageError(entityPurchaseOrder, args[0], "marshalling")
 	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
+	err = putState(stub, purchase_orderPrefix+args[0], poBytes)
 	if err != nil {
-		fmt.Println("Error unmarshalling po keys")
-		return nil, errors.New("Error unmarshalling po keys")
+		fmt.Println("Error updating po")
+		return nil, storageError(entityPurchaseOrder, args[0], "writing")
 	}
 
-	// Get all the cps
-	for _, value := range keys {
-		poBytes, err := stub.GetState(value)
+	recordEvent(stub, entityPurchaseOrder, actionStatusChanged, purchase_orderPrefix+args[0], oldStatus, po.Status)
+	fmt.Println("Updated po " + args[0] + " from " + oldStatus + " to " + po.Status)
+	return nil, nil
+}
+func GetAllPo(stub shim.ChaincodeStubInterface) ([]PurchaseOrder, error) {
 
+	var allPo []PurchaseOrder
+
+	// Get all the POs
+	err := scanCollection(stub, collections["po"], func(value string, poBytes []byte) error {
 		var po PurchaseOrder
-		err = json.Unmarshal(poBytes, &po)
+		err := json.Unmarshal(poBytes, &po)
 		if err != nil {
 			fmt.Println("Error retrieving po " + value)
-			return nil, errors.New("Error retrieving po " + value)
+			return storageError(entityPurchaseOrder, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending po" + value)
 		allPo = append(allPo,po)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allPo, nil
@@ -1286,7 +1445,7 @@ func (t *SimpleChaincode) issueBill_Lading(stub shim.ChaincodeStubInterface, arg
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+		return nil, badArguments("issueBill_Lading", "bill of lading record")
 	}
 
 	var bl Bill_Lading
@@ -1297,7 +1456,7 @@ func (t *SimpleChaincode) issueBill_Lading(stub shim.ChaincodeStubInterface, arg
 	err = json.Unmarshal([]byte(args[0]), &bl)
 	if err != nil {
 		fmt.Println("error invalid bl issue" + args[0])
-		return nil, errors.New("Invalid bl issue" + args[0])
+		return nil, invalidRecord(entityBillLading, err)
 	}
 
 	
@@ -1309,55 +1468,22 @@ func (t *SimpleChaincode) issueBill_Lading(stub shim.ChaincodeStubInterface, arg
 	cpRxBytes, err := stub.GetState(bill_ladingPrefix + bl.BlNo)
 	if cpRxBytes == nil {
 		fmt.Println("BlNo does not exist, creating it")
+		bl.Status, err = blStatuses.start(bl.Status)
+		if err != nil {
+			return nil, err
+		}
 		cpBytes, err := json.Marshal(&bl)
 		if err != nil {
 			fmt.Println("Error marshalling bl")
-			return nil, errors.New("Error issuing bl")
+			return nil, storageError(entityBillLading, bl.BlNo, "marshalling")
 		}
-		err = stub.PutState(bill_ladingPrefix + bl.BlNo, cpBytes)
+		err = putState(stub, bill_ladingPrefix + bl.BlNo, cpBytes)
 		if err != nil {
 			fmt.Println("Error issuing bl")
-			return nil, errors.New("Error issuing bl")
-		}
-
-		
-
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting bl Keys")
-		keysBytes, err := stub.GetState("Bill_LadingKeys")
-		if err != nil {
-			fmt.Println("Error retrieving BlNo")
-			return nil, errors.New("Error retrieving BlNo")
-		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
-		if err != nil {
-			fmt.Println("Error unmarshel BlNo")
-			return nil, errors.New("Error unmarshalling BlNo ")
-		}
-
-		fmt.Println("Appending the new key to BlNo Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == bill_ladingPrefix+bl.BlNo {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, bill_ladingPrefix+bl.BlNo)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling BlNo")
-				return nil, errors.New("Error marshalling the BlNo")
-			}
-			fmt.Println("Put state on BlNo")
-			err = stub.PutState("Bill_LadingKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting BlNo back")
-				return nil, errors.New("Error writing the BlNo back")
-			}
+			return nil, storageError(entityBillLading, bl.BlNo, "writing")
 		}
 
+		recordEvent(stub, entityBillLading, actionCreated, bill_ladingPrefix+bl.BlNo, "", bl.Status)
 		fmt.Println("Issue commercial paper %+v\n", bl)
 		return nil, nil
 	} else {
@@ -1368,25 +1494,34 @@ func (t *SimpleChaincode) issueBill_Lading(stub shim.ChaincodeStubInterface, arg
 		err = json.Unmarshal(cpRxBytes, &blrx)
 		if err != nil {
 			fmt.Println("Error unmarshalling bl " + bl.BlNo)
-			return nil, errors.New("Error unmarshalling bl " + bl.BlNo)
+			return nil, storageError(entityBillLading, bl.BlNo, "unmarshalling")
 		}
 
 		//quoterx.Qty = quoterx.Qty + quote.Qty
 
+		oldStatus := blStatuses.current(blrx.Status)
+		if bl.Status == "" {
+			bl.Status = oldStatus
+		}
+		err = blStatuses.move(oldStatus, bl.Status)
+		if err != nil {
+			return nil, err
+		}
 		blrx = bl
 
 
 		cpWriteBytes, err := json.Marshal(&blrx)
 		if err != nil {
 			fmt.Println("Error marshalling bl")
-			return nil, errors.New("Error issuing bl")
+			return nil, storageError(entityBillLading, bl.BlNo, "marshalling")
 		}
-		err = stub.PutState(bill_ladingPrefix+bl.BlNo, cpWriteBytes)
+		err = putState(stub, bill_ladingPrefix+bl.BlNo, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error bl")
-			return nil, errors.New("Error issuing bl")
+			return nil, storageError(entityBillLading, bl.BlNo, "writing")
 		}
 
+		recordEvent(stub, entityBillLading, actionUpdated, bill_ladingPrefix+bl.BlNo, oldStatus, blrx.Status)
 		fmt.Println("Updated commercial paper %+v\n", blrx)
 		return nil, nil
 	}
@@ -1394,112 +1529,73 @@ func (t *SimpleChaincode) issueBill_Lading(stub shim.ChaincodeStubInterface, arg
 
 //ChangeStatusBL
 func (t *SimpleChaincode) ChangeStatusBL(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//  0            1
+	// "blNo" "status"
+	if len(args) != 2 {
+		fmt.Println("error invalid arguments")
+		return nil, badArguments("ChangeStatusBL", "bill of lading number and status")
+	}
 
-   //need one arg
-      if len(args) < 3 {
-		 fmt.Println("error invalid arguments")
-			return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
-
-                }
-
- 				 var quote Quote
-
-                var err error
-
-                var account Account
-
-                fmt.Println("Marshalling Quote bytes")
-
-                quote.QuoteNo = account.Prefix + args[0]
-
- 
-
-                fmt.Println("Getting State on CP " + args[0])
-
-                cpRxBytes, err := stub.GetState(quotePrefix + args[0])
-
-                if cpRxBytes != nil {
-
-                    fmt.Println("QuoteNo exists")
-
-                    var quoterx Quote
-
-                    fmt.Println("Unmarshalling CP " + args[0])
-
-                    err = json.Unmarshal(cpRxBytes, &quoterx)
-
-                    if err != nil {
-
-                        fmt.Println("Error unmarshalling cp " + args[0])
-
-                        return nil, errors.New("Error unmarshalling cp " + args[0])
-
-                            }
-
-                            quoterx.Status = args[1]
-
-                             
-                            cpWriteBytes, err := json.Marshal(&quoterx)
-
-                            if err != nil {
-
-                                fmt.Println("Error marshalling cp")
-
-                                return nil, errors.New("Error issuing commercial paper")
-
-                                }
-
-                            err = stub.PutState(quotePrefix+args[0], cpWriteBytes)
-
-                                if err != nil {
-
-                                fmt.Println("Error issuing paper")
-
-                                return nil, errors.New("Error issuing commercial paper")
-
-                                }
-
- 
-
-                                fmt.Println("Updated commercial paper %+v\n", quoterx)
-
-                                return nil, nil
-
-                               
+	fmt.Println("Getting State on bl " + args[0])
+	blBytes, err := stub.GetState(bill_ladingPrefix + args[0])
+	if err != nil {
+		fmt.Println("Error retrieving bl " + args[0])
+		return nil, storageError(entityBillLading, args[0], "retrieving")
+	}
+	if blBytes == nil {
+		fmt.Println("bl " + args[0] + " does not exist")
+		return nil, notFound(entityBillLading, args[0])
+	}
 
-                }
-                return nil, nil
-}
-func GetAllBl(stub shim.ChaincodeStubInterface) ([]Bill_Lading, error) {
+	var bl Bill_Lading
+	fmt.Println("Unmarshalling bl " + args[0])
+	err = json.Unmarshal(blBytes, &bl)
+	if err != nil {
+		fmt.Println("Error unmarshalling bl " + args[0])
+		return nil, storageError(entityBillLading, args[0], "unmarshalling")
+	}
 
-	var allBl []Bill_Lading
+	oldStatus := blStatuses.current(bl.Status)
+	err = blStatuses.move(oldStatus, args[1])
+	if err != nil {
+		return nil, err
+	}
+	bl.Status = args[1]
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("Bill_LadingKeys")
+	blBytes, err = json.Marshal(&bl)
 	if err != nil {
-		fmt.Println("Error retrieving bl Keys ")
-		return nil, errors.New("Error retrieving bl Keys")
+		fmt.Println("Error marshalling bl")
+		return nil, storageError(entityBillLading, args[0], "marshalling")
 	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
+	err = putState(stub, bill_ladingPrefix+args[0], blBytes)
 	if err != nil {
-		fmt.Println("Error unmarshalling bl keys")
-		return nil, errors.New("Error unmarshalling bl keys")
+		fmt.Println("Error updating bl")
+		return nil, storageError(entityBillLading, args[0], "writing")
 	}
 
-	// Get all the cps
-	for _, value := range keys {
-		blBytes, err := stub.GetState(value)
+	recordEvent(stub, entityBillLading, actionStatusChanged, bill_ladingPrefix+args[0], oldStatus, bl.Status)
+	fmt.Println("Updated bl " + args[0] + " from " + oldStatus + " to " + bl.Status)
+	return nil, nil
+}
+func GetAllBl(stub shim.ChaincodeStubInterface) ([]Bill_Lading, error) {
 
+	var allBl []Bill_Lading
+
+	// Get all the BLs
+	err := scanCollection(stub, collections["bl"], func(value string, blBytes []byte) error {
 		var bl Bill_Lading
-		err = json.Unmarshal(blBytes, &bl)
+		err := json.Unmarshal(blBytes, &bl)
 		if err != nil {
 			fmt.Println("Error retrieving bl " + value)
-			return nil, errors.New("Error retrieving bl " + value)
+			return storageError(entityBillLading, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending bl" + value)
 		allBl= append(allBl,bl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allBl, nil
@@ -1515,7 +1611,7 @@ func (t *SimpleChaincode) addNotification(stub shim.ChaincodeStubInterface, args
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+		return nil, badArguments("addNotification", "notification record")
 	}
 
 	var notification Notification
@@ -1526,7 +1622,7 @@ func (t *SimpleChaincode) addNotification(stub shim.ChaincodeStubInterface, args
 	err = json.Unmarshal([]byte(args[0]), &notification)
 	if err != nil {
 		fmt.Println("error invalid notification issue" + args[0])
-		return nil, errors.New("Invalid notification issue" + args[0])
+		return nil, invalidRecord(entityNotification, err)
 	}
 
 	
@@ -1541,63 +1637,26 @@ func (t *SimpleChaincode) addNotification(stub shim.ChaincodeStubInterface, args
 		cpBytes, err := json.Marshal(&notification)
 		if err != nil {
 			fmt.Println("Error marshalling notification")
-			return nil, errors.New("Error issuing notification")
+			return nil, storageError(entityNotification, notification.NotificationId, "marshalling")
 		}
-		err = stub.PutState(notificationPrefix+notification.NotificationId, cpBytes)
+		err = putState(stub, notificationPrefix+notification.NotificationId, cpBytes)
 		if err != nil {
 			fmt.Println("Error issuing paper")
-			return nil, errors.New("Error issuing notification")
+			return nil, storageError(entityNotification, notification.NotificationId, "writing")
 		}
 
-		
+		recordEvent(stub, entityNotification, actionCreated, notificationPrefix+notification.NotificationId, "", "")
+		fmt.Println("Issue commercial paper %+v\n", notification)
+		return nil, nil
+	} else {
+		fmt.Println("QuoteNo exists")
 
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting Paper Keys")
-		keysBytes, err := stub.GetState("NotificationKeys")
-		if err != nil {
-			fmt.Println("Error retrieving paper keys")
-			return nil, errors.New("Error retrieving paper keys")
-		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
+		var notificationrx Notification
+		fmt.Println("Unmarshalling CP " + notification.NotificationId)
+		err = json.Unmarshal(cpRxBytes, &notificationrx)
 		if err != nil {
-			fmt.Println("Error unmarshel keys")
-			return nil, errors.New("Error unmarshalling paper keys ")
-		}
-
-		fmt.Println("Appending the new key to Paper Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == notificationPrefix+notification.NotificationId {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, notificationPrefix+notification.NotificationId)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling keys")
-				return nil, errors.New("Error marshalling the keys")
-			}
-			fmt.Println("Put state on NotificationKeys")
-			err = stub.PutState("NotificationKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting keys back")
-				return nil, errors.New("Error writing the keys back")
-			}
-		}
-
-		fmt.Println("Issue commercial paper %+v\n", notification)
-		return nil, nil
-	} else {
-		fmt.Println("QuoteNo exists")
-
-		var notificationrx Notification
-		fmt.Println("Unmarshalling CP " + notification.NotificationId)
-		err = json.Unmarshal(cpRxBytes, &notificationrx)
-		if err != nil {
-			fmt.Println("Error unmarshalling cp " + notification.NotificationId)
-			return nil, errors.New("Error unmarshalling cp " + notification.NotificationId)
+			fmt.Println("Error unmarshalling cp " + notification.NotificationId)
+			return nil, storageError(entityNotification, notification.NotificationId, "unmarshalling")
 		}
 
 		//quoterx.Qty = quoterx.Qty + quote.Qty
@@ -1607,14 +1666,15 @@ func (t *SimpleChaincode) addNotification(stub shim.ChaincodeStubInterface, args
 		cpWriteBytes, err := json.Marshal(&notificationrx)
 		if err != nil {
 			fmt.Println("Error marshalling cp")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityNotification, notification.NotificationId, "marshalling")
 		}
-		err = stub.PutState(notificationPrefix+notification.NotificationId, cpWriteBytes)
+		err = putState(stub, notificationPrefix+notification.NotificationId, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error issuing paper")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityNotification, notification.NotificationId, "writing")
 		}
 
+		recordEvent(stub, entityNotification, actionUpdated, notificationPrefix+notification.NotificationId, "", "")
 		fmt.Println("Updated commercial paper %+v\n", notificationrx)
 		return nil, nil
 	}
@@ -1624,32 +1684,21 @@ func GetAllNotifications(stub shim.ChaincodeStubInterface) ([]Notification, erro
 
 	var allNotification []Notification
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("NotificationKeys")
-	if err != nil {
-		fmt.Println("Error retrieving Notification keys")
-		return nil, errors.New("Error retrieving Notification keys")
-	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
-	if err != nil {
-		fmt.Println("Error unmarshalling Notification keys")
-		return nil, errors.New("Error unmarshalling Notification keys")
-	}
-
-	// Get all the cps
-	for _, value := range keys {
-		cpBytes, err := stub.GetState(value)
-
+	// Get all the notifications
+	err := scanCollection(stub, collections["notification"], func(value string, cpBytes []byte) error {
 		var notification Notification
-		err = json.Unmarshal(cpBytes, &notification)
+		err := json.Unmarshal(cpBytes, &notification)
 		if err != nil {
 			fmt.Println("Error retrieving cp " + value)
-			return nil, errors.New("Error retrieving cp " + value)
+			return storageError(entityNotification, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending CP" + value)
 		allNotification = append(allNotification, notification)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allNotification, nil
@@ -1663,7 +1712,7 @@ func (t *SimpleChaincode) addProperty(stub shim.ChaincodeStubInterface, args []s
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+		return nil, badArguments("addProperty", "property record")
 	}
 
 	var property Property
@@ -1674,7 +1723,7 @@ func (t *SimpleChaincode) addProperty(stub shim.ChaincodeStubInterface, args []s
 	err = json.Unmarshal([]byte(args[0]), &property)
 	if err != nil {
 		fmt.Println("error invalid Property issue" + args[0])
-		return nil, errors.New("Invalid Property issue" + args[0])
+		return nil, invalidRecord(entityProperty, err)
 	}
 
 	
@@ -1689,52 +1738,15 @@ func (t *SimpleChaincode) addProperty(stub shim.ChaincodeStubInterface, args []s
 		cpBytes, err := json.Marshal(&property)
 		if err != nil {
 			fmt.Println("Error marshalling property")
-			return nil, errors.New("Error issuing property")
+			return nil, storageError(entityProperty, property.PropId, "marshalling")
 		}
-		err = stub.PutState(propertyPrefix+property.PropId, cpBytes)
+		err = putState(stub, propertyPrefix+property.PropId, cpBytes)
 		if err != nil {
 			fmt.Println("Error issuing paper")
-			return nil, errors.New("Error issuing property")
-		}
-
-		
-
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting Paper Keys")
-		keysBytes, err := stub.GetState("PropertyKeys")
-		if err != nil {
-			fmt.Println("Error retrieving paper keys")
-			return nil, errors.New("Error retrieving paper keys")
-		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
-		if err != nil {
-			fmt.Println("Error unmarshel keys")
-			return nil, errors.New("Error unmarshalling paper keys ")
-		}
-
-		fmt.Println("Appending the new key to Paper Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == propertyPrefix+property.PropId {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, propertyPrefix+property.PropId)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling keys")
-				return nil, errors.New("Error marshalling the keys")
-			}
-			fmt.Println("Put state on PropertyKeys")
-			err = stub.PutState("PropertyKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting keys back")
-				return nil, errors.New("Error writing the keys back")
-			}
+			return nil, storageError(entityProperty, property.PropId, "writing")
 		}
 
+		recordEvent(stub, entityProperty, actionCreated, propertyPrefix+property.PropId, "", "")
 		fmt.Println("Issue commercial paper %+v\n", property)
 		return nil, nil
 	} else {
@@ -1745,24 +1757,29 @@ func (t *SimpleChaincode) addProperty(stub shim.ChaincodeStubInterface, args []s
 		err = json.Unmarshal(cpRxBytes, &propertyrx)
 		if err != nil {
 			fmt.Println("Error unmarshalling cp " + property.PropId)
-			return nil, errors.New("Error unmarshalling cp " + property.PropId)
+			return nil, storageError(entityProperty, property.PropId, "unmarshalling")
 		}
 
 		//quoterx.Qty = quoterx.Qty + quote.Qty
 
+		// Title only changes through registerDeed, so an update keeps the
+		// owner and history already on record
+		property.PropOwner = propertyrx.PropOwner
+		property.Histories = propertyrx.Histories
 		propertyrx = property
 
 		cpWriteBytes, err := json.Marshal(&propertyrx)
 		if err != nil {
 			fmt.Println("Error marshalling cp")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityProperty, property.PropId, "marshalling")
 		}
-		err = stub.PutState(propertyPrefix+property.PropId, cpWriteBytes)
+		err = putState(stub, propertyPrefix+property.PropId, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error issuing paper")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityProperty, property.PropId, "writing")
 		}
 
+		recordEvent(stub, entityProperty, actionUpdated, propertyPrefix+property.PropId, "", "")
 		fmt.Println("Updated commercial paper %+v\n", propertyrx)
 		return nil, nil
 	}
@@ -1772,32 +1789,21 @@ func GetAllProperties(stub shim.ChaincodeStubInterface) ([]Property, error) {
 
 	var allProperties []Property
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("PropertyKeys")
-	if err != nil {
-		fmt.Println("Error retrieving paper keys")
-		return nil, errors.New("Error retrieving paper keys")
-	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
-	if err != nil {
-		fmt.Println("Error unmarshalling paper keys")
-		return nil, errors.New("Error unmarshalling paper keys")
-	}
-
-	// Get all the cps
-	for _, value := range keys {
-		cpBytes, err := stub.GetState(value)
-
+	// Get all the properties
+	err := scanCollection(stub, collections["property"], func(value string, cpBytes []byte) error {
 		var property Property
-		err = json.Unmarshal(cpBytes, &property)
+		err := json.Unmarshal(cpBytes, &property)
 		if err != nil {
 			fmt.Println("Error retrieving cp " + value)
-			return nil, errors.New("Error retrieving cp " + value)
+			return storageError(entityProperty, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending CP" + value)
 		allProperties = append(allProperties, property)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allProperties, nil
@@ -1813,7 +1819,7 @@ func (t *SimpleChaincode) issueProposal(stub shim.ChaincodeStubInterface, args [
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+		return nil, badArguments("issueProposal", "proposal record")
 	}
 
 	var proposal Proposal
@@ -1824,7 +1830,7 @@ func (t *SimpleChaincode) issueProposal(stub shim.ChaincodeStubInterface, args [
 	err = json.Unmarshal([]byte(args[0]), &proposal)
 	if err != nil {
 		fmt.Println("error invalid proposal issue" + args[0])
-		return nil, errors.New("Invalid proposal issue" + args[0])
+		return nil, invalidRecord(entityProposal, err)
 	}
 
 	
@@ -1836,55 +1842,22 @@ func (t *SimpleChaincode) issueProposal(stub shim.ChaincodeStubInterface, args [
 	cpRxBytes, err := stub.GetState(proposalPrefix + proposal.ProposalNo)
 	if cpRxBytes == nil {
 		fmt.Println("proposalNo does not exist, creating it")
+		proposal.ProposedDate, err = stampTime(stub, entityProposal, proposal.ProposalNo, "proposeddate", proposal.ProposedDate)
+		if err != nil {
+			return nil, err
+		}
 		cpBytes, err := json.Marshal(&proposal)
 		if err != nil {
 			fmt.Println("Error marshalling proposal")
-			return nil, errors.New("Error issuing proposal")
+			return nil, storageError(entityProposal, proposal.ProposalNo, "marshalling")
 		}
-		err = stub.PutState(proposalPrefix + proposal.ProposalNo, cpBytes)
+		err = putState(stub, proposalPrefix + proposal.ProposalNo, cpBytes)
 		if err != nil {
 			fmt.Println("Error issuing proposal")
-			return nil, errors.New("Error issuing proposal")
-		}
-
-		
-
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting proposal Keys")
-		keysBytes, err := stub.GetState("ProposalKeys")
-		if err != nil {
-			fmt.Println("Error retrieving proposalNo")
-			return nil, errors.New("Error retrieving proposalNo")
-		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
-		if err != nil {
-			fmt.Println("Error unmarshel proposalNo")
-			return nil, errors.New("Error unmarshalling proposalNo ")
-		}
-
-		fmt.Println("Appending the new key to proposalNo Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == proposalPrefix+proposal.ProposalNo {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, proposalPrefix+proposal.ProposalNo)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling proposalNo")
-				return nil, errors.New("Error marshalling the proposalNo")
-			}
-			fmt.Println("Put state on proposalNo")
-			err = stub.PutState("ProposalKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting proposalNo back")
-				return nil, errors.New("Error writing the proposalNo back")
-			}
+			return nil, storageError(entityProposal, proposal.ProposalNo, "writing")
 		}
 
+		recordEvent(stub, entityProposal, actionCreated, proposalPrefix+proposal.ProposalNo, "", "")
 		fmt.Println("Issue commercial paper %+v\n", proposal)
 		return nil, nil
 	} else {
@@ -1895,25 +1868,28 @@ func (t *SimpleChaincode) issueProposal(stub shim.ChaincodeStubInterface, args [
 		err = json.Unmarshal(cpRxBytes, &proposalrx)
 		if err != nil {
 			fmt.Println("Error unmarshalling proposal " + proposal.ProposalNo)
-			return nil, errors.New("Error unmarshalling proposal " + proposal.ProposalNo)
+			return nil, storageError(entityProposal, proposal.ProposalNo, "unmarshalling")
 		}
 
 		//quoterx.Qty = quoterx.Qty + quote.Qty
 
+		// An update can't move when the proposal was made
+		proposal.ProposedDate = proposalrx.ProposedDate
 		proposalrx = proposal
 
 
 		cpWriteBytes, err := json.Marshal(&proposalrx)
 		if err != nil {
 			fmt.Println("Error marshalling proposal")
-			return nil, errors.New("Error issuing proposal")
+			return nil, storageError(entityProposal, proposal.ProposalNo, "marshalling")
 		}
-		err = stub.PutState(proposalPrefix+proposal.ProposalNo, cpWriteBytes)
+		err = putState(stub, proposalPrefix+proposal.ProposalNo, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error proposal")
-			return nil, errors.New("Error issuing proposal")
+			return nil, storageError(entityProposal, proposal.ProposalNo, "writing")
 		}
 
+		recordEvent(stub, entityProposal, actionUpdated, proposalPrefix+proposal.ProposalNo, "", "")
 		fmt.Println("Updated commercial paper %+v\n", proposalrx)
 		return nil, nil
 	}
@@ -1923,32 +1899,21 @@ func GetAllproposal(stub shim.ChaincodeStubInterface) ([]Proposal, error) {
 
 	var allproposal []Proposal
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("ProposalKeys")
-	if err != nil {
-		fmt.Println("Error retrieving proposal Keys ")
-		return nil, errors.New("Error retrieving proposal Keys")
-	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
-	if err != nil {
-		fmt.Println("Error unmarshalling proposal keys")
-		return nil, errors.New("Error unmarshalling proposal keys")
-	}
-
-	// Get all the cps
-	for _, value := range keys {
-		cpBytes, err := stub.GetState(value)
-
+	// Get all the proposals
+	err := scanCollection(stub, collections["proposal"], func(value string, cpBytes []byte) error {
 		var proposal Proposal
-		err = json.Unmarshal(cpBytes, &proposal)
+		err := json.Unmarshal(cpBytes, &proposal)
 		if err != nil {
 			fmt.Println("Error retrieving proposal " + value)
-			return nil, errors.New("Error retrieving proposal " + value)
+			return storageError(entityProposal, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending proposal" + value)
 		allproposal = append(allproposal, proposal)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allproposal, nil
@@ -1964,7 +1929,7 @@ func (t *SimpleChaincode) issueSaleAgreement(stub shim.ChaincodeStubInterface, a
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+		return nil, badArguments("issueSaleAgreement", "sale agreement record")
 	}
 
 	var saleAgreement SaleAgreement
@@ -1975,7 +1940,7 @@ func (t *SimpleChaincode) issueSaleAgreement(stub shim.ChaincodeStubInterface, a
 	err = json.Unmarshal([]byte(args[0]), &saleAgreement)
 	if err != nil {
 		fmt.Println("error invalid saleAgreement issue" + args[0])
-		return nil, errors.New("Invalid saleAgreement issue" + args[0])
+		return nil, invalidRecord(entityAgreement, err)
 	}
 
 	
@@ -1987,55 +1952,23 @@ func (t *SimpleChaincode) issueSaleAgreement(stub shim.ChaincodeStubInterface, a
 	cpRxBytes, err := stub.GetState(agreementPrefix + saleAgreement.AgreementNo)
 	if cpRxBytes == nil {
 		fmt.Println("AgreementNo does not exist, creating it")
+		saleAgreement.Status = agreementPending
+		saleAgreement.SignedOn, err = stampTime(stub, entityAgreement, saleAgreement.AgreementNo, "signedon", saleAgreement.SignedOn)
+		if err != nil {
+			return nil, err
+		}
 		cpBytes, err := json.Marshal(&saleAgreement)
 		if err != nil {
 			fmt.Println("Error marshalling saleAgreement")
-			return nil, errors.New("Error issuing saleAgreement")
+			return nil, storageError(entityAgreement, saleAgreement.AgreementNo, "marshalling")
 		}
-		err = stub.PutState(agreementPrefix + saleAgreement.AgreementNo, cpBytes)
+		err = putState(stub, agreementPrefix + saleAgreement.AgreementNo, cpBytes)
 		if err != nil {
 			fmt.Println("Error issuing saleAgreement")
-			return nil, errors.New("Error issuing saleAgreement")
-		}
-
-		
-
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting saleAgreement Keys")
-		keysBytes, err := stub.GetState("AgreementKeys")
-		if err != nil {
-			fmt.Println("Error retrieving AgreementKeys")
-			return nil, errors.New("Error retrieving AgreementKeys")
-		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
-		if err != nil {
-			fmt.Println("Error unmarshel AgreementKeys")
-			return nil, errors.New("Error unmarshalling AgreementKeys ")
-		}
-
-		fmt.Println("Appending the new key to AgreementKeys Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == agreementPrefix+saleAgreement.AgreementNo {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, agreementPrefix+saleAgreement.AgreementNo)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling AgreementKeys")
-				return nil, errors.New("Error marshalling the AgreementKeys")
-			}
-			fmt.Println("Put state on AgreementKeys")
-			err = stub.PutState("AgreementKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting AgreementKeys back")
-				return nil, errors.New("Error writing the AgreementKeys back")
-			}
+			return nil, storageError(entityAgreement, saleAgreement.AgreementNo, "writing")
 		}
 
+		recordEvent(stub, entityAgreement, actionCreated, agreementPrefix+saleAgreement.AgreementNo, "", "")
 		fmt.Println("Issue commercial paper %+v\n", saleAgreement)
 		return nil, nil
 	} else {
@@ -2046,11 +1979,17 @@ func (t *SimpleChaincode) issueSaleAgreement(stub shim.ChaincodeStubInterface, a
 		err = json.Unmarshal(cpRxBytes, &saleAgreementrx)
 		if err != nil {
 			fmt.Println("Error unmarshalling saleAgreement " + saleAgreement.AgreementNo)
-			return nil, errors.New("Error unmarshalling saleAgreement " + saleAgreement.AgreementNo)
+			return nil, storageError(entityAgreement, saleAgreement.AgreementNo, "unmarshalling")
 		}
 
 		//quoterx.Qty = quoterx.Qty + quote.Qty
 
+		if saleAgreementrx.Status == agreementExecuted {
+			fmt.Println("saleAgreement " + saleAgreement.AgreementNo + " is executed")
+			return nil, newError(codeInvalidStatus, entityAgreement, saleAgreement.AgreementNo, "", "Sale agreement "+saleAgreement.AgreementNo+" has been executed and cannot be changed")
+		}
+		saleAgreement.Status = saleAgreementrx.Status
+		saleAgreement.SignedOn = saleAgreementrx.SignedOn
 		saleAgreementrx = saleAgreement
 		
 
@@ -2058,14 +1997,15 @@ func (t *SimpleChaincode) issueSaleAgreement(stub shim.ChaincodeStubInterface, a
 		cpWriteBytes, err := json.Marshal(&saleAgreementrx)
 		if err != nil {
 			fmt.Println("Error marshalling saleAgreement")
-			return nil, errors.New("Error issuing saleAgreement")
+			return nil, storageError(entityAgreement, saleAgreement.AgreementNo, "marshalling")
 		}
-		err = stub.PutState(agreementPrefix+saleAgreement.AgreementNo, cpWriteBytes)
+		err = putState(stub, agreementPrefix+saleAgreement.AgreementNo, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error saleAgreement")
-			return nil, errors.New("Error issuing saleAgreement")
+			return nil, storageError(entityAgreement, saleAgreement.AgreementNo, "writing")
 		}
 
+		recordEvent(stub, entityAgreement, actionUpdated, agreementPrefix+saleAgreement.AgreementNo, "", "")
 		fmt.Println("Updated commercial paper %+v\n", saleAgreementrx)
 		return nil, nil
 	}
@@ -2075,32 +2015,21 @@ func GetAllAgreement(stub shim.ChaincodeStubInterface) ([]SaleAgreement, error)
 
 	var allSaleAgreement []SaleAgreement
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("AgreementKeys")
-	if err != nil {
-		fmt.Println("Error retrieving SaleAgreement Keys ")
-		return nil, errors.New("Error retrieving SaleAgreement Keys")
-	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
-	if err != nil {
-		fmt.Println("Error unmarshalling SaleAgreement keys")
-		return nil, errors.New("Error unmarshalling SaleAgreement keys")
-	}
-
-	// Get all the cps
-	for _, value := range keys {
-		cpBytes, err := stub.GetState(value)
-
+	// Get all the agreements
+	err := scanCollection(stub, collections["agreement"], func(value string, cpBytes []byte) error {
 		var saleAgreement SaleAgreement
-		err = json.Unmarshal(cpBytes, &saleAgreement)
+		err := json.Unmarshal(cpBytes, &saleAgreement)
 		if err != nil {
 			fmt.Println("Error retrieving saleAgreement " + value)
-			return nil, errors.New("Error retrieving saleAgreement " + value)
+			return storageError(entityAgreement, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending saleAgreement" + value)
 		allSaleAgreement = append(allSaleAgreement, saleAgreement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allSaleAgreement, nil
@@ -2116,7 +2045,7 @@ func (t *SimpleChaincode) issueSaleDeeds(stub shim.ChaincodeStubInterface, args
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting Quotation record")
+		return nil, badArguments("issueSaleDeeds", "sale deed record")
 	}
 
 	var saleDeed SaleDeed
@@ -2127,7 +2056,7 @@ func (t *SimpleChaincode) issueSaleDeeds(stub shim.ChaincodeStubInterface, args
 	err = json.Unmarshal([]byte(args[0]), &saleDeed)
 	if err != nil {
 		fmt.Println("error invalid saleDeed issue" + args[0])
-		return nil, errors.New("Invalid saleDeed issue" + args[0])
+		return nil, invalidRecord(entityDeed, err)
 	}
 
 	
@@ -2139,55 +2068,26 @@ func (t *SimpleChaincode) issueSaleDeeds(stub shim.ChaincodeStubInterface, args
 	cpRxBytes, err := stub.GetState(deedPrefix + saleDeed.DeedNo)
 	if cpRxBytes == nil {
 		fmt.Println("DeedNo does not exist, creating it")
-		cpBytes, err := json.Marshal(&saleDeed)
+		saleDeed.SignedOn, err = stampTime(stub, entityDeed, saleDeed.DeedNo, "signedon", saleDeed.SignedOn)
 		if err != nil {
-			fmt.Println("Error marshalling saleDeed")
-			return nil, errors.New("Error issuing saleDeed")
+			return nil, err
 		}
-		err = stub.PutState(deedPrefix + saleDeed.DeedNo, cpBytes)
+		err = registerDeed(saleDeed, stub)
 		if err != nil {
-			fmt.Println("Error issuing saleDeed")
-			return nil, errors.New("Error issuing saleDeed")
+			return nil, err
 		}
-
-		
-
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting saleDeed Keys")
-		keysBytes, err := stub.GetState("DeedKeys")
+		cpBytes, err := json.Marshal(&saleDeed)
 		if err != nil {
-			fmt.Println("Error retrieving DeedKeys")
-			return nil, errors.New("Error retrieving DeedKeys")
+			fmt.Println("Error marshalling saleDeed")
+			return nil, storageError(entityDeed, saleDeed.DeedNo, "marshalling")
 		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
+		err = putState(stub, deedPrefix + saleDeed.DeedNo, cpBytes)
 		if err != nil {
-			fmt.Println("Error unmarshel DeedKeys")
-			return nil, errors.New("Error unmarshalling DeedKeys ")
-		}
-
-		fmt.Println("Appending the new key to DeedKeys Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == deedPrefix+saleDeed.DeedNo {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, deedPrefix+saleDeed.DeedNo)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling DeedKeys")
-				return nil, errors.New("Error marshalling the DeedKeys")
-			}
-			fmt.Println("Put state on DeedKeys")
-			err = stub.PutState("DeedKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting DeedKeys back")
-				return nil, errors.New("Error writing the DeedKeys back")
-			}
+			fmt.Println("Error issuing saleDeed")
+			return nil, storageError(entityDeed, saleDeed.DeedNo, "writing")
 		}
 
+		recordEvent(stub, entityDeed, actionCreated, deedPrefix+saleDeed.DeedNo, "", "")
 		fmt.Println("Issue commercial paper %+v\n", saleDeed)
 		return nil, nil
 	} else {
@@ -2198,25 +2098,31 @@ func (t *SimpleChaincode) issueSaleDeeds(stub shim.ChaincodeStubInterface, args
 		err = json.Unmarshal(cpRxBytes, &saleDeedrx)
 		if err != nil {
 			fmt.Println("Error unmarshalling saleDeed " + saleDeed.DeedNo)
-			return nil, errors.New("Error unmarshalling saleDeed " + saleDeed.DeedNo)
+			return nil, storageError(entityDeed, saleDeed.DeedNo, "unmarshalling")
 		}
 
 		//quoterx.Qty = quoterx.Qty + quote.Qty
 
+		if saleDeed.AgreementNo != saleDeedrx.AgreementNo {
+			fmt.Println("saleDeed " + saleDeed.DeedNo + " is registered against another agreement")
+			return nil, newError(codeConflict, entityDeed, saleDeed.DeedNo, "agreementNo", "Sale deed "+saleDeed.DeedNo+" is already registered against agreement "+saleDeedrx.AgreementNo)
+		}
+		saleDeed.SignedOn = saleDeedrx.SignedOn
 		saleDeedrx = saleDeed
 
 
 		cpWriteBytes, err := json.Marshal(&saleDeedrx)
 		if err != nil {
 			fmt.Println("Error marshalling saleDeed")
-			return nil, errors.New("Error issuing saleDeed")
+			return nil, storageError(entityDeed, saleDeed.DeedNo, "marshalling")
 		}
-		err = stub.PutState(deedPrefix+saleDeed.DeedNo, cpWriteBytes)
+		err = putState(stub, deedPrefix+saleDeed.DeedNo, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error saleDeed")
-			return nil, errors.New("Error issuing saleDeed")
+			return nil, storageError(entityDeed, saleDeed.DeedNo, "writing")
 		}
 
+		recordEvent(stub, entityDeed, actionUpdated, deedPrefix+saleDeed.DeedNo, "", "")
 		fmt.Println("Updated commercial paper %+v\n", saleDeedrx)
 		return nil, nil
 	}
@@ -2226,32 +2132,21 @@ func GetAllDeed(stub shim.ChaincodeStubInterface) ([]SaleDeed, error) {
 
 	var allsaleDeed []SaleDeed
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("DeedKeys")
-	if err != nil {
-		fmt.Println("Error retrieving saleDeed Keys ")
-		return nil, errors.New("Error retrieving saleDeed Keys")
-	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
-	if err != nil {
-		fmt.Println("Error unmarshalling saleDeed keys")
-		return nil, errors.New("Error unmarshalling saleDeed keys")
-	}
-
-	// Get all the cps
-	for _, value := range keys {
-		cpBytes, err := stub.GetState(value)
-
+	// Get all the deeds
+	err := scanCollection(stub, collections["deed"], func(value string, cpBytes []byte) error {
 		var saleDeed SaleDeed
-		err = json.Unmarshal(cpBytes, &saleDeed)
+		err := json.Unmarshal(cpBytes, &saleDeed)
 		if err != nil {
 			fmt.Println("Error retrieving saleDeed " + value)
-			return nil, errors.New("Error retrieving saleDeed " + value)
+			return storageError(entityDeed, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending saleDeed" + value)
 		allsaleDeed = append(allsaleDeed, saleDeed)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allsaleDeed, nil
@@ -2275,12 +2170,17 @@ func (t *SimpleChaincode) issueCommercialPaper(stub shim.ChaincodeStubInterface,
 	/*		0
 		json
 	  	{
+			"cusip": "string", // optional, reopens an existing issue with identical terms
 			"ticker":  "string",
 			"par": 0.00,
 			"qty": 10,
-			"discount": 7.5,
+			"discount": 7.5, // the yield interest-bearing paper is priced at, its coupon when 0
 			"maturity": 30,
-			"owners": [ // This one is not required
+			"dayCount": "ACT/360", // optional, one of ACT/360, ACT/365 or 30/360
+			"currency": "USD", // optional, must be allowed by the issuer's program
+			"instrumentType": "discount", // optional, discount or interest
+			"coupon": 5.25, // interest-bearing paper only, paid with par at maturity
+			"owners": [ // ignored, new paper is owned by its issuer
 				{
 					"company": "company1",
 					"quantity": 5
@@ -2295,14 +2195,14 @@ func (t *SimpleChaincode) issueCommercialPaper(stub shim.ChaincodeStubInterface,
 				}
 			],
 			"issuer":"company2",
-			"issueDate":"1456161763790"  (current time in milliseconds as a string)
+			"issueDate":"1456161763790"  (optional, checked against the transaction time, which is stored in milliseconds)
 
 		}
 	*/
 	//need one arg
 	if len(args) != 1 {
 		fmt.Println("error invalid arguments")
-		return nil, errors.New("Incorrect number of arguments. Expecting commercial paper record")
+		return nil, badArguments("issueCommercialPaper", "commercial paper record")
 	}
 
 	var cp CP
@@ -2313,7 +2213,51 @@ func (t *SimpleChaincode) issueCommercialPaper(stub shim.ChaincodeStubInterface,
 	err = json.Unmarshal([]byte(args[0]), &cp)
 	if err != nil {
 		fmt.Println("error invalid paper issue")
-		return nil, errors.New("Invalid commercial paper issue")
+		return nil, invalidRecord(entityCP, err)
+	}
+
+	if cp.DayCount == "" {
+		cp.DayCount = defaultDayCount
+	}
+	if !validDayCount(cp.DayCount) {
+		fmt.Println("Unknown day count convention " + cp.DayCount)
+		return nil, invalidField(entityCP, cp.CUSIP, "dayCount", "Unknown day count convention "+cp.DayCount)
+	}
+	if cp.Currency == "" {
+		cp.Currency = defaultCurrency
+	}
+	err = checkInstrument(cp)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, invalidField(entityCP, cp.CUSIP, "instrumentType", err.Error())
+	}
+	if interestBearing(cp) && cp.Discount == 0 {
+		cp.Discount = cp.Coupon
+	}
+	if cp.Qty <= 0 {
+		fmt.Println("Invalid quantity " + strconv.Itoa(cp.Qty))
+		return nil, invalidField(entityCP, cp.CUSIP, "qty", "Invalid quantity "+strconv.Itoa(cp.Qty))
+	}
+	if cp.Par <= 0 {
+		fmt.Println("Invalid par " + cp.Par.String())
+		return nil, invalidField(entityCP, cp.CUSIP, "par", "Invalid par "+cp.Par.String())
+	}
+	// A discount of 100% or more would give the paper no price at all
+	if cp.Discount < 0 || cp.Discount >= fullRate {
+		fmt.Println("Invalid discount " + cp.Discount.String())
+		return nil, invalidField(entityCP, cp.CUSIP, "discount", "Invalid discount "+cp.Discount.String())
+	}
+
+	// Only the issuer itself may issue its paper
+	err = requireCompany(stub, "issueCommercialPaper", cp.Issuer)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	err = checkProgram(stub, cp, cp.Qty)
+	if err != nil {
+		return nil, err
 	}
 
 	//generate the CUSIP
@@ -2322,95 +2266,82 @@ func (t *SimpleChaincode) issueCommercialPaper(stub shim.ChaincodeStubInterface,
 	accountBytes, err := stub.GetState(accountPrefix + cp.Issuer)
 	if err != nil {
 		fmt.Println("Error Getting state of - " + accountPrefix + cp.Issuer)
-		return nil, errors.New("Error retrieving account " + cp.Issuer)
+		return nil, storageError(entityAccount, cp.Issuer, "retrieving")
+	}
+	if accountBytes == nil {
+		fmt.Println("Account not found " + cp.Issuer)
+		return nil, notFound(entityAccount, cp.Issuer)
 	}
 	err = json.Unmarshal(accountBytes, &account)
 	if err != nil {
 		fmt.Println("Error Unmarshalling accountBytes")
-		return nil, errors.New("Error retrieving account " + cp.Issuer)
+		return nil, storageError(entityAccount, cp.Issuer, "unmarshalling")
 	}
 
-	account.AssetsIds = append(account.AssetsIds, cp.CUSIP)
-
-	// Set the issuer to be the owner of all quantity
+	// Set the issuer to be the owner of all quantity. Whatever positions
+	// the caller sent are dropped, paper is only ever issued to its issuer.
 	var owner Owner
 	owner.Company = cp.Issuer
 	owner.Quantity = cp.Qty
 
-	cp.Owners = append(cp.Owners, owner)
+	cp.Owners = []Owner{owner}
+	cp.Matured = false
 
-	suffix, err := generateCUSIPSuffix(cp.IssueDate, cp.Maturity)
-	if err != nil {
-		fmt.Println("Error generating cusip")
-		return nil, errors.New("Error generating CUSIP")
-	}
+	var cpRxBytes []byte
+	if cp.CUSIP == "" {
+		cp.IssueDate, err = stampTime(stub, entityCP, cp.CUSIP, "issueDate", cp.IssueDate)
+		if err != nil {
+			return nil, err
+		}
+		cp.CUSIP, err = nextFreeCUSIP(stub, &account)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// A CUSIP supplied by the caller reopens an existing issue
+		if !validCUSIP(cp.CUSIP) {
+			fmt.Println("Invalid CUSIP " + cp.CUSIP)
+			return nil, invalidField(entityCP, cp.CUSIP, "cusip", "Invalid CUSIP "+cp.CUSIP)
+		}
 
-	fmt.Println("Marshalling CP bytes")
-	cp.CUSIP = account.Prefix + suffix
+		fmt.Println("Getting State on CP " + cp.CUSIP)
+		cpRxBytes, err = stub.GetState(cpPrefix + cp.CUSIP)
+		if err != nil || cpRxBytes == nil {
+			fmt.Println("CUSIP not found " + cp.CUSIP)
+			return nil, notFound(entityCP, cp.CUSIP)
+		}
+	}
 
-	fmt.Println("Getting State on CP " + cp.CUSIP)
-	cpRxBytes, err := stub.GetState(cpPrefix + cp.CUSIP)
 	if cpRxBytes == nil {
 		fmt.Println("CUSIP does not exist, creating it")
+		err = adjustHolding(stub, &account, cp.CUSIP, cp.Qty, 0)
+		if err != nil {
+			return nil, err
+		}
 		cpBytes, err := json.Marshal(&cp)
 		if err != nil {
 			fmt.Println("Error marshalling cp")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityCP, cp.CUSIP, "marshalling")
 		}
-		err = stub.PutState(cpPrefix+cp.CUSIP, cpBytes)
+		err = putState(stub, cpPrefix+cp.CUSIP, cpBytes)
 		if err != nil {
 			fmt.Println("Error issuing paper")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityCP, cp.CUSIP, "writing")
 		}
 
 		fmt.Println("Marshalling account bytes to write")
 		accountBytesToWrite, err := json.Marshal(&account)
 		if err != nil {
 			fmt.Println("Error marshalling account")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityAccount, cp.Issuer, "marshalling")
 		}
-		err = stub.PutState(accountPrefix+cp.Issuer, accountBytesToWrite)
+		err = putState(stub, accountPrefix+cp.Issuer, accountBytesToWrite)
 		if err != nil {
 			fmt.Println("Error putting state on accountBytesToWrite")
-			return nil, errors.New("Error issuing commercial paper")
-		}
-
-		// Update the paper keys by adding the new key
-		fmt.Println("Getting Paper Keys")
-		keysBytes, err := stub.GetState("PaperKeys")
-		if err != nil {
-			fmt.Println("Error retrieving paper keys")
-			return nil, errors.New("Error retrieving paper keys")
-		}
-		var keys []string
-		err = json.Unmarshal(keysBytes, &keys)
-		if err != nil {
-			fmt.Println("Error unmarshel keys")
-			return nil, errors.New("Error unmarshalling paper keys ")
-		}
-
-		fmt.Println("Appending the new key to Paper Keys")
-		foundKey := false
-		for _, key := range keys {
-			if key == cpPrefix+cp.CUSIP {
-				foundKey = true
-			}
-		}
-		if foundKey == false {
-			keys = append(keys, cpPrefix+cp.CUSIP)
-			keysBytesToWrite, err := json.Marshal(&keys)
-			if err != nil {
-				fmt.Println("Error marshalling keys")
-				return nil, errors.New("Error marshalling the keys")
-			}
-			fmt.Println("Put state on PaperKeys")
-			err = stub.PutState("PaperKeys", keysBytesToWrite)
-			if err != nil {
-				fmt.Println("Error writting keys back")
-				return nil, errors.New("Error writing the keys back")
-			}
+			return nil, storageError(entityAccount, cp.Issuer, "writing")
 		}
 
+		recordEvent(stub, entityCP, actionIssued, cpPrefix+cp.CUSIP, "", paperStatus(cp))
 		fmt.Println("Issue commercial paper %+v\n", cp)
 		return nil, nil
 	} else {
@@ -2421,29 +2352,59 @@ func (t *SimpleChaincode) issueCommercialPaper(stub shim.ChaincodeStubInterface,
 		err = json.Unmarshal(cpRxBytes, &cprx)
 		if err != nil {
 			fmt.Println("Error unmarshalling cp " + cp.CUSIP)
-			return nil, errors.New("Error unmarshalling cp " + cp.CUSIP)
+			return nil, storageError(entityCP, cp.CUSIP, "unmarshalling")
+		}
+
+		// A reopening keeps the original issue date, which it may repeat
+		if cp.IssueDate == "" {
+			cp.IssueDate = cprx.IssueDate
+		} else if issued, err := parseClientTime(cp.IssueDate); err == nil {
+			cp.IssueDate = timeToMs(issued)
+		}
+		if !sameTerms(cprx, cp) {
+			fmt.Println("CUSIP " + cp.CUSIP + " exists with different terms")
+			return nil, newError(codeConflict, entityCP, cp.CUSIP, "", "Commercial paper "+cp.CUSIP+" already exists with different terms")
+		}
+		if cprx.Matured {
+			fmt.Println("CUSIP " + cp.CUSIP + " has matured")
+			return nil, newError(codeInvalidStatus, entityCP, cp.CUSIP, "matured", "Commercial paper "+cp.CUSIP+" has matured and can't be reopened")
 		}
 
 		cprx.Qty = cprx.Qty + cp.Qty
 
+		issuerFound := false
 		for key, val := range cprx.Owners {
 			if val.Company == cp.Issuer {
 				cprx.Owners[key].Quantity += cp.Qty
+				issuerFound = true
 				break
 			}
 		}
+		if issuerFound == false {
+			cprx.Owners = append(cprx.Owners, owner)
+		}
 
 		cpWriteBytes, err := json.Marshal(&cprx)
 		if err != nil {
 			fmt.Println("Error marshalling cp")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityCP, cp.CUSIP, "marshalling")
 		}
-		err = stub.PutState(cpPrefix+cp.CUSIP, cpWriteBytes)
+		err = putState(stub, cpPrefix+cp.CUSIP, cpWriteBytes)
 		if err != nil {
 			fmt.Println("Error issuing paper")
-			return nil, errors.New("Error issuing commercial paper")
+			return nil, storageError(entityCP, cp.CUSIP, "writing")
+		}
+
+		err = adjustHolding(stub, &account, cp.CUSIP, cp.Qty, 0)
+		if err != nil {
+			return nil, err
+		}
+		err = PutCompany(account, stub)
+		if err != nil {
+			return nil, err
 		}
 
+		recordEvent(stub, entityCP, actionReopened, cpPrefix+cp.CUSIP, paperStatus(cprx), paperStatus(cprx))
 		fmt.Println("Updated commercial paper %+v\n", cprx)
 		return nil, nil
 	}
@@ -2453,32 +2414,21 @@ func GetAllCPs(stub shim.ChaincodeStubInterface) ([]CP, error) {
 
 	var allCPs []CP
 
-	// Get list of all the keys
-	keysBytes, err := stub.GetState("PaperKeys")
-	if err != nil {
-		fmt.Println("Error retrieving paper keys")
-		return nil, errors.New("Error retrieving paper keys")
-	}
-	var keys []string
-	err = json.Unmarshal(keysBytes, &keys)
-	if err != nil {
-		fmt.Println("Error unmarshalling paper keys")
-		return nil, errors.New("Error unmarshalling paper keys")
-	}
-
 	// Get all the cps
-	for _, value := range keys {
-		cpBytes, err := stub.GetState(value)
-
+	err := scanCollection(stub, collections["cp"], func(value string, cpBytes []byte) error {
 		var cp CP
-		err = json.Unmarshal(cpBytes, &cp)
+		err := json.Unmarshal(cpBytes, &cp)
 		if err != nil {
 			fmt.Println("Error retrieving cp " + value)
-			return nil, errors.New("Error retrieving cp " + value)
+			return storageError(entityCP, value, "unmarshalling")
 		}
 
 		fmt.Println("Appending CP" + value)
 		allCPs = append(allCPs, cp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allCPs, nil
@@ -2490,13 +2440,17 @@ func GetCP(cpid string, stub shim.ChaincodeStubInterface) (CP, error) {
 	cpBytes, err := stub.GetState(cpid)
 	if err != nil {
 		fmt.Println("Error retrieving cp " + cpid)
-		return cp, errors.New("Error retrieving cp " + cpid)
+		return cp, storageError(entityCP, cpid, "retrieving")
+	}
+	if cpBytes == nil {
+		fmt.Println("CP " + cpid + " does not exist")
+		return cp, notFound(entityCP, cpid)
 	}
 
 	err = json.Unmarshal(cpBytes, &cp)
 	if err != nil {
 		fmt.Println("Error unmarshalling cp " + cpid)
-		return cp, errors.New("Error unmarshalling cp " + cpid)
+		return cp, storageError(entityCP, cpid, "unmarshalling")
 	}
 
 	return cp, nil
@@ -2506,528 +2460,502 @@ func GetCompany(companyID string, stub shim.ChaincodeStubInterface) (Account, er
 	var company Account
 	companyBytes, err := stub.GetState(accountPrefix + companyID)
 	if err != nil {
+		fmt.Println("Error retrieving account " + companyID)
+		return company, storageError(entityAccount, companyID, "retrieving")
+	}
+	if companyBytes == nil {
 		fmt.Println("Account not found " + companyID)
-		return company, errors.New("Account not found " + companyID)
+		return company, notFound(entityAccount, companyID)
 	}
 
 	err = json.Unmarshal(companyBytes, &company)
 	if err != nil {
 		fmt.Println("Error unmarshalling account " + companyID + "\n err:" + err.Error())
-		return company, errors.New("Error unmarshalling account " + companyID)
+		return company, storageError(entityAccount, companyID, "unmarshalling")
 	}
 
 	return company, nil
 }
 
-// Still working on this one
-func (t *SimpleChaincode) transferPaper(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	/*		0
-		json
-	  	{
-			  "CUSIP": "",
-			  "fromCompany":"",
-			  "toCompany":"",
-			  "quantity": 1
-		}
-	*/
-	//need one arg
-	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting commercial paper record")
+func PutCP(cp CP, stub shim.ChaincodeStubInterface) error {
+	cpBytes, err := json.Marshal(&cp)
+	if err != nil {
+		fmt.Println("Error marshalling cp " + cp.CUSIP)
+		return storageError(entityCP, cp.CUSIP, "marshalling")
 	}
 
-	var tr Transaction
-
-	fmt.Println("Unmarshalling Transaction")
-	err := json.Unmarshal([]byte(args[0]), &tr)
+	err = putState(stub, cpPrefix+cp.CUSIP, cpBytes)
 	if err != nil {
-		fmt.Println("Error Unmarshalling Transaction")
-		return nil, errors.New("Invalid commercial paper issue")
+		fmt.Println("Error writing cp " + cp.CUSIP)
+		return storageError(entityCP, cp.CUSIP, "writing")
 	}
 
-	fmt.Println("Getting State on CP " + tr.CUSIP)
-	cpBytes, err := stub.GetState(cpPrefix + tr.CUSIP)
+	return nil
+}
+
+func PutCompany(company Account, stub shim.ChaincodeStubInterface) error {
+	companyBytes, err := json.Marshal(&company)
 	if err != nil {
-		fmt.Println("CUSIP not found")
-		return nil, errors.New("CUSIP not found " + tr.CUSIP)
+		fmt.Println("Error marshalling account " + company.ID)
+		return storageError(entityAccount, company.ID, "marshalling")
 	}
 
-	var cp CP
-	fmt.Println("Unmarshalling CP " + tr.CUSIP)
-	err = json.Unmarshal(cpBytes, &cp)
+	err = putState(stub, accountPrefix+company.ID, companyBytes)
 	if err != nil {
-		fmt.Println("Error unmarshalling cp " + tr.CUSIP)
-		return nil, errors.New("Error unmarshalling cp " + tr.CUSIP)
+		fmt.Println("Error writing account " + company.ID)
+		return storageError(entityAccount, company.ID, "writing")
 	}
 
-	var fromCompany Account
-	fmt.Println("Getting State on fromCompany " + tr.FromCompany)
-	fromCompanyBytes, err := stub.GetState(accountPrefix + tr.FromCompany)
-	if err != nil {
-		fmt.Println("Account not found " + tr.FromCompany)
-		return nil, errors.New("Account not found " + tr.FromCompany)
+	return nil
+}
+
+// removeAssetId drops every occurrence of cusip from a company's asset list
+func removeAssetId(assetIds []string, cusip string) []string {
+	var remaining []string
+	for _, id := range assetIds {
+		if id != cusip {
+			remaining = append(remaining, id)
+		}
 	}
+	return remaining
+}
 
-	fmt.Println("Unmarshalling FromCompany ")
-	err = json.Unmarshal(fromCompanyBytes, &fromCompany)
-	if err != nil {
-		fmt.Println("Error unmarshalling account " + tr.FromCompany)
-		return nil, errors.New("Error unmarshalling account " + tr.FromCompany)
+// settleTransfer delivers quantity of a paper from one company to another
+// against payment of amount, and writes back the paper and both accounts.
+// Only paper and cash that are not reserved can change hands, so a trade
+// releases its own reservations before settling through here.
+func settleTransfer(stub shim.ChaincodeStubInterface, cp *CP, from string, to string, quantity int, amount Money) error {
+	if from == to {
+		fmt.Println("The company " + from + " cannot transfer paper to itself")
+		return invalidField(entityTransfer, cp.CUSIP, "toCompany", "The company "+from+" cannot transfer paper to itself")
+	}
+	if quantity <= 0 {
+		fmt.Println("Invalid quantity " + strconv.Itoa(quantity))
+		return invalidField(entityTransfer, cp.CUSIP, "quantity", "Invalid quantity "+strconv.Itoa(quantity))
 	}
 
-	var toCompany Account
-	fmt.Println("Getting State on ToCompany " + tr.ToCompany)
-	toCompanyBytes, err := stub.GetState(accountPrefix + tr.ToCompany)
+	fmt.Println("Getting State on fromCompany " + from)
+	fromCompany, err := GetCompany(from, stub)
 	if err != nil {
-		fmt.Println("Account not found " + tr.ToCompany)
-		return nil, errors.New("Account not found " + tr.ToCompany)
+		return err
 	}
-
-	fmt.Println("Unmarshalling tocompany")
-	err = json.Unmarshal(toCompanyBytes, &toCompany)
+	fmt.Println("Getting State on ToCompany " + to)
+	toCompany, err := GetCompany(to, stub)
 	if err != nil {
-		fmt.Println("Error unmarshalling account " + tr.ToCompany)
-		return nil, errors.New("Error unmarshalling account " + tr.ToCompany)
+		return err
 	}
 
 	// Check for all the possible errors
 	ownerFound := false
-	quantity := 0
+	available := 0
 	for _, owner := range cp.Owners {
-		if owner.Company == tr.FromCompany {
+		if owner.Company == from {
 			ownerFound = true
-			quantity = owner.Quantity
+			available = owner.available()
 		}
 	}
 
 	// If fromCompany doesn't own this paper
 	if ownerFound == false {
-		fmt.Println("The company " + tr.FromCompany + "doesn't own any of this paper")
-		return nil, errors.New("The company " + tr.FromCompany + "doesn't own any of this paper")
+		fmt.Println("The company " + from + " doesn't own any of this paper")
+		return insufficientPaper(cp.CUSIP, "The company "+from+" doesn't own any of "+cp.CUSIP)
 	} else {
 		fmt.Println("The FromCompany does own this paper")
 	}
 
 	// If fromCompany doesn't own enough quantity of this paper
-	if quantity < tr.Quantity {
-		fmt.Println("The company " + tr.FromCompany + "doesn't own enough of this paper")
-		return nil, errors.New("The company " + tr.FromCompany + "doesn't own enough of this paper")
+	if available < quantity {
+		fmt.Println("The company " + from + " doesn't own enough of this paper")
+		return insufficientPaper(cp.CUSIP, "The company "+from+" doesn't own enough unencumbered "+cp.CUSIP)
 	} else {
 		fmt.Println("The FromCompany owns enough of this paper")
 	}
 
-	amountToBeTransferred := float64(tr.Quantity) * cp.Par
-	amountToBeTransferred -= (amountToBeTransferred) * (cp.Discount / 100.0) * (float64(cp.Maturity) / 360.0)
-
 	// If toCompany doesn't have enough cash to buy the papers
-	if toCompany.CashBalance < amountToBeTransferred {
-		fmt.Println("The company " + tr.ToCompany + "doesn't have enough cash to purchase the papers")
-		return nil, errors.New("The company " + tr.ToCompany + "doesn't have enough cash to purchase the papers")
+	if toCompany.availableCash() < amount {
+		fmt.Println("The company " + to + " doesn't have enough cash to purchase the papers")
+		return insufficientFunds(to, "The company "+to+" doesn't have "+amount.String()+" of unreserved cash to purchase the papers")
 	} else {
 		fmt.Println("The ToCompany has enough money to be transferred for this paper")
 	}
 
-	toCompany.CashBalance -= amountToBeTransferred
-	fromCompany.CashBalance += amountToBeTransferred
+	err = moveCash(stub, &toCompany, &fromCompany, amount, "purchase of "+strconv.Itoa(quantity)+" "+cp.CUSIP)
+	if err != nil {
+		return err
+	}
 
 	toOwnerFound := false
 	for key, owner := range cp.Owners {
-		if owner.Company == tr.FromCompany {
+		if owner.Company == from {
 			fmt.Println("Reducing Quantity from the FromCompany")
-			cp.Owners[key].Quantity -= tr.Quantity
-			//			owner.Quantity -= tr.Quantity
+			cp.Owners[key].Quantity -= quantity
 		}
-		if owner.Company == tr.ToCompany {
+		if owner.Company == to {
 			fmt.Println("Increasing Quantity from the ToCompany")
 			toOwnerFound = true
-			cp.Owners[key].Quantity += tr.Quantity
-			//			owner.Quantity += tr.Quantity
+			cp.Owners[key].Quantity += quantity
 		}
 	}
 
 	if toOwnerFound == false {
 		var newOwner Owner
 		fmt.Println("As ToOwner was not found, appending the owner to the CP")
-		newOwner.Quantity = tr.Quantity
-		newOwner.Company = tr.ToCompany
+		newOwner.Quantity = quantity
+		newOwner.Company = to
 		cp.Owners = append(cp.Owners, newOwner)
 	}
 
-	fromCompany.AssetsIds = append(fromCompany.AssetsIds, tr.CUSIP)
+	err = adjustHolding(stub, &fromCompany, cp.CUSIP, -quantity, 0)
+	if err != nil {
+		return err
+	}
+	err = adjustHolding(stub, &toCompany, cp.CUSIP, quantity, amount)
+	if err != nil {
+		return err
+	}
 
 	// Write everything back
-	// To Company
-	toCompanyBytesToWrite, err := json.Marshal(&toCompany)
+	fmt.Println("Put state on toCompany")
+	err = PutCompany(toCompany, stub)
 	if err != nil {
-		fmt.Println("Error marshalling the toCompany")
-		return nil, errors.New("Error marshalling the toCompany")
+		return err
 	}
-	fmt.Println("Put state on toCompany")
-	err = stub.PutState(accountPrefix+tr.ToCompany, toCompanyBytesToWrite)
+	fmt.Println("Put state on fromCompany")
+	err = PutCompany(fromCompany, stub)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Put state on CP")
+	return PutCP(*cp, stub)
+}
+
+func (t *SimpleChaincode) transferPaper(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		json
+	  	{
+			  "CUSIP": "",
+			  "fromCompany":"",
+			  "toCompany":"",
+			  "quantity": 1,
+			  "discount": 7.5 // optional negotiated discount, the paper's discount is used when 0
+		}
+	*/
+	//need one arg
+	if len(args) != 1 {
+		return nil, badArguments("transferPaper", "transfer record")
+	}
+
+	var tr Transaction
+
+	fmt.Println("Unmarshalling Transaction")
+	err := json.Unmarshal([]byte(args[0]), &tr)
 	if err != nil {
-		fmt.Println("Error writing the toCompany back")
-		return nil, errors.New("Error writing the toCompany back")
+		fmt.Println("Error Unmarshalling Transaction")
+		return nil, invalidRecord(entityTransfer, err)
 	}
 
-	// From company
-	fromCompanyBytesToWrite, err := json.Marshal(&fromCompany)
+	// Only the FromCompany itself may sell its paper
+	err = requireCompany(stub, "transferPaper", tr.FromCompany)
 	if err != nil {
-		fmt.Println("Error marshalling the fromCompany")
-		return nil, errors.New("Error marshalling the fromCompany")
+		fmt.Println(err.Error())
+		return nil, err
 	}
-	fmt.Println("Put state on fromCompany")
-	err = stub.PutState(accountPrefix+tr.FromCompany, fromCompanyBytesToWrite)
+
+	fmt.Println("Getting State on CP " + tr.CUSIP)
+	cpBytes, err := stub.GetState(cpPrefix + tr.CUSIP)
 	if err != nil {
-		fmt.Println("Error writing the fromCompany back")
-		return nil, errors.New("Error writing the fromCompany back")
+		fmt.Println("Error retrieving cp " + tr.CUSIP)
+		return nil, storageError(entityCP, tr.CUSIP, "retrieving")
+	}
+	if cpBytes == nil {
+		fmt.Println("CUSIP not found " + tr.CUSIP)
+		return nil, notFound(entityCP, tr.CUSIP)
 	}
 
-	// cp
-	cpBytesToWrite, err := json.Marshal(&cp)
+	var cp CP
+	fmt.Println("Unmarshalling CP " + tr.CUSIP)
+	err = json.Unmarshal(cpBytes, &cp)
 	if err != nil {
-		fmt.Println("Error marshalling the cp")
-		return nil, errors.New("Error marshalling the cp")
+		fmt.Println("Error unmarshalling cp " + tr.CUSIP)
+		return nil, storageError(entityCP, tr.CUSIP, "unmarshalling")
 	}
-	fmt.Println("Put state on CP")
-	err = stub.PutState(cpPrefix+tr.CUSIP, cpBytesToWrite)
+
+	if cp.Matured {
+		fmt.Println("The paper " + tr.CUSIP + " has matured")
+		return nil, newError(codeInvalidStatus, entityCP, tr.CUSIP, "matured", "The paper "+tr.CUSIP+" has matured and can no longer be transferred")
+	}
+
+	if tr.Discount < 0 {
+		fmt.Println("Invalid discount " + tr.Discount.String())
+		return nil, invalidField(entityTransfer, tr.CUSIP, "discount", "Invalid discount "+tr.Discount.String())
+	}
+	discount := cp.Discount
+	if tr.Discount != 0 {
+		discount = tr.Discount
+	}
+
+	// Price on the days left to maturity as of this transaction
+	settle, err := txTime(stub)
 	if err != nil {
-		fmt.Println("Error writing the cp back")
-		return nil, errors.New("Error writing the cp back")
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityTransfer, tr.CUSIP)
 	}
 
+	amountToBeTransferred, err := paperPrice(cp, tr.Quantity, discount, settle)
+	if err != nil {
+		fmt.Println("Error pricing the paper " + tr.CUSIP)
+		return nil, newError(codeFailed, entityCP, tr.CUSIP, "", "Error pricing the paper "+tr.CUSIP+": "+err.Error())
+	}
+
+	err = settleTransfer(stub, &cp, tr.FromCompany, tr.ToCompany, tr.Quantity, amountToBeTransferred)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityCP, actionTransferred, cpPrefix+tr.CUSIP, paperStatus(cp), paperStatus(cp))
 	fmt.Println("Successfully completed Invoke")
 	return nil, nil
 }
 
-func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	
-	if len(args) < 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting ......")
+func (t *SimpleChaincode) redeemPaper(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		CUSIP
+	*/
+	//need one arg
+	if len(args) != 1 {
+		return nil, badArguments("redeemPaper", "CUSIP")
 	}
+	cusip := args[0]
 
-	if args[0] == "GetAllCPs" {
-		fmt.Println("Getting all CPs")
-		allCPs, err := GetAllCPs(stub)
-		if err != nil {
-			fmt.Println("Error from getallcps")
-			return nil, err
-		} else {
-			allCPsBytes, err1 := json.Marshal(&allCPs)
-			if err1 != nil {
-				fmt.Println("Error marshalling allcps")
-				return nil, err1
-			}
-			fmt.Println("All success, returning allcps")
-			return allCPsBytes, nil
+	fmt.Println("Getting State on CP " + cusip)
+	cp, err := GetCP(cpPrefix+cusip, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the issuer may redeem its paper
+	err = requireCompany(stub, "redeemPaper", cp.Issuer)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	if cp.Matured {
+		fmt.Println("The paper " + cusip + " has already been redeemed")
+		return nil, invalidStatus(entityCP, cusip, "The paper "+cusip+" has already been redeemed")
+	}
+
+	maturity, err := maturityDate(cp)
+	if err != nil {
+		fmt.Println("Error reading the issue date of " + cusip)
+		return nil, invalidField(entityCP, cusip, "issueDate", "Error reading the issue date of "+cusip)
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityCP, cusip)
+	}
+	if now.Before(maturity) {
+		fmt.Println("The paper " + cusip + " has not matured yet")
+		return nil, invalidStatus(entityCP, cusip, "The paper "+cusip+" does not mature until "+maturity.UTC().Format(time.RFC3339))
+	}
+
+	issuer, err := GetCompany(cp.Issuer, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collateral has to be released from its repos before it is repaid
+	for _, owner := range cp.Owners {
+		if owner.Pledged > 0 {
+			fmt.Println("The paper " + cusip + " is pledged by " + owner.Company)
+			return nil, newError(codeInvalidStatus, entityCP, cusip, "owner", "The paper "+cusip+" is pledged under an open repo by "+owner.Company)
 		}
-	} else if args[0] == "GetAllLcs" {
-		fmt.Println("Getting particular lc")
-		allLc, err := GetAllLcs(stub)
-		if err != nil {
-			fmt.Println("Error Getting particular lc")
-			return nil, err
-		} else {
-			allLcBytes, err1 := json.Marshal(&allLc)
-			if err1 != nil {
-				fmt.Println("Error marshalling the lc")
-				return nil, err1
-			}
-			fmt.Println("All success, returning the lc")
-			return allLcBytes, nil
+	}
+
+	// So do open trades, resting asks and auction bids holding it, or they
+	// would settle against paper that has been repaid
+	for _, owner := range cp.Owners {
+		if owner.Reserved > 0 {
+			fmt.Println("The paper " + cusip + " is reserved by " + owner.Company)
+			return nil, newError(codeInvalidStatus, entityCP, cusip, "owner", "The paper "+cusip+" is reserved for an open trade, order or auction by "+owner.Company)
 		}
-	}  else if args[0] == "GetAllPo" {
-		fmt.Println("Getting particular po")
-		allPo, err := GetAllPo(stub)
-		if err != nil {
-			fmt.Println("Error Getting particular po")
-			return nil, err
-		} else {
-			allPoBytes, err1 := json.Marshal(&allPo)
-			if err1 != nil {
-				fmt.Println("Error marshalling the po")
-				return nil, err1
+	}
+
+	// The issuer has to be able to pay every holder before any cash moves.
+	// Interest-bearing paper repays its interest along with par.
+	var amountOwed Money
+	for _, owner := range cp.Owners {
+		if owner.Company != cp.Issuer {
+			amount, err := redemptionAmount(cp, owner.Quantity)
+			if err != nil {
+				fmt.Println("Error working out the redemption of " + cusip)
+				return nil, newError(codeInvalidRecord, entityCP, cusip, "", "Error working out the redemption of "+cusip)
 			}
-			fmt.Println("All success, returning the po")
-			return allPoBytes, nil
+			amountOwed += amount
 		}
-	} else if args[0] == "GetAllBl" {
-		fmt.Println("Getting particular bl")
-		allBl, err := GetAllBl(stub)
-		if err != nil {
-			fmt.Println("Error Getting particular bl")
-			return nil, err
-		} else {
-			allBlBytes, err1 := json.Marshal(&allBl)
-			if err1 != nil {
-				fmt.Println("Error marshalling the bl")
-				return nil, err1
-			}
-			fmt.Println("All success, returning the bl")
-			return allBlBytes, nil
+	}
+	if issuer.availableCash() < amountOwed {
+		fmt.Println("The company " + cp.Issuer + " doesn't have enough cash to redeem the paper")
+		return nil, insufficientFunds(cp.Issuer, "The company "+cp.Issuer+" doesn't have enough cash to redeem "+cusip)
+	}
+
+	for _, owner := range cp.Owners {
+		if owner.Company == cp.Issuer {
+			continue
 		}
-	}  else if args[0] == "GetCP" {
-		fmt.Println("Getting particular cp")
-		cp, err := GetCP(args[1], stub)
+
+		holder, err := GetCompany(owner.Company, stub)
 		if err != nil {
-			fmt.Println("Error Getting particular cp")
 			return nil, err
-		} else {
-			cpBytes, err1 := json.Marshal(&cp)
-			if err1 != nil {
-				fmt.Println("Error marshalling the cp")
-				return nil, err1
-			}
-			fmt.Println("All success, returning the cp")
-			return cpBytes, nil
 		}
-	} else if args[0] == "GetCompany" {
-		fmt.Println("Getting the company")
-		company, err := GetCompany(args[1], stub)
+
+		amount, err := redemptionAmount(cp, owner.Quantity)
 		if err != nil {
-			fmt.Println("Error from getCompany")
-			return nil, err
-		} else {
-			companyBytes, err1 := json.Marshal(&company)
-			if err1 != nil {
-				fmt.Println("Error marshalling the company")
-				return nil, err1
-			}
-			fmt.Println("All success, returning the company")
-			return companyBytes, nil
+			fmt.Println("Error working out the redemption of " + cusip)
+			return nil, newError(codeInvalidRecord, entityCP, cusip, "", "Error working out the redemption of "+cusip)
 		}
-	} else if args[0] == "GetAllProperties" {
-		fmt.Println("Getting all CPs")
-		allProperties, err := GetAllProperties(stub)
+		fmt.Println("Paying " + amount.String() + " to " + owner.Company)
+		err = moveCash(stub, &issuer, &holder, amount, "redemption of "+cusip)
 		if err != nil {
-			fmt.Println("Error from GetAllProperties")
 			return nil, err
-		} else {
-			allPropertiesBytes, err1 := json.Marshal(&allProperties)
-			if err1 != nil {
-				fmt.Println("Error marshalling allcps")
-				return nil, err1
-			}
-			fmt.Println("All success, returning allcps")
-			return allPropertiesBytes, nil
 		}
-	} else if args[0] == "GetAllproposal" {
-		fmt.Println("Getting all Proposal")
-		allProposal, err := GetAllproposal(stub)
+		err = adjustHolding(stub, &holder, cusip, -owner.Quantity, 0)
 		if err != nil {
-			fmt.Println("Error from GetAllproposal")
 			return nil, err
-		} else {
-			allProposalBytes, err1 := json.Marshal(&allProposal)
-			if err1 != nil {
-				fmt.Println("Error marshalling allProposal")
-				return nil, err1
-			}
-			fmt.Println("All success, returning allProposal")
-			return allProposalBytes, nil
 		}
-	} else if args[0] == "GetAllQuotes" {
-		fmt.Println("Getting all Quote")
-		allquote, err := GetAllQuotes(stub)
+
+		err = PutCompany(holder, stub)
 		if err != nil {
-			fmt.Println("Error from GetAllQuotes")
 			return nil, err
-		} else {
-			allquoteBytes, err1 := json.Marshal(&allquote)
-			if err1 != nil {
-				fmt.Println("Error marshalling allquote")
-				return nil, err1
-			}
-			fmt.Println("All success, returning allquote")
-			return allquoteBytes, nil
 		}
-	}else if args[0] == "GetAllAgreement" {
-		fmt.Println("Getting all Agreement")
-		allSaleAgreement, err := GetAllAgreement(stub)
-		if err != nil {
-			fmt.Println("Error from GetAllAgreement")
-			return nil, err
-		} else {
-			allSaleAgreementBytes, err1 := json.Marshal(&allSaleAgreement)
-			if err1 != nil {
-				fmt.Println("Error marshalling allSaleAgreement")
-				return nil, err1
+	}
+
+	for _, owner := range cp.Owners {
+		if owner.Company == cp.Issuer {
+			err = adjustHolding(stub, &issuer, cusip, -owner.Quantity, 0)
+			if err != nil {
+				return nil, err
 			}
-			fmt.Println("All success, returning allSaleAgreement")
-			return allSaleAgreementBytes, nil
 		}
-	} else if args[0] == "GetAllDeed" {
-		fmt.Println("Getting all Deed")
-		allSaleDeed, err := GetAllDeed(stub)
+	}
+	err = PutCompany(issuer, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	oldStatus := paperStatus(cp)
+	cp.Matured = true
+	err = PutCP(cp, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityCP, actionRedeemed, cpPrefix+cusip, oldStatus, paperStatus(cp))
+	fmt.Println("Redeemed commercial paper " + cusip)
+	return nil, nil
+}
+
+// Query and Invoke return every error as a ChaincodeError, so clients
+// always get a code
+func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	result, err := t.query(stub, args)
+	if err != nil {
+		return nil, asChaincodeError(err)
+	}
+	return result, nil
+}
+
+func (t *SimpleChaincode) query(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, badArguments("Query", "a query name, see ListFunctions")
+	}
+
+	query := lookupFunction(kindQuery, args[0])
+	if query == nil {
+		return rawState(stub, args[0])
+	}
+	err := query.authorize(stub)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+	return query.call(t, stub, args[1:])
+}
+
+func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	fmt.Println("invoke is running " + function)
+
+	result, err := t.invoke(newInvocation(stub), function, args)
+	if err != nil {
+		return nil, asChaincodeError(err)
+	}
+	return result, nil
+}
+
+// invoke runs an invoke in its own context. The events it records are
+// sent only if it succeeds; otherwise they go with the context.
+func (t *SimpleChaincode) invoke(stub *invocation, function string, args []string) ([]byte, error) {
+
+	err := authorize(stub, function)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	// A retry with the same idempotency key gets the first result back
+	key, args, err := idempotencyKey(args)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		request, err := replayRequest(stub, key, function, args)
 		if err != nil {
-			fmt.Println("Error from GetAllDeed")
 			return nil, err
-		} else {
-			allSaleDeedBytes, err1 := json.Marshal(&allSaleDeed)
-			if err1 != nil {
-				fmt.Println("Error marshalling allSaleDeed")
-				return nil, err1
-			}
-			fmt.Println("All success, returning allSaleDeed")
-			return allSaleDeedBytes, nil
 		}
-	} else if args[0] == "GetAllNotifications" {
-		fmt.Println("Getting all Notification")
-		allNotification, err := GetAllNotifications(stub)
-		if err != nil {
-			fmt.Println("Error from GetAllNotifications")
-			return nil, err
-		} else {
-			allNotificationBytes, err1 := json.Marshal(&allNotification)
-			if err1 != nil {
-				fmt.Println("Error marshalling allNotification")
-				return nil, err1
-			}
-			fmt.Println("All success, returning allNotification")
-			return allNotificationBytes, nil
+		if request != nil {
+			fmt.Println("Replaying " + function + " from transaction " + request.TxID)
+			return request.Result, nil
 		}
-	} else {
-		fmt.Println("Generic Query call")
-		bytes, err := stub.GetState(args[0])
+	}
+
+	result, err := t.invokeFunction(stub, function, args)
+	if err != nil {
+		return nil, err
+	}
 
+	if key != "" {
+		err = recordRequest(stub, key, function, args, result)
 		if err != nil {
-			fmt.Println("Some error happenend")
-			return nil, errors.New("Some Error happened")
+			return nil, err
 		}
+	}
 
-		fmt.Println("All success, returning from generic")
-		return bytes, nil
+	err = flushEvents(stub)
+	if err != nil {
+		return nil, err
 	}
+	return result, nil
 }
 
-func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	fmt.Println("invoke is running " + function)
-
-	if function == "issueCommercialPaper" {
-		fmt.Println("Firing issueCommercialPaper")
-		//Create an asset with some value
-		return t.issueCommercialPaper(stub, args)
-	} else if function == "transferPaper" {
-		fmt.Println("Firing cretransferPaperateAccounts")
-		return t.transferPaper(stub, args)
-	} else if function == "createAccounts" {
-		fmt.Println("Firing createAccounts")
-		return t.createAccounts(stub, args)
-	} else if function == "createAccount" {
-		fmt.Println("Firing createAccount")
-		return t.createAccount(stub, args)
-	} else if function == "init" {
-		fmt.Println("Firing init")
-		return t.Init(stub, "init", args)
-	} else if function == "issueQuote" { //Added for Trade finance 
-		fmt.Println("Firing issueQuote")
-		return t.issueQuote(stub, args)
-	} else if function == "addProperty" { //Added for Trade finance 
-		fmt.Println("Firing addProperty")
-		return t.addProperty(stub, args)
-	} else if function == "issueProposal" { //Added for Trade finance 
-		fmt.Println("Firing issueProposal")
-		return t.issueProposal(stub, args)
-	} else if function == "issueSaleAgreement" { //Added for Trade finance 
-		fmt.Println("Firing issueSaleAgreement")
-		return t.issueSaleAgreement(stub, args)
-	} else if function == "issueSaleDeeds" { //Added for Trade finance 
-		fmt.Println("Firing issueSaleDeeds")
-		return t.issueSaleDeeds(stub, args)
-	} else if function == "addNotification" { //Added for Trade finance 
-		fmt.Println("Firing addNotification")
-		return t.addNotification(stub, args)
-	} else if function == "issueLetter_Credit" { //Added for Trade finance 
-		fmt.Println("Firing issueLetter_Credit")
-		return t.issueLetter_Credit(stub, args)
-	} else if function == "issuePurchaseOrder" { //Added for Trade finance 
-		fmt.Println("Firing issuePurchaseOrder")
-		return t.issuePurchaseOrder(stub, args)
-	} else if function == "issueBill_Lading" { //Added for Trade finance 
-		fmt.Println("Firing issueBill_Lading")
-		return t.issueBill_Lading(stub, args)
-	} else if function == "ChangeStatusQuote" { //Added for Trade finance 
-		fmt.Println("Firing ChangeStatusQuote")
-		return t.ChangeStatusQuote(stub, args)
-	} else if function == "ChangeStatusPO" { //Added for Trade finance 
-		fmt.Println("Firing ChangeStatusPO")
-		return t.ChangeStatusPO(stub, args)
-	} else if function == "ChangeStatusLC" { //Added for Trade finance 
-		fmt.Println("Firing ChangeStatusLC")
-		return t.ChangeStatusLC(stub, args)
-	} else if function == "ChangeStatusBL" { //Added for Trade finance 
-		fmt.Println("Firing ChangeStatusBL")
-		return t.ChangeStatusBL(stub, args)
-	}
-
-
-
-	return nil, errors.New("Received unknown function invocation")
+// invokeFunction dispatches an authorized invocation to its handler
+func (t *SimpleChaincode) invokeFunction(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	invoke := lookupFunction(kindInvoke, function)
+	if invoke == nil {
+		return nil, unknownFunction(function)
+	}
+	return invoke.call(t, stub, args)
 }
 
 func main() {
-	err := shim.Start(new(SimpleChaincode))
+	err := checkKeyPrefixes(keyPrefixes())
 	if err != nil {
-		fmt.Println("Error starting Simple chaincode: %s", err)
+		fmt.Println(err.Error())
+		return
 	}
-}
 
-//lookup tables for last two digits of CUSIP
-var seventhDigit = map[int]string{
-	1:  "A",
-	2:  "B",
-	3:  "C",
-	4:  "D",
-	5:  "E",
-	6:  "F",
-	7:  "G",
-	8:  "H",
-	9:  "J",
-	10: "K",
-	11: "L",
-	12: "M",
-	13: "N",
-	14: "P",
-	15: "Q",
-	16: "R",
-	17: "S",
-	18: "T",
-	19: "U",
-	20: "V",
-	21: "W",
-	22: "X",
-	23: "Y",
-	24: "Z",
-}
-
-var eigthDigit = map[int]string{
-	1:  "1",
-	2:  "2",
-	3:  "3",
-	4:  "4",
-	5:  "5",
-	6:  "6",
-	7:  "7",
-	8:  "8",
-	9:  "9",
-	10: "A",
-	11: "B",
-	12: "C",
-	13: "D",
-	14: "E",
-	15: "F",
-	16: "G",
-	17: "H",
-	18: "J",
-	19: "K",
-	20: "L",
-	21: "M",
-	22: "N",
-	23: "P",
-	24: "Q",
-	25: "R",
-	26: "S",
-	27: "T",
-	28: "U",
-	29: "V",
-	30: "W",
-	31: "X",
+	err = shim.Start(new(SimpleChaincode))
+	if err != nil {
+		fmt.Println("Error starting Simple chaincode: %s", err)
+	}
 }
@@ -0,0 +1,306 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTransferFailuresCarryTheirCodes(t *testing.T) {
+	s, cusip := newMarket(t)
+	transfer := func(to string, quantity string) string {
+		return `{"CUSIP":"` + cusip + `","fromCompany":"company1","toCompany":"` + to + `","quantity":` + quantity + `}`
+	}
+	s.mustFail(codeInvalidField, "transferPaper", transfer("company1", "1"))
+	s.mustFail(codeInsufficientPaper, "transferPaper", transfer("company2", "11"))
+	s.mustFail(codeInsufficientPaper, "transferPaper", `{"CUSIP":"`+cusip+`","fromCompany":"company3","toCompany":"company2","quantity":1}`)
+}
+
+func TestRecordHelpersReturnCodedErrors(t *testing.T) {
+	s, cusip := newMarket(t)
+	s.mustFail(codeInvalidField, "transferPaper", `{"CUSIP":"`+cusip+`","fromCompany":"company1","toCompany":"company2","quantity":0}`)
+
+	tooLate := timeToMs(s.now.Add(24 * time.Hour))
+	s.mustFail(codeInvalidField, "issueQuote", `{"quoteNo":"Q1","qty":"3","issueDate":"`+tooLate+`"}`)
+	s.mustFail(codeInvalidField, "issueQuote", `{"quoteNo":"Q1","qty":"3","issueDate":"yesterday"}`)
+
+	s.mustFail(codeInvalidField, "issueSaleDeeds", `{"deedno":"D1"}`)
+	s.mustFail(codeNotFound, "issueSaleDeeds", `{"deedno":"D1","agreementno":"A1"}`)
+}
+
+func TestClientTimesAreCheckedAndStampedInMilliseconds(t *testing.T) {
+	s := newTestStub(t)
+	inside := clientTimeTolerance - time.Second
+	outside := clientTimeTolerance + time.Second
+	for i, test := range []struct {
+		issueDate string
+		ok        bool
+	}{
+		{timeToMs(s.now.Add(inside)), true},
+		{timeToMs(s.now.Add(-inside)), true},
+		{timeToMs(s.now.Add(clientTimeTolerance)), true},
+		{s.now.Add(inside).Format(time.RFC3339), true},
+		{s.now.Add(-inside).In(time.FixedZone("EST", -5*3600)).Format(time.RFC3339), true},
+		{timeToMs(s.now.Add(outside)), false},
+		{timeToMs(s.now.Add(-outside)), false},
+		{s.now.Add(outside).Format(time.RFC3339), false},
+		{s.now.Add(-outside).Format(time.RFC3339), false},
+	} {
+		quoteNo := "Q" + string(rune('A'+i))
+		record := `{"quoteNo":"` + quoteNo + `","qty":"3","issueDate":"` + test.issueDate + `"}`
+		if !test.ok {
+			s.mustFail(codeInvalidField, "issueQuote", record)
+			continue
+		}
+		s.mustInvoke("issueQuote", record)
+
+		// Whatever the client sent, the record holds the transaction time
+		var quote Quote
+		err := json.Unmarshal(s.State[quotePrefix+quoteNo], &quote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quote.IssueDate != timeToMs(s.now) {
+			t.Fatalf("the issue date %s was stored as %s, want %s", test.issueDate, quote.IssueDate, timeToMs(s.now))
+		}
+	}
+}
+
+func TestHelperFailuresCarryTheirCodes(t *testing.T) {
+	s, cusip := newMarket(t)
+	for _, test := range []struct {
+		code  string
+		query bool
+		args  []string
+	}{
+		{codeInvalidField, false, []string{"issueCommercialPaper", `{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":30,"issuer":"company1","instrumentType":"bogus"}`}},
+		{codeBadArguments, false, []string{"createAccount"}},
+		{codeInvalidField, false, []string{"createAccounts", "many"}},
+		{codeInvalidRecord, false, []string{"setProgram", "company1", "{"}},
+		{codeInvalidField, false, []string{"setProgram", "company1", `{"authorized":1000,"currencies":["usd"]}`}},
+		{codeInvalidField, false, []string{"issueQuote", `{"quoteNo":"Q1","qty":"3"}`, idempotencyArg + "k1", idempotencyArg + "k2"}},
+		{codeInvalidField, true, []string{"GetPage", "cp", "ten"}},
+		{codeInvalidField, true, []string{"GetPage", "cp", "0"}},
+		{codeNotFound, true, []string{"GetRequest", "k1"}},
+		{codeInvalidField, true, []string{"GetPortfolio", "company1", "yesterday"}},
+		{codeInvalidField, true, []string{"GetYield", cusip, "soon"}},
+	} {
+		var err error
+		if test.query {
+			_, err = s.query(test.args...)
+		} else {
+			_, err = s.invoke(test.args[0], test.args[1:]...)
+		}
+		checkCode(t, err, test.code)
+	}
+
+	// A version counter that can't be read stops the write it belongs to
+	s.put(versionPrefix+accountPrefix+"company2", "two")
+	s.mustFail(codeStorage, "depositCash", "company2", "100", "top up")
+
+	s.as(roleInvestor, "company2")
+	_, err := s.query(accountPrefix + "company1")
+	checkCode(t, err, codePermission)
+}
+
+func TestRedeemPaperReturnsCodedErrors(t *testing.T) {
+	s, cusip := newMarket(t)
+	s.mustFail(codeBadArguments, "redeemPaper")
+	s.mustFail(codeInvalidStatus, "redeemPaper", cusip)
+
+	s.now = s.now.Add(31 * 24 * time.Hour)
+	s.mustInvoke("redeemPaper", cusip)
+	s.mustFail(codeInvalidStatus, "redeemPaper", cusip)
+
+	cp := s.cp(cusip)
+	cp.CUSIP, cp.Matured, cp.IssueDate = "999999999", false, "yesterday"
+	s.put(cpPrefix+cp.CUSIP, cp)
+	s.mustFail(codeInvalidField, "redeemPaper", cp.CUSIP)
+}
+
+func TestRedeemPaperWaitsForReservations(t *testing.T) {
+	s, cusip := newMarket(t)
+	s.mustInvoke("transferPaper", `{"CUSIP":"`+cusip+`","fromCompany":"company1","toCompany":"company2","quantity":5}`)
+	ask := s.order(roleInvestor, "company2", cusip, sideAsk, "5", 2)
+
+	s.now = s.now.Add(31 * 24 * time.Hour)
+	s.as(roleIssuer, "company1")
+	s.mustFail(codeInvalidStatus, "redeemPaper", cusip)
+
+	s.as(roleInvestor, "company2")
+	s.mustInvoke("cancelOrder", ask)
+	s.as(roleIssuer, "company1")
+	s.mustInvoke("redeemPaper", cusip)
+	if !s.cp(cusip).Matured {
+		t.Fatal("the paper was not redeemed once its ask was cancelled")
+	}
+}
+
+func TestTradesExpireByMaturity(t *testing.T) {
+	s, cusip := newMarket(t)
+	trade := func(expiresOn string) string {
+		return `{"cusip":"` + cusip + `","seller":"company1","buyer":"company2","quantity":5,"expiresOn":"` + expiresOn + `"}`
+	}
+	s.mustFail(codeInvalidField, "proposeTrade", trade("next year"))
+	s.mustFail(codeInvalidField, "proposeTrade", trade(timeToMs(s.now)))
+
+	s.mustInvoke("proposeTrade", trade(timeToMs(s.now.AddDate(10, 0, 0))))
+	var got Trade
+	s.mustQuery(&got, "GetTrade", s.lastTxID())
+	if maturity := timeToMs(s.now.AddDate(0, 0, 30)); got.ExpiresOn != maturity {
+		t.Fatalf("the trade expires on %s, want the maturity %s", got.ExpiresOn, maturity)
+	}
+
+	s.now = s.now.Add(31 * 24 * time.Hour)
+	s.mustFail(codeInvalidStatus, "redeemPaper", cusip)
+	s.mustInvoke("expireTrade", got.ID)
+	s.mustInvoke("redeemPaper", cusip)
+}
+
+func TestAddPropertyKeepsTheTitle(t *testing.T) {
+	s := newTestStub(t)
+	s.as(roleRegistrar, "registrar")
+	s.mustInvoke("addProperty", `{"propid":"P1","owner":"company1","address":"1 Main St","history":[{"owner":"company1","from":"2020"}]}`)
+	s.mustInvoke("addProperty", `{"propid":"P1","owner":"company2","address":"2 Main St","history":[]}`)
+
+	var properties []Property
+	s.mustQuery(&properties, "GetAllProperties")
+	if len(properties) != 1 {
+		t.Fatalf("found %d properties, want 1", len(properties))
+	}
+	got := properties[0]
+	if got.Address != "2 Main St" {
+		t.Fatalf("the update left the address %q", got.Address)
+	}
+	if got.PropOwner != "company1" || len(got.Histories) != 1 {
+		t.Fatalf("the update changed the title to %q with %d owners on record", got.PropOwner, len(got.Histories))
+	}
+}
+
+func TestCUSIPCheckDigit(t *testing.T) {
+	for _, test := range []struct {
+		base  string
+		check string
+	}{
+		{"03783310", "0"},
+		{"38259P50", "8"},
+		{"59491810", "4"},
+		{"17275R10", "2"},
+		{"10000A00", "7"},
+		{"ABC*@#00", "0"},
+	} {
+		got, err := cusipCheckDigit(test.base)
+		if err != nil {
+			t.Fatalf("%s: %v", test.base, err)
+		}
+		if got != test.check {
+			t.Errorf("check digit of %s is %s, want %s", test.base, got, test.check)
+		}
+		if !validCUSIP(test.base + test.check) {
+			t.Errorf("%s is not valid", test.base+test.check)
+		}
+	}
+
+	for _, base := range []string{"1000A00", "10000A000", "10000a00", "10000A0-"} {
+		_, err := cusipCheckDigit(base)
+		if err == nil {
+			t.Errorf("%q has a check digit", base)
+		}
+	}
+	if validCUSIP("037833101") {
+		t.Error("a CUSIP with the wrong check digit is valid")
+	}
+}
+
+func TestCUSIPSeriesNumbering(t *testing.T) {
+	for _, test := range []struct {
+		series int
+		issue  string
+	}{
+		{0, "00"},
+		{9, "09"},
+		{10, "0A"},
+		{17, "0H"},
+		{18, "0J"},
+		{23, "0P"},
+		{33, "0Z"},
+		{34, "10"},
+		{34*34 - 1, "ZZ"},
+	} {
+		got, err := cusipIssueNumber(test.series)
+		if err != nil {
+			t.Fatalf("series %d: %v", test.series, err)
+		}
+		if got != test.issue {
+			t.Errorf("series %d is issue %s, want %s", test.series, got, test.issue)
+		}
+	}
+	for _, series := range []int{-1, 34 * 34} {
+		_, err := cusipIssueNumber(series)
+		if err == nil {
+			t.Errorf("series %d has an issue number", series)
+		}
+	}
+
+	account := Account{ID: "company1", IssuerCode: "10000A", CUSIPSeries: 9}
+	for _, want := range []string{"10000A09", "10000A0A", "10000A0B"} {
+		cusip, err := generateCUSIP(&account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cusip[:8] != want || !validCUSIP(cusip) {
+			t.Errorf("generated %s, want %s and a check digit", cusip, want)
+		}
+	}
+	if account.CUSIPSeries != 12 {
+		t.Errorf("the series is at %d, want 12", account.CUSIPSeries)
+	}
+
+	account.CUSIPSeries = 34 * 34
+	_, err := generateCUSIP(&account)
+	if err == nil {
+		t.Error("an issuer with every issue number used got another")
+	}
+}
+
+func TestCUSIPIssuerCode(t *testing.T) {
+	for _, test := range []struct {
+		sequence int
+		code     string
+	}{
+		{1, "000001"},
+		{34, "000010"},
+		{35, "000011"},
+		{34*34*34*34*34*34 - 1, "ZZZZZZ"},
+	} {
+		got, err := cusipIssuerCode(test.sequence)
+		if err != nil || got != test.code {
+			t.Errorf("issuer code of %d is %s (%v), want %s", test.sequence, got, err, test.code)
+		}
+	}
+
+	for _, sequence := range []int{-1, 34 * 34 * 34 * 34 * 34 * 34} {
+		_, err := cusipIssuerCode(sequence)
+		if err == nil {
+			t.Errorf("sequence %d has an issuer code", sequence)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"errors"
+	"math/big"
+	"time"
+)
+
+// Day-count conventions a paper can be priced with
+const (
+	dayCountActual360 = "ACT/360"
+	dayCountActual365 = "ACT/365"
+	dayCount30360     = "30/360"
+)
+
+// Paper issued without a convention is priced ACT/360, as it always was
+var defaultDayCount = dayCountActual360
+
+func validDayCount(convention string) bool {
+	switch convention {
+	case dayCountActual360, dayCountActual365, dayCount30360:
+		return true
+	}
+	return false
+}
+
+// utcDate drops the time of day so day counts are in whole calendar days
+func utcDate(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// actualDays counts calendar days from start to end
+func actualDays(start time.Time, end time.Time) int {
+	return int(utcDate(end).Sub(utcDate(start)).Hours() / 24)
+}
+
+// days30360 counts days from start to end on the 30/360 bond basis
+func days30360(start time.Time, end time.Time) int {
+	y1, m1, d1 := start.UTC().Date()
+	y2, m2, d2 := end.UTC().Date()
+
+	if d1 == 31 {
+		d1 = 30
+	}
+	if d2 == 31 && d1 == 30 {
+		d2 = 30
+	}
+
+	return 360*(y2-y1) + 30*(int(m2)-int(m1)) + (d2 - d1)
+}
+
+// dayCount returns the days between start and end and the days in the year
+// for a convention
+func dayCount(convention string, start time.Time, end time.Time) (int, int, error) {
+	if convention == "" {
+		convention = defaultDayCount
+	}
+
+	switch convention {
+	case dayCountActual360:
+		return actualDays(start, end), 360, nil
+	case dayCountActual365:
+		return actualDays(start, end), 365, nil
+	case dayCount30360:
+		return days30360(start, end), 360, nil
+	}
+	return 0, 0, errors.New("Unknown day count convention " + convention)
+}
+
+// yearFraction is the exact fraction of a year from start to end
+func yearFraction(convention string, start time.Time, end time.Time) (*big.Rat, error) {
+	days, basis, err := dayCount(convention, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return big.NewRat(int64(days), int64(basis)), nil
+}
+
+// paperPrice is what quantity units of cp are worth when settled on settle
+// at the given discount, using the days left to maturity under the paper's
+// day-count convention. Paper settled on or after maturity is worth par.
+// Interest-bearing paper is priced by priceFraction, discount as a yield.
+func paperPrice(cp CP, quantity int, discount Rate, settle time.Time) (Money, error) {
+	if interestBearing(cp) {
+		fraction, err := priceFraction(cp, discount, settle)
+		if err != nil {
+			return 0, err
+		}
+		return MoneyFromRat(new(big.Rat).Mul(cp.Par.Times(quantity).Rat(), fraction), RoundHalfEven)
+	}
+
+	maturity, err := maturityDate(cp)
+	if err != nil {
+		return 0, err
+	}
+	if settle.After(maturity) {
+		settle = maturity
+	}
+
+	fraction, err := yearFraction(cp.DayCount, settle, maturity)
+	if err != nil {
+		return 0, err
+	}
+
+	return discountedAmount(cp.Par.Times(quantity), discount, fraction, RoundHalfEven)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestDayCount(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	for _, test := range []struct {
+		convention string
+		start, end time.Time
+		days       int
+		basis      int
+	}{
+		{dayCountActual360, date(2026, 1, 1), date(2026, 1, 31), 30, 360},
+		{"", date(2026, 1, 1), date(2026, 1, 31), 30, 360},
+		{dayCountActual365, date(2024, 2, 1), date(2024, 3, 1), 29, 365},
+		{dayCountActual365, date(2026, 2, 1), date(2026, 3, 1), 28, 365},
+		{dayCountActual360, date(2026, 1, 1).Add(23 * time.Hour), date(2026, 1, 2).Add(time.Minute), 1, 360},
+		{dayCount30360, date(2026, 1, 31), date(2026, 2, 28), 28, 360},
+		{dayCount30360, date(2026, 1, 30), date(2026, 3, 31), 60, 360},
+		{dayCount30360, date(2026, 1, 15), date(2026, 3, 31), 76, 360},
+		{dayCount30360, date(2025, 12, 31), date(2026, 12, 31), 360, 360},
+	} {
+		days, basis, err := dayCount(test.convention, test.start, test.end)
+		if err != nil {
+			t.Fatalf("%q: %v", test.convention, err)
+		}
+		if days != test.days || basis != test.basis {
+			t.Errorf("%q from %s to %s is %d/%d, want %d/%d", test.convention, test.start, test.end, days, basis, test.days, test.basis)
+		}
+	}
+
+	_, _, err := dayCount("ACT/ACT", date(2026, 1, 1), date(2026, 2, 1))
+	if err == nil {
+		t.Error("an unknown convention counted days")
+	}
+}
+
+func TestDiscountedAmountRounding(t *testing.T) {
+	for _, test := range []struct {
+		face     Money
+		discount Rate
+		fraction *big.Rat
+		mode     RoundingMode
+		want     Money
+	}{
+		{100000, 5000000, big.NewRat(30, 360), RoundHalfEven, 99583},
+		{100000, 5000000, big.NewRat(30, 360), RoundUp, 99584},
+		{100000, 5000000, big.NewRat(30, 360), RoundDown, 99583},
+		{10000, 5000000, big.NewRat(90, 360), RoundHalfEven, 9875},
+		{10, 5000000, big.NewRat(180, 360), RoundHalfEven, 10},
+		{10, 5000000, big.NewRat(180, 360), RoundDown, 9},
+		{1, 50000000, big.NewRat(1, 1), RoundHalfEven, 0},
+		{1, 50000000, big.NewRat(1, 1), RoundHalfUp, 1},
+		{100000, 5000000, big.NewRat(0, 360), RoundHalfEven, 100000},
+	} {
+		got, err := discountedAmount(test.face, test.discount, test.fraction, test.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%s at %s%% over %s with mode %d is %s, want %s", test.face, test.discount, test.fraction.RatString(), test.mode, got, test.want)
+		}
+	}
+}
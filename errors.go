@@ -0,0 +1,156 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+)
+
+// Codes a ChaincodeError can carry. Clients match on these, so they must
+// not change once released.
+const (
+	codeBadArguments      = "BAD_ARGUMENTS"
+	codeInvalidRecord     = "INVALID_RECORD"
+	codeInvalidField      = "INVALID_FIELD"
+	codeNotFound          = "NOT_FOUND"
+	codeInvalidStatus     = "INVALID_STATUS"
+	codeConflict          = "CONFLICT"
+	codePermission        = "PERMISSION_DENIED"
+	codeUnknownFunction   = "UNKNOWN_FUNCTION"
+	codeStorage           = "STORAGE_ERROR"
+	codeInsufficientFunds = "INSUFFICIENT_FUNDS"
+	codeInsufficientPaper = "INSUFFICIENT_PAPER"
+	codeProgramLimit      = "PROGRAM_LIMIT"
+	codeFailed            = "FAILED"
+)
+
+// Entities that only appear in errors. Transfers have no record of their
+// own, and the others are never announced in events.
+const (
+	entityTransfer   = "Transfer"
+	entityHolding    = "Holding"
+	entityRequest    = "Request"
+	entityCollection = "Collection"
+	entityStatement  = "Statement"
+	entityVersion    = "Version"
+	entityIssuerCode = "IssuerCode"
+	entityJournal    = "JournalLine"
+	entityRecord     = "Record"
+	entityProgram    = "Program"
+)
+
+// ChaincodeError is returned to clients as JSON, so they can tell failures
+// apart by code instead of by message. Entity and Key name the record the
+// failure is about and Field the part of it that was wrong, when known.
+type ChaincodeError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Entity  string `json:"entity,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Field   string `json:"field,omitempty"`
+}
+
+func (e *ChaincodeError) Error() string {
+	errorBytes, err := json.Marshal(e)
+	if err != nil {
+		return e.Message
+	}
+	return string(errorBytes)
+}
+
+// newError builds a ChaincodeError
+func newError(code string, entity string, key string, field string, message string) *ChaincodeError {
+	return &ChaincodeError{Code: code, Message: message, Entity: entity, Key: key, Field: field}
+}
+
+// badArguments is returned when a function gets the wrong arguments
+func badArguments(function string, expecting string) *ChaincodeError {
+	return newError(codeBadArguments, "", function, "", "Incorrect number of arguments for "+function+". Expecting "+expecting)
+}
+
+// unknownFunction is returned for a function that isn't registered
+func unknownFunction(function string) *ChaincodeError {
+	return newError(codeUnknownFunction, "", function, "", "Received unknown function invocation "+function)
+}
+
+// invalidRecord is returned when a JSON argument can't be read as a record
+func invalidRecord(entity string, err error) *ChaincodeError {
+	return newError(codeInvalidRecord, entity, "", "", "Invalid "+entity+" record: "+err.Error())
+}
+
+// invalidField is returned when one field of a record is wrong
+func invalidField(entity string, key string, field string, message string) *ChaincodeError {
+	return newError(codeInvalidField, entity, key, field, message)
+}
+
+// invalidStatus is returned when a record's status doesn't allow a step
+func invalidStatus(entity string, key string, message string) *ChaincodeError {
+	return newError(codeInvalidStatus, entity, key, "status", message)
+}
+
+// notFound is returned when a record doesn't exist
+func notFound(entity string, key string) *ChaincodeError {
+	return newError(codeNotFound, entity, key, "", entity+" "+key+" does not exist")
+}
+
+// alreadyExists is returned when creating a record whose key is taken
+func alreadyExists(entity string, key string) *ChaincodeError {
+	return newError(codeConflict, entity, key, "", entity+" "+key+" already exists")
+}
+
+// insufficientFunds is returned when a company doesn't have the unreserved
+// cash to pay
+func insufficientFunds(company string, message string) *ChaincodeError {
+	return newError(codeInsufficientFunds, entityAccount, company, "cashBalance", message)
+}
+
+// insufficientPaper is returned when a company doesn't hold enough of a
+// paper that is free to sell, pledge or reserve
+func insufficientPaper(cusip string, message string) *ChaincodeError {
+	return newError(codeInsufficientPaper, entityCP, cusip, "owner", message)
+}
+
+// programLimit is returned when paper falls outside its issuer's program
+func programLimit(issuer string, field string, message string) *ChaincodeError {
+	return newError(codeProgramLimit, entityAccount, issuer, field, message)
+}
+
+// storageError is returned when reading, writing or decoding state fails
+func storageError(entity string, key string, action string) *ChaincodeError {
+	return newError(codeStorage, entity, key, "", "Error "+action+" "+entity+" "+key)
+}
+
+// timestampError is returned when the transaction time of a step on the
+// record entity key can't be read
+func timestampError(entity string, key string) *ChaincodeError {
+	return newError(codeStorage, entity, key, "", "Error getting the transaction timestamp")
+}
+
+// asChaincodeError gives every error returned to a client a code. Errors
+// from code that doesn't build a ChaincodeError yet are reported as FAILED.
+func asChaincodeError(err error) *ChaincodeError {
+	switch e := err.(type) {
+	case *ChaincodeError:
+		return e
+	case *PermissionError:
+		return &ChaincodeError{Code: codePermission, Message: e.Error(), Key: e.Function}
+	default:
+		return &ChaincodeError{Code: codeFailed, Message: err.Error()}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Entity types carried in events
+const (
+	entityCP            = "CP"
+	entityAccount       = "Account"
+	entityQuote         = "Quote"
+	entityLetterCredit  = "LetterOfCredit"
+	entityPurchaseOrder = "PurchaseOrder"
+	entityBillLading    = "BillOfLading"
+	entityProperty      = "Property"
+	entityNotification  = "Notification"
+	entityProposal      = "Proposal"
+	entityAgreement     = "SaleAgreement"
+	entityDeed          = "SaleDeed"
+	entityTrade         = "Trade"
+	entityOrder         = "Order"
+	entityAuction       = "Auction"
+	entityRepo          = "Repo"
+)
+
+// Actions an event can report. The event name is the entity type followed
+// by the action, such as CPIssued or QuoteStatusChanged.
+const (
+	actionCreated       = "Created"
+	actionUpdated       = "Updated"
+	actionIssued        = "Issued"
+	actionReopened      = "Reopened"
+	actionTransferred   = "Transferred"
+	actionRedeemed      = "Redeemed"
+	actionStatusChanged = "StatusChanged"
+	actionProposed      = "Proposed"
+	actionAccepted      = "Accepted"
+	actionSettled       = "Settled"
+	actionCancelled     = "Cancelled"
+	actionExpired       = "Expired"
+	actionPlaced        = "Placed"
+	actionFilled        = "Filled"
+	actionAnnounced     = "Announced"
+	actionBidReceived   = "BidReceived"
+	actionClosed        = "Closed"
+	actionDeposited     = "Deposited"
+	actionWithdrawn     = "Withdrawn"
+	actionFunded        = "Funded"
+	actionDefaulted     = "Defaulted"
+)
+
+// Fabric keeps a single event per transaction, so when one transaction
+// changes several entities they are sent together under this name with a
+// JSON array of events as the payload
+const batchEventName = "batch"
+
+// Event describes one state transition
+type Event struct {
+	Name       string `json:"name"`
+	EntityType string `json:"entityType"`
+	Key        string `json:"key"`
+	OldStatus  string `json:"oldStatus,omitempty"`
+	NewStatus  string `json:"newStatus,omitempty"`
+	Actor      string `json:"actor"`
+	TxID       string `json:"txId"`
+}
+
+// recordEvent queues an event to be sent when the transaction succeeds
+func recordEvent(stub shim.ChaincodeStubInterface, entityType string, action string, key string, oldStatus string, newStatus string) {
+	actor, err := callerCompany(stub)
+	if err != nil {
+		actor = ""
+	}
+
+	event := Event{
+		Name:       entityType + action,
+		EntityType: entityType,
+		Key:        key,
+		OldStatus:  oldStatus,
+		NewStatus:  newStatus,
+		Actor:      actor,
+		TxID:       stub.GetTxID(),
+	}
+	inv := invocationOf(stub)
+	if inv == nil {
+		fmt.Println("Not invoked, dropping event " + event.Name + " for " + key)
+		return
+	}
+	fmt.Println("Recording event " + event.Name + " for " + key)
+	inv.events = append(inv.events, event)
+}
+
+// flushEvents sends the events queued by the invoke
+func flushEvents(inv *invocation) error {
+	events := inv.events
+	if len(events) == 0 {
+		return nil
+	}
+
+	name := batchEventName
+	var payload []byte
+	var err error
+	if len(events) == 1 {
+		name = events[0].Name
+		payload, err = json.Marshal(&events[0])
+	} else {
+		payload, err = json.Marshal(&events)
+	}
+	if err != nil {
+		fmt.Println("Error marshalling events")
+		return err
+	}
+
+	fmt.Println("Setting event " + name)
+	return inv.SetEvent(name, payload)
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventsAreSentOnlyByTheInvokeThatRecordedThem(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "1")
+	s.events = nil
+
+	// The deposit in step 1 is undone with the batch, and so is its event
+	s.mustFail(codeInsufficientFunds, "batch", `[
+		{"function":"depositCash","args":["company1","5","in"]},
+		{"function":"withdrawCash","args":["company1","`+(initialCashBalance+Money(1000)).String()+`","out"]}
+	]`)
+	if len(s.events) != 0 {
+		t.Fatalf("a failed invoke sent %v", s.events)
+	}
+
+	s.mustInvoke("withdrawCash", "company1", "5", "out")
+	if want := []string{entityAccount + actionWithdrawn}; !reflect.DeepEqual(s.events, want) {
+		t.Fatalf("sent %v, want %v", s.events, want)
+	}
+}
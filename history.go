@@ -0,0 +1,174 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Versions of a record are stored under historyPrefix + key + ":" + version
+// and the last version written is kept under versionPrefix + key
+var historyPrefix = keyPrefix("history")
+var versionPrefix = keyPrefix("version")
+
+// Version is one write of a record, kept so auditors can see how it changed
+type Version struct {
+	Key       string          `json:"key"`
+	Version   int             `json:"version"`
+	TxID      string          `json:"txId"`
+	Timestamp string          `json:"timestamp"`
+	Caller    string          `json:"caller"`
+	Snapshot  json.RawMessage `json:"snapshot"`
+}
+
+// historyKey is the key version n of a record is stored under
+func historyKey(key string, n int) string {
+	return fmt.Sprintf("%s%s:%010d", historyPrefix, key, n)
+}
+
+// lastVersion is the number of versions recorded for a key
+func lastVersion(key string, stub shim.ChaincodeStubInterface) (int, error) {
+	versionBytes, err := stub.GetState(versionPrefix + key)
+	if err != nil {
+		fmt.Println("Error retrieving version of " + key)
+		return 0, storageError(entityVersion, key, "retrieving")
+	}
+	if versionBytes == nil {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(string(versionBytes))
+	if err != nil {
+		fmt.Println("Error reading version of " + key)
+		return 0, storageError(entityVersion, key, "reading")
+	}
+	return n, nil
+}
+
+// putState writes a record and appends a snapshot of it to the record's
+// version history
+func putState(stub shim.ChaincodeStubInterface, key string, value []byte) error {
+	err := stub.PutState(key, value)
+	if err != nil {
+		return err
+	}
+
+	n, err := lastVersion(key, stub)
+	if err != nil {
+		return err
+	}
+	n++
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting transaction time")
+		return timestampError(entityVersion, key)
+	}
+	caller, err := callerCompany(stub)
+	if err != nil {
+		caller = ""
+	}
+
+	version := Version{
+		Key:       key,
+		Version:   n,
+		TxID:      stub.GetTxID(),
+		Timestamp: timeToMs(now),
+		Caller:    caller,
+		Snapshot:  json.RawMessage(value),
+	}
+	versionBytes, err := json.Marshal(&version)
+	if err != nil {
+		fmt.Println("Error marshalling version of " + key)
+		return storageError(entityVersion, key, "marshalling")
+	}
+
+	err = stub.PutState(historyKey(key, n), versionBytes)
+	if err != nil {
+		fmt.Println("Error writing version of " + key)
+		return storageError(entityVersion, key, "writing")
+	}
+	err = stub.PutState(versionPrefix+key, []byte(strconv.Itoa(n)))
+	if err != nil {
+		fmt.Println("Error writing version of " + key)
+		return storageError(entityVersion, key, "writing")
+	}
+
+	return nil
+}
+
+// auditedPrefixes are the kinds of record whose history GetHistory
+// returns. Bookkeeping records such as versions and idempotency keys have
+// no audit trail of their own.
+var auditedPrefixes = []string{
+	cpPrefix,
+	accountPrefix,
+	quotePrefix,
+	letter_creditPrefix,
+	purchase_orderPrefix,
+	bill_ladingPrefix,
+	propertyPrefix,
+	proposalPrefix,
+	agreementPrefix,
+	deedPrefix,
+	notificationPrefix,
+	tradePrefix,
+	orderPrefix,
+	auctionPrefix,
+	auctionBidPrefix,
+	repoPrefix,
+}
+
+// GetHistory returns every version of a record, oldest first
+func GetHistory(key string, stub shim.ChaincodeStubInterface) ([]Version, error) {
+	var history []Version
+
+	audited := false
+	for _, prefix := range auditedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			audited = true
+			break
+		}
+	}
+	if !audited {
+		fmt.Println("No audit trail is kept for " + key)
+		return nil, invalidField(entityVersion, key, "key", "No audit trail is kept for "+key)
+	}
+
+	err := scanPrefix(stub, historyPrefix+key+":", func(versionKey string, value []byte) error {
+		var version Version
+		err := json.Unmarshal(value, &version)
+		if err != nil {
+			fmt.Println("Error unmarshalling " + versionKey)
+			return storageError(entityVersion, versionKey, "unmarshalling")
+		}
+		history = append(history, version)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
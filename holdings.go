@@ -0,0 +1,348 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A company's position in each paper is kept under holdingPrefix, keyed by
+// company then CUSIP so one range scan returns the whole portfolio
+var holdingPrefix = keyPrefix("holding")
+
+// Holding is how much of a paper a company holds and what it paid for it.
+// Paper an issuer holds of its own issue has no cost.
+type Holding struct {
+	Company   string `json:"company"`
+	CUSIP     string `json:"cusip"`
+	Quantity  int    `json:"quantity"`
+	CostBasis Money  `json:"costBasis"`
+}
+
+// Position is a holding valued at the paper's discount on a given day
+type Position struct {
+	CUSIP          string `json:"cusip"`
+	Ticker         string `json:"ticker"`
+	Quantity       int    `json:"quantity"`
+	CostBasis      Money  `json:"costBasis"`
+	Discount       Rate   `json:"discount"`
+	DaysToMaturity int    `json:"daysToMaturity"`
+	Value          Money  `json:"value"`
+}
+
+// Portfolio is every position of a company marked to market
+type Portfolio struct {
+	Company    string     `json:"company"`
+	AsOf       string     `json:"asOf"`
+	Positions  []Position `json:"positions"`
+	TotalCost  Money      `json:"totalCost"`
+	TotalValue Money      `json:"totalValue"`
+}
+
+func holdingKey(company string, cusip string) string {
+	return holdingPrefix + company + keySeparator + cusip
+}
+
+func GetHolding(company string, cusip string, stub shim.ChaincodeStubInterface) (Holding, error) {
+	holding := Holding{Company: company, CUSIP: cusip}
+
+	holdingBytes, err := stub.GetState(holdingKey(company, cusip))
+	if err != nil {
+		fmt.Println("Error retrieving holding of " + cusip + " for " + company)
+		return holding, newError(codeStorage, entityHolding, holdingKey(company, cusip), "", "Error retrieving holding of "+cusip+" for "+company)
+	}
+	if holdingBytes == nil {
+		return holding, nil
+	}
+
+	err = json.Unmarshal(holdingBytes, &holding)
+	if err != nil {
+		fmt.Println("Error unmarshalling holding of " + cusip + " for " + company)
+		return holding, newError(codeStorage, entityHolding, holdingKey(company, cusip), "", "Error unmarshalling holding of "+cusip+" for "+company)
+	}
+
+	return holding, nil
+}
+
+// PutHolding writes a holding, deleting it once nothing is held
+func PutHolding(holding Holding, stub shim.ChaincodeStubInterface) error {
+	key := holdingKey(holding.Company, holding.CUSIP)
+	if holding.Quantity == 0 {
+		err := stub.DelState(key)
+		if err != nil {
+			fmt.Println("Error deleting holding of " + holding.CUSIP + " for " + holding.Company)
+			return storageError(entityHolding, key, "deleting")
+		}
+		return nil
+	}
+
+	holdingBytes, err := json.Marshal(&holding)
+	if err != nil {
+		fmt.Println("Error marshalling holding of " + holding.CUSIP + " for " + holding.Company)
+		return storageError(entityHolding, key, "marshalling")
+	}
+
+	err = stub.PutState(key, holdingBytes)
+	if err != nil {
+		fmt.Println("Error writing holding of " + holding.CUSIP + " for " + holding.Company)
+		return storageError(entityHolding, key, "writing")
+	}
+
+	return nil
+}
+
+// adjustHolding adds quantity of a paper bought for cost to a company's
+// holding, or takes it away when quantity is negative, reducing the cost
+// basis in proportion. The account's asset list follows the holding; the
+// caller still has to write the account back.
+func adjustHolding(stub shim.ChaincodeStubInterface, account *Account, cusip string, quantity int, cost Money) error {
+	holding, err := GetHolding(account.ID, cusip, stub)
+	if err != nil {
+		return err
+	}
+
+	if quantity >= 0 {
+		holding.Quantity += quantity
+		holding.CostBasis += cost
+	} else {
+		if holding.Quantity < -quantity {
+			fmt.Println("The company " + account.ID + " holds only " + strconv.Itoa(holding.Quantity) + " of " + cusip)
+			return insufficientPaper(cusip, "The company "+account.ID+" holds only "+strconv.Itoa(holding.Quantity)+" of "+cusip)
+		}
+		holding.CostBasis -= Money(int64(holding.CostBasis) * int64(-quantity) / int64(holding.Quantity))
+		holding.Quantity += quantity
+	}
+
+	account.AssetsIds = removeAssetId(account.AssetsIds, cusip)
+	if holding.Quantity > 0 {
+		account.AssetsIds = append(account.AssetsIds, cusip)
+	}
+
+	return PutHolding(holding, stub)
+}
+
+// ownersMismatch says what is wrong with the owners of a paper, if they
+// can't be trusted to rebuild holdings from: positions that are negative
+// or don't add up to the paper's quantity, a company listed twice, or one
+// without an account
+func ownersMismatch(cp CP, stub shim.ChaincodeStubInterface) (string, error) {
+	total := 0
+	seen := map[string]bool{}
+	for _, owner := range cp.Owners {
+		if owner.Quantity < 0 || owner.Reserved < 0 || owner.Pledged < 0 || owner.available() < 0 {
+			return "invalid position for " + owner.Company, nil
+		}
+		if seen[owner.Company] {
+			return owner.Company + " is listed twice", nil
+		}
+		seen[owner.Company] = true
+		total += owner.Quantity
+
+		accountBytes, err := stub.GetState(accountPrefix + owner.Company)
+		if err != nil {
+			fmt.Println("Error retrieving account " + owner.Company)
+			return "", storageError(entityAccount, owner.Company, "retrieving")
+		}
+		if accountBytes == nil {
+			return "no account for " + owner.Company, nil
+		}
+	}
+	if total != cp.Qty {
+		return "owners hold " + strconv.Itoa(total) + " of " + strconv.Itoa(cp.Qty), nil
+	}
+	return "", nil
+}
+
+// rebuildHoldings recreates the holdings index and every account's asset
+// list from the owners recorded on each paper. Cost bases already in the
+// index are kept; positions the index didn't know about start at no cost.
+// Nothing is rebuilt while the owners of any paper are inconsistent.
+func (t *SimpleChaincode) rebuildHoldings(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	report := MigrationReport{Migrated: map[string]int{}}
+
+	held := map[string][]Holding{}
+	var mismatches []string
+	err := scanCollection(stub, collections["cp"], func(key string, value []byte) error {
+		var cp CP
+		err := json.Unmarshal(value, &cp)
+		if err != nil {
+			fmt.Println("Error unmarshalling cp " + key)
+			return storageError(entityCP, key, "unmarshalling")
+		}
+		if cp.Matured {
+			return nil
+		}
+
+		mismatch, err := ownersMismatch(cp, stub)
+		if err != nil {
+			return err
+		}
+		if mismatch != "" {
+			fmt.Println("The owners of " + cp.CUSIP + " are inconsistent: " + mismatch)
+			mismatches = append(mismatches, cp.CUSIP+" ("+mismatch+")")
+			return nil
+		}
+
+		for _, owner := range cp.Owners {
+			if owner.Quantity == 0 {
+				continue
+			}
+			holding, err := GetHolding(owner.Company, cp.CUSIP, stub)
+			if err != nil {
+				return err
+			}
+			if holding.Quantity != owner.Quantity {
+				holding.CostBasis = 0
+				holding.Quantity = owner.Quantity
+			}
+			held[owner.Company] = append(held[owner.Company], holding)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(mismatches) > 0 {
+		return nil, newError(codeInvalidRecord, entityCP, "", "owner", "Cannot rebuild holdings, the owners of these papers are inconsistent: "+strings.Join(mismatches, ", "))
+	}
+
+	holdingKeys, err := rangeKeys(stub, holdingPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range holdingKeys {
+		err = stub.DelState(key)
+		if err != nil {
+			fmt.Println("Error deleting holding " + key)
+			return nil, storageError(entityHolding, key, "deleting")
+		}
+	}
+
+	accountKeys, err := rangeKeys(stub, accountPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range accountKeys {
+		company, err := GetCompany(key[len(accountPrefix):], stub)
+		if err != nil {
+			return nil, err
+		}
+
+		company.AssetsIds = nil
+		for _, holding := range held[company.ID] {
+			company.AssetsIds = append(company.AssetsIds, holding.CUSIP)
+			err = PutHolding(holding, stub)
+			if err != nil {
+				return nil, err
+			}
+			report.Migrated["holding"]++
+		}
+
+		err = PutCompany(company, stub)
+		if err != nil {
+			return nil, err
+		}
+		report.Migrated["account"]++
+	}
+
+	fmt.Println("Rebuilt " + strconv.Itoa(report.Migrated["holding"]) + " holdings")
+	return json.Marshal(&report)
+}
+
+// GetPortfolio values every holding of a company at its paper's discount
+// for the days left to maturity on asOf
+func GetPortfolio(companyID string, asOf time.Time, stub shim.ChaincodeStubInterface) (Portfolio, error) {
+	portfolio := Portfolio{Company: companyID, AsOf: timeToMs(asOf), Positions: []Position{}}
+
+	_, err := GetCompany(companyID, stub)
+	if err != nil {
+		return portfolio, err
+	}
+
+	err = scanPrefix(stub, holdingPrefix+companyID+keySeparator, func(key string, value []byte) error {
+		var holding Holding
+		err := json.Unmarshal(value, &holding)
+		if err != nil {
+			fmt.Println("Error unmarshalling holding " + key)
+			return storageError(entityHolding, key, "unmarshalling")
+		}
+
+		cp, err := GetCP(cpPrefix+holding.CUSIP, stub)
+		if err != nil {
+			return err
+		}
+		maturity, err := maturityDate(cp)
+		if err != nil {
+			fmt.Println("Error reading the issue date of " + cp.CUSIP)
+			return invalidField(entityCP, cp.CUSIP, "issueDate", "Error reading the issue date of "+cp.CUSIP)
+		}
+
+		position := Position{
+			CUSIP:     cp.CUSIP,
+			Ticker:    cp.Ticker,
+			Quantity:  holding.Quantity,
+			CostBasis: holding.CostBasis,
+			Discount:  cp.Discount,
+		}
+		if asOf.Before(maturity) {
+			position.DaysToMaturity = actualDays(asOf, maturity)
+		}
+		position.Value, err = paperPrice(cp, holding.Quantity, cp.Discount, asOf)
+		if err != nil {
+			fmt.Println("Error pricing the paper " + cp.CUSIP)
+			return newError(codeFailed, entityCP, cp.CUSIP, "", "Error pricing the paper "+cp.CUSIP)
+		}
+
+		portfolio.TotalCost += position.CostBasis
+		portfolio.TotalValue += position.Value
+		portfolio.Positions = append(portfolio.Positions, position)
+		return nil
+	})
+
+	return portfolio, err
+}
+
+func queryPortfolio(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0         1
+			"company" "asOf" (optional, in milliseconds, defaults to the transaction time)
+	*/
+	err := requireCompany(stub, "GetPortfolio", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var asOf time.Time
+	if len(args) > 1 {
+		asOf, err = msToTime(args[1])
+	} else {
+		asOf, err = txTime(stub)
+	}
+	if err != nil {
+		fmt.Println("Error reading the valuation time")
+		return nil, invalidField(entityHolding, args[0], "asOf", "Error reading the valuation time, pass it in milliseconds")
+	}
+	portfolio, err := GetPortfolio(args[0], asOf, stub)
+	return queryResult("the portfolio", &portfolio, err)
+}
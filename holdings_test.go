@@ -0,0 +1,61 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRebuildHoldingsRejectsInconsistentOwners(t *testing.T) {
+	s, cusip := newMarket(t)
+	s.mustInvoke("transferPaper", `{"CUSIP":"`+cusip+`","fromCompany":"company1","toCompany":"company2","quantity":4}`)
+	s.mustInvoke("rebuildHoldings")
+	if got := s.company("company2").AssetsIds; len(got) != 1 || got[0] != cusip {
+		t.Fatalf("company2 holds %v, want %s", got, cusip)
+	}
+
+	for _, owners := range [][]Owner{
+		{{Company: "company1", Quantity: 6}, {Company: "company2", Quantity: 4}, {Company: "nobody", Quantity: 5}},
+		{{Company: "company1", Quantity: 6}, {Company: "company2", Quantity: 40}},
+		{{Company: "company1", Quantity: 6}, {Company: "company1", Quantity: 4}},
+		{{Company: "company1", Quantity: 14}, {Company: "company2", Quantity: -4}},
+	} {
+		cp := s.cp(cusip)
+		cp.Owners = owners
+		s.put(cpPrefix+cusip, cp)
+		s.mustFail(codeInvalidRecord, "rebuildHoldings")
+	}
+}
+
+func TestPortfolioCountsCalendarDaysToMaturity(t *testing.T) {
+	s, cusip := newMarket(t)
+
+	// Half a day after issue the paper still has 30 days to run
+	var portfolio Portfolio
+	s.mustQuery(&portfolio, "GetPortfolio", "company1", timeToMs(s.now.Add(12*time.Hour)))
+	for _, position := range portfolio.Positions {
+		if position.CUSIP == cusip && position.DaysToMaturity != 30 {
+			t.Fatalf("%s has %d days to maturity, want 30", cusip, position.DaysToMaturity)
+		}
+	}
+	if len(portfolio.Positions) == 0 {
+		t.Fatal("company1 has no positions")
+	}
+}
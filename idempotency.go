@@ -0,0 +1,170 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Each invoke made with an idempotency key is recorded under requestPrefix
+// and the caller's company, so a retry of it returns the first result
+// instead of running again. Companies can't see or collide with each
+// other's keys.
+var requestPrefix = keyPrefix("request")
+
+// An invoke takes an idempotency key as an extra argument of this form,
+// which is removed before the function sees its arguments
+const idempotencyArg = "idempotencyKey="
+
+// Request is an invoke made with an idempotency key and what it returned
+type Request struct {
+	Company   string `json:"company"`
+	Key       string `json:"key"`
+	Function  string `json:"function"`
+	Digest    string `json:"digest"`
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	Result    []byte `json:"result"`
+}
+
+// idempotencyKey takes the idempotency key out of an invoke's arguments
+func idempotencyKey(args []string) (string, []string, error) {
+	key := ""
+	var rest []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, idempotencyArg) {
+			rest = append(rest, arg)
+			continue
+		}
+		if key != "" {
+			return "", nil, invalidField(entityRequest, key, "key", "Only one "+strings.TrimSuffix(idempotencyArg, "=")+" can be given")
+		}
+		key = strings.TrimPrefix(arg, idempotencyArg)
+		if key == "" {
+			return "", nil, invalidField(entityRequest, "", "key", "The "+strings.TrimSuffix(idempotencyArg, "=")+" cannot be empty")
+		}
+	}
+	return key, rest, nil
+}
+
+// requestDigest identifies a function and its arguments, so a key reused
+// for a different invoke is caught
+func requestDigest(function string, args []string) string {
+	callBytes, _ := json.Marshal(append([]string{function}, args...))
+	sum := sha256.Sum256(callBytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// requestKey is where the caller's invoke with an idempotency key is kept
+func requestKey(stub shim.ChaincodeStubInterface, key string) (string, string, error) {
+	company, err := callerCompany(stub)
+	if err != nil || company == "" {
+		return "", "", newError(codePermission, entityRequest, key, "", "Idempotency keys can only be used by callers with a "+companyAttribute+" attribute")
+	}
+	return company, requestPrefix + company + keySeparator + key, nil
+}
+
+// GetRequest returns the invoke the caller recorded for a key, or nil when
+// there is none
+func GetRequest(key string, stub shim.ChaincodeStubInterface) (*Request, error) {
+	_, stateKey, err := requestKey(stub, key)
+	if err != nil {
+		return nil, err
+	}
+
+	requestBytes, err := stub.GetState(stateKey)
+	if err != nil {
+		fmt.Println("Error retrieving request " + key)
+		return nil, storageError(entityRequest, key, "retrieving")
+	}
+	if requestBytes == nil {
+		return nil, nil
+	}
+
+	var request Request
+	err = json.Unmarshal(requestBytes, &request)
+	if err != nil {
+		fmt.Println("Error unmarshalling request " + key)
+		return nil, storageError(entityRequest, key, "unmarshalling")
+	}
+	return &request, nil
+}
+
+// replayRequest returns the invoke already made with key, if there was
+// one. It is an error to reuse a key for a different invoke.
+func replayRequest(stub shim.ChaincodeStubInterface, key string, function string, args []string) (*Request, error) {
+	request, err := GetRequest(key, stub)
+	if err != nil || request == nil {
+		return nil, err
+	}
+
+	if request.Function != function || request.Digest != requestDigest(function, args) {
+		fmt.Println("Idempotency key " + key + " was used for another request")
+		return nil, newError(codeConflict, entityRequest, key, "", "The idempotency key "+key+" was already used by transaction "+request.TxID+" for a different "+request.Function+" request")
+	}
+	return request, nil
+}
+
+// recordRequest keeps the result of an invoke made with key
+func recordRequest(stub shim.ChaincodeStubInterface, key string, function string, args []string, result []byte) error {
+	company, stateKey, err := requestKey(stub, key)
+	if err != nil {
+		return err
+	}
+	timestamp, err := stampTime(stub, entityRequest, key, "timestamp", "")
+	if err != nil {
+		return err
+	}
+
+	request := Request{
+		Company:   company,
+		Key:       key,
+		Function:  function,
+		Digest:    requestDigest(function, args),
+		TxID:      stub.GetTxID(),
+		Timestamp: timestamp,
+		Result:    result,
+	}
+	requestBytes, err := json.Marshal(&request)
+	if err != nil {
+		fmt.Println("Error marshalling request " + key)
+		return storageError(entityRequest, key, "marshalling")
+	}
+
+	err = stub.PutState(stateKey, requestBytes)
+	if err != nil {
+		fmt.Println("Error writing request " + key)
+		return storageError(entityRequest, key, "writing")
+	}
+	return nil
+}
+
+func queryRequest(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	request, err := GetRequest(args[0], stub)
+	if err == nil && request == nil {
+		err = notFound(entityRequest, args[0])
+	}
+	return queryResult("the request", request, err)
+}
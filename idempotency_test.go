@@ -0,0 +1,46 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import "testing"
+
+func TestIdempotencyKeysBelongToTheCaller(t *testing.T) {
+	s, _ := newMarket(t)
+	quote := func(quoteNo string) string { return `{"quoteNo":"` + quoteNo + `","qty":"3"}` }
+
+	s.as(roleIssuer, "company1")
+	s.mustInvoke("issueQuote", quote("Q1"), idempotencyArg+"k1")
+	s.mustInvoke("issueQuote", quote("Q1"), idempotencyArg+"k1")
+	s.mustFail(codeConflict, "issueQuote", quote("Q2"), idempotencyArg+"k1")
+
+	// Another company's key of the same name is its own
+	s.as(roleInvestor, "company2")
+	s.mustInvoke("issueQuote", quote("Q2"), idempotencyArg+"k1")
+
+	var quotes []Quote
+	s.mustQuery(&quotes, "GetAllQuotes")
+	if len(quotes) != 2 {
+		t.Fatalf("got %d quotes, want 2", len(quotes))
+	}
+	var request Request
+	s.mustQuery(&request, "GetRequest", "k1")
+	if request.Company != "company2" || request.Digest != requestDigest("issueQuote", []string{quote("Q2")}) {
+		t.Fatalf("company2 sees request %+v", request)
+	}
+}
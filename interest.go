@@ -0,0 +1,156 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"errors"
+	"math/big"
+	"time"
+)
+
+// Kinds of paper. Discount paper is sold below par and repaid at par;
+// interest-bearing paper pays par plus a coupon accrued from issue, all at
+// maturity. Records written before the instrument type existed have none
+// and are discount paper.
+const (
+	instrumentDiscount = "discount"
+	instrumentInterest = "interest"
+)
+
+func instrumentOf(cp CP) string {
+	if cp.InstrumentType == "" {
+		return instrumentDiscount
+	}
+	return cp.InstrumentType
+}
+
+func interestBearing(cp CP) bool {
+	return instrumentOf(cp) == instrumentInterest
+}
+
+// checkInstrument makes sure a paper's coupon fits its instrument type
+func checkInstrument(cp CP) error {
+	switch instrumentOf(cp) {
+	case instrumentDiscount:
+		if cp.Coupon != 0 {
+			return errors.New("Discount paper cannot have a coupon")
+		}
+	case instrumentInterest:
+		if cp.Coupon <= 0 {
+			return errors.New("Interest-bearing paper needs a coupon")
+		}
+	default:
+		return errors.New("Unknown instrument type " + cp.InstrumentType)
+	}
+	return nil
+}
+
+// redemptionFraction is what a paper repays at maturity per unit of par:
+// 1 for discount paper, 1 + coupon * term for interest-bearing paper
+func redemptionFraction(cp CP) (*big.Rat, error) {
+	if !interestBearing(cp) {
+		return big.NewRat(1, 1), nil
+	}
+
+	issued, err := msToTime(cp.IssueDate)
+	if err != nil {
+		return nil, err
+	}
+	maturity, err := maturityDate(cp)
+	if err != nil {
+		return nil, err
+	}
+	term, err := yearFraction(cp.DayCount, issued, maturity)
+	if err != nil {
+		return nil, err
+	}
+
+	interest := new(big.Rat).Mul(cp.Coupon.Fraction(), term)
+	return interest.Add(interest, big.NewRat(1, 1)), nil
+}
+
+// redemptionAmount is what the issuer owes for quantity units at maturity
+func redemptionAmount(cp CP, quantity int) (Money, error) {
+	fraction, err := redemptionFraction(cp)
+	if err != nil {
+		return 0, err
+	}
+	return MoneyFromRat(new(big.Rat).Mul(cp.Par.Times(quantity).Rat(), fraction), RoundHalfEven)
+}
+
+// accruedInterest is the coupon earned by quantity units from issue to settle
+func accruedInterest(cp CP, quantity int, settle time.Time) (Money, error) {
+	if !interestBearing(cp) {
+		return 0, nil
+	}
+
+	issued, err := msToTime(cp.IssueDate)
+	if err != nil {
+		return 0, err
+	}
+	maturity, err := maturityDate(cp)
+	if err != nil {
+		return 0, err
+	}
+	if settle.After(maturity) {
+		settle = maturity
+	}
+	if settle.Before(issued) {
+		settle = issued
+	}
+
+	elapsed, err := yearFraction(cp.DayCount, issued, settle)
+	if err != nil {
+		return 0, err
+	}
+	interest := new(big.Rat).Mul(cp.Coupon.Fraction(), elapsed)
+	return MoneyFromRat(interest.Mul(interest, cp.Par.Times(quantity).Rat()), RoundHalfEven)
+}
+
+// priceFraction is what a paper is worth per unit of par when settled on
+// settle at rate. Discount paper is priced 1 - rate * t, and
+// interest-bearing paper discounts its redemption at rate as a money-market
+// yield, (1 + coupon * term) / (1 + rate * t), so the price includes the
+// interest accrued so far. t is the fraction of a year left to maturity
+// under the paper's day count.
+func priceFraction(cp CP, rate Rate, settle time.Time) (*big.Rat, error) {
+	maturity, err := maturityDate(cp)
+	if err != nil {
+		return nil, err
+	}
+	if settle.After(maturity) {
+		settle = maturity
+	}
+
+	remaining, err := yearFraction(cp.DayCount, settle, maturity)
+	if err != nil {
+		return nil, err
+	}
+	term := new(big.Rat).Mul(rate.Fraction(), remaining)
+
+	if !interestBearing(cp) {
+		return term.Sub(big.NewRat(1, 1), term), nil
+	}
+
+	redemption, err := redemptionFraction(cp)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Quo(redemption, term.Add(term, big.NewRat(1, 1))), nil
+}
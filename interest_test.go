@@ -0,0 +1,85 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterestBearingPaperPaysItsCoupon(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "2")
+	s.mustInvoke("setProgram", "company1", `{"authorized":100000}`)
+	cusip := s.issue(`{"ticker":"ABC","par":1000,"qty":10,"discount":6,"maturity":180,"issuer":"company1",
+		"instrumentType":"interest","coupon":6}`)
+
+	// Halfway through, a unit has earned 1000 * 6% * 90/360 = 15.00 and is
+	// worth 1000 * (1 + 6% * 180/360) / (1 + 6% * 90/360) = 1014.78
+	s.now = s.now.Add(90 * 24 * time.Hour)
+	var analytics YieldAnalytics
+	s.mustQuery(&analytics, "GetYield", cusip, timeToMs(s.now))
+	if analytics.AccruedInterest != Money(1500) || analytics.Price != Money(101478) {
+		t.Fatalf("a unit is priced at %v with %v accrued, want 1014.78 with 15.00", analytics.Price, analytics.AccruedInterest)
+	}
+
+	before := s.company("company2").CashBalance
+	s.mustInvoke("transferPaper", `{"CUSIP":"`+cusip+`","fromCompany":"company1","toCompany":"company2","quantity":2}`)
+	if paid := before - s.company("company2").CashBalance; paid != Money(202956) {
+		t.Fatalf("company2 paid %v for 2 units, want 2029.56 including the accrued interest", paid)
+	}
+
+	// At maturity each unit repays 1000 + 1000 * 6% * 180/360 = 1030.00
+	s.now = s.now.Add(90 * 24 * time.Hour)
+	before = s.company("company2").CashBalance
+	s.mustInvoke("redeemPaper", cusip)
+	if received := s.company("company2").CashBalance - before; received != Money(206000) {
+		t.Fatalf("company2 received %v for 2 units, want 2060.00 of principal and coupon", received)
+	}
+}
+
+func TestPaperWithoutInstrumentTypeIsDiscountPaper(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "1")
+
+	// A record written before instrument types and coupons existed
+	s.put(cpPrefix+"1000A0019", map[string]interface{}{
+		"cusip":     "1000A0019",
+		"ticker":    "OLD",
+		"par":       1000,
+		"qty":       10,
+		"discount":  5,
+		"maturity":  90,
+		"issuer":    "company1",
+		"issueDate": timeToMs(s.now),
+		"owner":     []map[string]interface{}{{"company": "company1", "quantity": 10}},
+	})
+
+	cp := s.cp("1000A0019")
+	if instrumentOf(cp) != instrumentDiscount || interestBearing(cp) || cp.Coupon != 0 {
+		t.Fatalf("the legacy paper reads as %q with a coupon of %v, want discount paper", cp.InstrumentType, cp.Coupon)
+	}
+
+	// 1000 * (1 - 5% * 90/360) = 987.50, repaying par
+	var analytics YieldAnalytics
+	s.mustQuery(&analytics, "GetYield", "1000A0019", timeToMs(s.now))
+	if analytics.InstrumentType != instrumentDiscount || analytics.Price != Money(98750) || analytics.Redemption != Money(100000) || analytics.AccruedInterest != 0 {
+		t.Fatalf("the legacy paper is analysed as %+v, want discount paper at 987.50 repaying 1000.00", analytics)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// invocation is the stub Invoke hands down to the handlers. Besides the
+// ledger it carries what one invoke collects as it runs, so nothing about
+// a transaction is kept between calls or shared with another.
+type invocation struct {
+	shim.ChaincodeStubInterface
+
+	// The step a batch is on, 0 outside a batch
+	step int
+
+	// Events recorded so far, sent once the invoke succeeds
+	events []Event
+}
+
+// newInvocation starts the context of one invoke
+func newInvocation(stub shim.ChaincodeStubInterface) *invocation {
+	return &invocation{ChaincodeStubInterface: stub}
+}
+
+// invocationOf is the context a stub was handed down with, nil when it was
+// not called through Invoke
+func invocationOf(stub shim.ChaincodeStubInterface) *invocation {
+	inv, _ := stub.(*invocation)
+	return inv
+}
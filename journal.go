@@ -0,0 +1,379 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Every change to a cash balance is a journal entry of two lines, a debit
+// on the account the cash leaves and a credit on the account it reaches.
+// Lines are kept per account in entry order under journalPrefix. Each
+// account numbers its own lines, so transactions on different accounts
+// never write the same key.
+var journalPrefix = keyPrefix("journal")
+
+// cashExternal is the other side of cash entering or leaving the ledger,
+// through deposits, withdrawals and the opening balance of new accounts
+const cashExternal = "external"
+
+// JournalLine is one side of a journal entry. Entry numbers the lines of
+// an account; lines on the external side take the number of the account
+// on the other side.
+type JournalLine struct {
+	Entry        int    `json:"entry"`
+	Company      string `json:"company"`
+	Counterparty string `json:"counterparty"`
+	Debit        Money  `json:"debit"`
+	Credit       Money  `json:"credit"`
+	Reference    string `json:"reference"`
+	TxID         string `json:"txId"`
+	Timestamp    string `json:"timestamp"`
+	Balance      Money  `json:"balance"`
+}
+
+// Statement is the journal of one account over a period, with the balances
+// rebuilt from the journal lines
+type Statement struct {
+	Company string        `json:"company"`
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Opening Money         `json:"opening"`
+	Debits  Money         `json:"debits"`
+	Credits Money         `json:"credits"`
+	Closing Money         `json:"closing"`
+	Lines   []JournalLine `json:"lines"`
+}
+
+func journalKey(company string, entry int) string {
+	return fmt.Sprintf("%s%s%s%010d", journalPrefix, company, keySeparator, entry)
+}
+
+// journalLineKey is where a line is kept. The external side has no account
+// to number its lines, so they are kept in time order, then by the
+// account on the other side and its number for the line.
+func journalLineKey(line JournalLine) string {
+	if line.Company != cashExternal {
+		return journalKey(line.Company, line.Entry)
+	}
+	return fmt.Sprintf("%s%s%s%019s%s%s%s%010d", journalPrefix, cashExternal, keySeparator, line.Timestamp, keySeparator, line.Counterparty, keySeparator, line.Entry)
+}
+
+// nextJournalEntry numbers the next line of an account. Accounts journalled
+// before they kept a count carry on from their last line.
+func nextJournalEntry(account *Account, stub shim.ChaincodeStubInterface) error {
+	if account.JournalEntries == 0 {
+		prefix := journalPrefix + account.ID + keySeparator
+		err := scanPrefix(stub, prefix, func(key string, value []byte) error {
+			entry, err := strconv.Atoi(key[len(prefix):])
+			if err != nil {
+				fmt.Println("Error reading journal line " + key)
+				return newError(codeStorage, entityStatement, key, "", "Error reading journal line "+key)
+			}
+			if entry > account.JournalEntries {
+				account.JournalEntries = entry
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	account.JournalEntries++
+	return nil
+}
+
+func putJournalLine(line JournalLine, stub shim.ChaincodeStubInterface) error {
+	lineBytes, err := json.Marshal(&line)
+	if err != nil {
+		fmt.Println("Error marshalling journal line for " + line.Company)
+		return storageError(entityJournal, journalLineKey(line), "marshalling")
+	}
+
+	err = stub.PutState(journalLineKey(line), lineBytes)
+	if err != nil {
+		fmt.Println("Error writing journal line for " + line.Company)
+		return storageError(entityJournal, journalLineKey(line), "writing")
+	}
+
+	return nil
+}
+
+// moveCash moves amount from one account to the other and journals it. A
+// nil account stands for cash outside the ledger. The caller still has to
+// write the accounts back.
+func moveCash(stub shim.ChaincodeStubInterface, from *Account, to *Account, amount Money, reference string) error {
+	if amount < 0 {
+		return invalidField(entityJournal, reference, "amount", "Cannot move a negative amount of cash")
+	}
+	if amount == 0 {
+		return nil
+	}
+
+	debited, credited := cashExternal, cashExternal
+	if from != nil {
+		debited = from.ID
+	}
+	if to != nil {
+		credited = to.ID
+	}
+	if debited == credited {
+		return invalidField(entityJournal, reference, "counterparty", "Cannot move cash from "+debited+" to itself")
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction time")
+		return timestampError(entityJournal, reference)
+	}
+	debit := JournalLine{
+		Company:      debited,
+		Counterparty: credited,
+		Debit:        amount,
+		Reference:    reference,
+		TxID:         stub.GetTxID(),
+		Timestamp:    timeToMs(now),
+	}
+	credit := debit
+	credit.Company, credit.Counterparty = credited, debited
+	credit.Debit, credit.Credit = 0, amount
+
+	if from != nil {
+		err = nextJournalEntry(from, stub)
+		if err != nil {
+			return err
+		}
+		from.CashBalance -= amount
+		debit.Entry = from.JournalEntries
+		debit.Balance = from.CashBalance
+	}
+	if to != nil {
+		err = nextJournalEntry(to, stub)
+		if err != nil {
+			return err
+		}
+		to.CashBalance += amount
+		credit.Entry = to.JournalEntries
+		credit.Balance = to.CashBalance
+	}
+	if from == nil {
+		debit.Entry = credit.Entry
+	}
+	if to == nil {
+		credit.Entry = debit.Entry
+	}
+
+	err = putJournalLine(debit, stub)
+	if err != nil {
+		return err
+	}
+	err = putJournalLine(credit, stub)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Journal entry " + reference + ": " + amount.String() + " from " + debited + " to " + credited)
+	return nil
+}
+
+// hasJournal reports whether any cash movement was journalled for company
+func hasJournal(company string, stub shim.ChaincodeStubInterface) (bool, error) {
+	found := false
+	prefix := journalPrefix + company + keySeparator
+	err := scanRange(stub, prefix, prefix, func(key string, value []byte) (bool, error) {
+		found = true
+		return false, nil
+	})
+	return found, err
+}
+
+// cashArgs reads the company, amount and reference of a deposit or withdrawal
+func cashArgs(stub shim.ChaincodeStubInterface, function string, args []string) (Account, Money, string, error) {
+	var company Account
+	if len(args) != 3 {
+		return company, 0, "", badArguments(function, "company, amount and reference")
+	}
+
+	amount, err := ParseMoney(args[1], jsonRoundingMode)
+	if err != nil || amount <= 0 {
+		fmt.Println("Invalid amount " + args[1])
+		return company, 0, "", invalidField(entityAccount, args[0], "amount", "Invalid amount "+args[1])
+	}
+	if args[2] == "" {
+		return company, 0, "", invalidField(entityAccount, args[0], "reference", "A reference is required")
+	}
+
+	company, err = GetCompany(args[0], stub)
+	return company, amount, args[2], err
+}
+
+func (t *SimpleChaincode) depositCash(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0			1			2
+		company		amount		reference
+	*/
+	company, amount, reference, err := cashArgs(stub, "depositCash", args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveCash(stub, nil, &company, amount, reference)
+	if err != nil {
+		return nil, err
+	}
+	err = PutCompany(company, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityAccount, actionDeposited, accountPrefix+company.ID, "", "")
+	fmt.Println("Deposited " + amount.String() + " to " + company.ID)
+	return nil, nil
+}
+
+func (t *SimpleChaincode) withdrawCash(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0			1			2
+		company		amount		reference
+	*/
+	company, amount, reference, err := cashArgs(stub, "withdrawCash", args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cash set aside for open trades and bids can't be withdrawn
+	if company.availableCash() < amount {
+		fmt.Println("The company " + company.ID + " doesn't have enough cash")
+		return nil, insufficientFunds(company.ID, "The company "+company.ID+" only has "+company.availableCash().String()+" available to withdraw")
+	}
+
+	err = moveCash(stub, &company, nil, amount, reference)
+	if err != nil {
+		return nil, err
+	}
+	err = PutCompany(company, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityAccount, actionWithdrawn, accountPrefix+company.ID, "", "")
+	fmt.Println("Withdrew " + amount.String() + " from " + company.ID)
+	return nil, nil
+}
+
+// openJournals writes an opening balance entry for every account created
+// before cash movements were journalled, so their statements reconcile
+func (t *SimpleChaincode) openJournals(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	report := MigrationReport{Migrated: map[string]int{}}
+
+	accountKeys, err := rangeKeys(stub, accountPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range accountKeys {
+		company, err := GetCompany(key[len(accountPrefix):], stub)
+		if err != nil {
+			return nil, err
+		}
+		journalled, err := hasJournal(company.ID, stub)
+		if err != nil {
+			return nil, err
+		}
+		if journalled || company.CashBalance <= 0 {
+			continue
+		}
+
+		// moveCash adds to the balance, so start the account from zero
+		balance := company.CashBalance
+		company.CashBalance = 0
+		err = moveCash(stub, nil, &company, balance, "opening balance")
+		if err != nil {
+			return nil, err
+		}
+		err = PutCompany(company, stub)
+		if err != nil {
+			return nil, err
+		}
+		report.Migrated["account"]++
+	}
+
+	fmt.Println("Opened journals for " + strconv.Itoa(report.Migrated["account"]) + " accounts")
+	return json.Marshal(&report)
+}
+
+// GetStatement lists the journal lines of an account between two times in
+// milliseconds, rebuilding the running balance from the first entry
+func GetStatement(company string, from string, to string, stub shim.ChaincodeStubInterface) (Statement, error) {
+	statement := Statement{Company: company, From: from, To: to, Lines: []JournalLine{}}
+
+	start, err := msToTime(from)
+	if err != nil {
+		return statement, invalidField(entityStatement, company, "from", "Invalid start time "+from)
+	}
+	end, err := msToTime(to)
+	if err != nil {
+		return statement, invalidField(entityStatement, company, "to", "Invalid end time "+to)
+	}
+	if end.Before(start) {
+		return statement, invalidField(entityStatement, company, "to", "The statement ends before it starts")
+	}
+
+	var balance Money
+	prefix := journalPrefix + company + keySeparator
+	err = scanPrefix(stub, prefix, func(key string, value []byte) error {
+		var line JournalLine
+		err := json.Unmarshal(value, &line)
+		if err != nil {
+			fmt.Println("Error unmarshalling journal line " + key)
+			return newError(codeStorage, entityStatement, key, "", "Error unmarshalling journal line "+key)
+		}
+		at, err := msToTime(line.Timestamp)
+		if err != nil {
+			return newError(codeStorage, entityStatement, key, "timestamp", "Invalid time on journal line "+key)
+		}
+
+		if at.Before(start) {
+			statement.Opening += line.Credit - line.Debit
+		}
+		balance += line.Credit - line.Debit
+		line.Balance = balance
+		if inPeriod(at, start, end) {
+			statement.Debits += line.Debit
+			statement.Credits += line.Credit
+			statement.Lines = append(statement.Lines, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return statement, err
+	}
+
+	statement.Closing = statement.Opening + statement.Credits - statement.Debits
+	return statement, nil
+}
+
+// inPeriod reports whether t falls between start and end inclusive
+func inPeriod(t time.Time, start time.Time, end time.Time) bool {
+	return !t.Before(start) && !t.After(end)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Keys are made of the kind of record, the version of the key scheme and
+// the record's ID, separated by colons, e.g. "cp:v1:10000A007"
+const (
+	keySeparator     = ":"
+	keySchemeVersion = "v1"
+)
+
+// keyPrefix is the prefix every key of a kind of record starts with
+func keyPrefix(kind string) string {
+	return kind + keySeparator + keySchemeVersion + keySeparator
+}
+
+// keyKind is the kind of record a prefix made by keyPrefix is for
+func keyKind(prefix string) string {
+	return strings.TrimSuffix(prefix, keySeparator+keySchemeVersion+keySeparator)
+}
+
+// keyPrefixes lists the prefix of every kind of record in the state
+func keyPrefixes() []string {
+	return []string{
+		cpPrefix,
+		accountPrefix,
+		issuerCodePrefix,
+		issuerSequencePrefix,
+		quotePrefix,
+		letter_creditPrefix,
+		purchase_orderPrefix,
+		bill_ladingPrefix,
+		propertyPrefix,
+		proposalPrefix,
+		agreementPrefix,
+		deedPrefix,
+		notificationPrefix,
+		tradePrefix,
+		orderPrefix,
+		bookPrefix,
+		auctionPrefix,
+		auctionBidPrefix,
+		journalPrefix,
+		holdingPrefix,
+		repoPrefix,
+		requestPrefix,
+		historyPrefix,
+		versionPrefix,
+	}
+}
+
+// checkKeyPrefixes makes sure no two kinds of record can write the same key:
+// every prefix must name a kind, and none may start with another
+func checkKeyPrefixes(prefixes []string) error {
+	for i, prefix := range prefixes {
+		kind := keyKind(prefix)
+		if kind == "" || kind == prefix || strings.Contains(kind, keySeparator) {
+			return errors.New("Invalid key prefix " + prefix)
+		}
+
+		for _, other := range prefixes[i+1:] {
+			if strings.HasPrefix(other, prefix) || strings.HasPrefix(prefix, other) {
+				return fmt.Errorf("Key prefixes %s and %s overlap", prefix, other)
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasKeyPrefix reports whether key belongs to one of the kinds of record
+func hasKeyPrefix(key string) bool {
+	for _, prefix := range keyPrefixes() {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAccountID makes sure a company ID can go into a composite key such as
+// "jl:v1:company:0000000001" without running into another company's keys
+func checkAccountID(id string) error {
+	if id == "" {
+		return invalidField(entityAccount, id, "id", "A company ID may not be empty")
+	}
+	if strings.Contains(id, keySeparator) {
+		return invalidField(entityAccount, id, "id", "A company ID may not contain "+keySeparator)
+	}
+	return nil
+}
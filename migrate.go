@@ -0,0 +1,336 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// MigrationReport lists how many records of each kind a migration rewrote
+// and the keys it had to leave alone
+type MigrationReport struct {
+	Migrated map[string]int `json:"migrated"`
+	Skipped  []string       `json:"skipped"`
+}
+
+// rewriteRecords decodes each key into a fresh record and writes it back in
+// its current JSON form. Records that no longer decode are reported as skipped.
+func rewriteRecords(stub shim.ChaincodeStubInterface, kind string, keys []string, newRecord func() interface{}, report *MigrationReport) error {
+	for _, key := range keys {
+		recordBytes, err := stub.GetState(key)
+		if err != nil {
+			fmt.Println("Error retrieving " + key)
+			return storageError(entityRecord, key, "retrieving")
+		}
+		if recordBytes == nil {
+			continue
+		}
+
+		record := newRecord()
+		err = json.Unmarshal(recordBytes, record)
+		if err != nil {
+			fmt.Println("Skipping " + key + ": " + err.Error())
+			report.Skipped = append(report.Skipped, key)
+			continue
+		}
+
+		recordBytes, err = json.Marshal(record)
+		if err != nil {
+			fmt.Println("Error marshalling " + key)
+			return storageError(entityRecord, key, "marshalling")
+		}
+		err = putState(stub, key, recordBytes)
+		if err != nil {
+			fmt.Println("Error writing " + key)
+			return storageError(entityRecord, key, "writing")
+		}
+
+		report.Migrated[kind]++
+	}
+
+	return nil
+}
+
+// migrateMoney rewrites every record holding an amount so that float64
+// balances and free-text amounts are stored as exact decimal strings.
+// Legacy values still decode without it, rounded half-even to the cent.
+// Only records under the namespaced prefixes are rewritten, so migrateKeys
+// has to run first; records it skipped keep their legacy amounts.
+func (t *SimpleChaincode) migrateMoney(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	report := MigrationReport{Migrated: map[string]int{}}
+
+	accountKeys, err := rangeKeys(stub, accountPrefix)
+	if err != nil {
+		return nil, err
+	}
+	err = rewriteRecords(stub, "account", accountKeys, func() interface{} { return new(Account) }, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []struct {
+		kind      string
+		newRecord func() interface{}
+	}{
+		{"cp", func() interface{} { return new(CP) }},
+		{"quote", func() interface{} { return new(Quote) }},
+		{"lc", func() interface{} { return new(Letter_Credit) }},
+		{"po", func() interface{} { return new(PurchaseOrder) }},
+		{"bl", func() interface{} { return new(Bill_Lading) }},
+		{"proposal", func() interface{} { return new(Proposal) }},
+		{"agreement", func() interface{} { return new(SaleAgreement) }},
+		{"deed", func() interface{} { return new(SaleDeed) }},
+	}
+	for _, r := range records {
+		keys, err := collectionKeys(stub, collections[r.kind])
+		if err != nil {
+			return nil, err
+		}
+		err = rewriteRecords(stub, r.kind, keys, r.newRecord, &report)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("Money migration complete")
+	return json.Marshal(&report)
+}
+
+// dropKeyArrays deletes the JSON key arrays that indexed each collection.
+// Lookups are range scans over the key prefixes, so the arrays are no
+// longer read or written.
+func (t *SimpleChaincode) dropKeyArrays(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	report := MigrationReport{Migrated: map[string]int{}}
+
+	for _, name := range legacyKeyCollections {
+		keysBytes, err := stub.GetState(name)
+		if err != nil {
+			fmt.Println("Error retrieving " + name)
+			return nil, storageError(entityCollection, name, "retrieving")
+		}
+		if keysBytes == nil {
+			continue
+		}
+
+		err = stub.DelState(name)
+		if err != nil {
+			fmt.Println("Error deleting " + name)
+			return nil, storageError(entityCollection, name, "deleting")
+		}
+		report.Migrated[name]++
+	}
+
+	fmt.Println("Key arrays dropped")
+	return json.Marshal(&report)
+}
+
+// legacyPrefix is a key prefix used before keys were namespaced, with the
+// prefix its records moved to. Deeds and notifications shared "de:", so
+// they have no single new prefix and are told apart by their JSON.
+type legacyPrefix struct {
+	prefix  string
+	current string
+}
+
+var legacyPrefixes = []legacyPrefix{
+	{"cp:", cpPrefix},
+	{"acct:", accountPrefix},
+	{"qt:", quotePrefix},
+	{"LC:", letter_creditPrefix},
+	{"po:", purchase_orderPrefix},
+	{"bl:", bill_ladingPrefix},
+	{"pt:", propertyPrefix},
+	{"pr:", proposalPrefix},
+	{"ag:", agreementPrefix},
+	{"de:", ""},
+}
+
+// target is the prefix a legacy record moves to, or "" when its kind
+// cannot be told from its JSON
+func (p legacyPrefix) target(value []byte) string {
+	if p.current != "" {
+		return p.current
+	}
+	if hasField(value, "deedno") {
+		return deedPrefix
+	}
+	if hasField(value, "notificationId") {
+		return notificationPrefix
+	}
+	return ""
+}
+
+// migrateKeys moves every record stored under a legacy prefix to the
+// namespaced key of its kind. Records that cannot be classified, or whose
+// new key is already taken, are left in place and reported as skipped.
+func (t *SimpleChaincode) migrateKeys(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	report := MigrationReport{Migrated: map[string]int{}}
+
+	for _, legacy := range legacyPrefixes {
+		type legacyRecord struct {
+			key   string
+			value []byte
+		}
+
+		// New prefixes such as "cp:v1:" start with legacy ones, so keys
+		// already migrated are passed over
+		var records []legacyRecord
+		err := scanPrefix(stub, legacy.prefix, func(key string, value []byte) error {
+			if !hasKeyPrefix(key) {
+				records = append(records, legacyRecord{key, value})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			id := strings.TrimPrefix(record.key, legacy.prefix)
+			prefix := legacy.target(record.value)
+			if prefix == "" {
+				fmt.Println("Skipping " + record.key + ": unknown kind of record")
+				report.Skipped = append(report.Skipped, record.key)
+				continue
+			}
+
+			newKey := prefix + id
+			existing, err := stub.GetState(newKey)
+			if err != nil {
+				fmt.Println("Error retrieving " + newKey)
+				return nil, storageError(entityRecord, newKey, "retrieving")
+			}
+			if existing != nil {
+				fmt.Println("Skipping " + record.key + ": " + newKey + " already exists")
+				report.Skipped = append(report.Skipped, record.key)
+				continue
+			}
+
+			err = stub.PutState(newKey, record.value)
+			if err != nil {
+				fmt.Println("Error writing " + newKey)
+				return nil, storageError(entityRecord, newKey, "writing")
+			}
+			err = stub.DelState(record.key)
+			if err != nil {
+				fmt.Println("Error deleting " + record.key)
+				return nil, storageError(entityRecord, record.key, "deleting")
+			}
+
+			report.Migrated[keyKind(prefix)]++
+		}
+	}
+
+	fmt.Println("Key migration complete")
+	return json.Marshal(&report)
+}
+
+// timeFields are the JSON fields holding times stamped from the
+// transaction, for each collection that has any
+var timeFields = []struct {
+	kind   string
+	fields []string
+}{
+	{"cp", []string{"issueDate"}},
+	{"quote", []string{"issueDate", "modifiedon"}},
+	{"lc", []string{"modifiedon"}},
+	{"proposal", []string{"proposeddate"}},
+	{"agreement", []string{"signedon"}},
+	{"deed", []string{"signedon"}},
+}
+
+// canonicalTimes rewrites the given fields of a JSON record in
+// milliseconds, reporting whether any changed
+func canonicalTimes(record map[string]json.RawMessage, fields []string) (bool, error) {
+	changed := false
+	for _, field := range fields {
+		var text string
+		if json.Unmarshal(record[field], &text) != nil || text == "" {
+			continue
+		}
+		t, err := parseClientTime(text)
+		if err != nil {
+			return false, errors.New("unreadable " + field + " " + text)
+		}
+		if timeToMs(t) != text {
+			record[field], _ = json.Marshal(timeToMs(t))
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// migrateDates rewrites the stamped times of existing records in
+// milliseconds, the one format they are now stored in. Records with a time
+// that can't be read are left alone and reported as skipped.
+func (t *SimpleChaincode) migrateDates(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	report := MigrationReport{Migrated: map[string]int{}}
+
+	for _, c := range timeFields {
+		keys, err := collectionKeys(stub, collections[c.kind])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			recordBytes, err := stub.GetState(key)
+			if err != nil {
+				fmt.Println("Error retrieving " + key)
+				return nil, storageError(entityRecord, key, "retrieving")
+			}
+
+			var record map[string]json.RawMessage
+			err = json.Unmarshal(recordBytes, &record)
+			if err != nil {
+				fmt.Println("Skipping " + key + ": " + err.Error())
+				report.Skipped = append(report.Skipped, key)
+				continue
+			}
+			changed, err := canonicalTimes(record, c.fields)
+			if err != nil {
+				fmt.Println("Skipping " + key + ": " + err.Error())
+				report.Skipped = append(report.Skipped, key)
+				continue
+			}
+			if !changed {
+				continue
+			}
+
+			recordBytes, err = json.Marshal(record)
+			if err != nil {
+				fmt.Println("Error marshalling " + key)
+				return nil, storageError(entityRecord, key, "marshalling")
+			}
+			err = putState(stub, key, recordBytes)
+			if err != nil {
+				fmt.Println("Error writing " + key)
+				return nil, storageError(entityRecord, key, "writing")
+			}
+			report.Migrated[c.kind]++
+		}
+	}
+
+	fmt.Println("Date migration complete")
+	return json.Marshal(&report)
+}
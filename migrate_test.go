@@ -0,0 +1,119 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// field reads one string field of the JSON record at key
+func (s *testStub) field(key string, name string) string {
+	s.t.Helper()
+	var record map[string]interface{}
+	err := json.Unmarshal(s.State[key], &record)
+	if err != nil {
+		s.t.Fatalf("%s: %v", key, err)
+	}
+	text, _ := record[name].(string)
+	return text
+}
+
+func TestMigrateDatesRewritesTimesInMilliseconds(t *testing.T) {
+	s := newTestStub(t)
+	issued := time.Date(2025, 12, 31, 23, 59, 59, 250000000, time.UTC)
+	s.put(cpPrefix+"RFC", map[string]string{"cusip": "RFC", "issueDate": "2025-12-31T18:59:59.25-05:00"})
+	s.put(cpPrefix+"MS", map[string]string{"cusip": "MS", "issueDate": timeToMs(issued)})
+	s.put(letter_creditPrefix+"LC1", map[string]string{"lcId": "LC1", "modifiedon": "2025-12-31T23:59:59.250Z"})
+	s.put(quotePrefix+"Q1", map[string]string{"quoteNo": "Q1", "issueDate": timeToMs(issued), "modifiedon": "next tuesday"})
+
+	var report MigrationReport
+	err := json.Unmarshal(s.mustInvoke("migrateDates"), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"cp": 1, "lc": 1}; !reflect.DeepEqual(report.Migrated, want) {
+		t.Fatalf("migrated %v, want %v", report.Migrated, want)
+	}
+	if want := []string{quotePrefix + "Q1"}; !reflect.DeepEqual(report.Skipped, want) {
+		t.Fatalf("skipped %v, want %v", report.Skipped, want)
+	}
+
+	for key, field := range map[string]string{
+		cpPrefix + "RFC":            "issueDate",
+		cpPrefix + "MS":             "issueDate",
+		letter_creditPrefix + "LC1": "modifiedon",
+	} {
+		if got := s.field(key, field); got != timeToMs(issued) {
+			t.Fatalf("%s %s is %s, want %s", key, field, got, timeToMs(issued))
+		}
+	}
+	if got := s.field(quotePrefix+"Q1", "modifiedon"); got != "next tuesday" {
+		t.Fatalf("the skipped quote was rewritten with %s", got)
+	}
+}
+
+func TestMigrateKeysSplitsDeedsFromNotifications(t *testing.T) {
+	s := newTestStub(t)
+	s.put("de:D1", map[string]string{"deedno": "D1"})
+	s.put("de:D2", map[string]string{"deedno": "D2", "owner": "legacy"})
+	s.put("de:N1", map[string]string{"notificationId": "N1"})
+	s.put("de:X1", map[string]string{"status": "unknown"})
+	s.put(deedPrefix+"D2", map[string]string{"deedno": "D2", "owner": "current"})
+
+	var report MigrationReport
+	err := json.Unmarshal(s.mustInvoke("migrateKeys"), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"deed": 1, "notification": 1}; !reflect.DeepEqual(report.Migrated, want) {
+		t.Fatalf("migrated %v, want %v", report.Migrated, want)
+	}
+	if want := []string{"de:D2", "de:X1"}; !reflect.DeepEqual(report.Skipped, want) {
+		t.Fatalf("skipped %v, want %v", report.Skipped, want)
+	}
+
+	if got := s.field(deedPrefix+"D1", "deedno"); got != "D1" {
+		t.Fatalf("deed D1 moved as %q", got)
+	}
+	if got := s.field(notificationPrefix+"N1", "notificationId"); got != "N1" {
+		t.Fatalf("notification N1 moved as %q", got)
+	}
+	if s.State[deedPrefix+"N1"] != nil || s.State[notificationPrefix+"D1"] != nil {
+		t.Fatal("a record moved to the other kind's prefix")
+	}
+	for _, key := range []string{"de:D1", "de:N1"} {
+		if s.State[key] != nil {
+			t.Fatalf("%s was left behind after it moved", key)
+		}
+	}
+
+	// Skipped records stay where they were, and the record already at the
+	// new key is not overwritten
+	for _, key := range []string{"de:D2", "de:X1"} {
+		if s.State[key] == nil {
+			t.Fatalf("the skipped %s was removed", key)
+		}
+	}
+	if got := s.field(deedPrefix+"D2", "owner"); got != "current" {
+		t.Fatalf("deed D2 was overwritten by the legacy record, owner %q", got)
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// testStub runs the chaincode against a MockStub, adding the certificate
+// attributes, transaction time and range scans the mock leaves out
+type testStub struct {
+	*shim.MockStub
+	t      *testing.T
+	cc     *SimpleChaincode
+	now    time.Time
+	attrs  map[string]string
+	events []string
+	txn    int
+}
+
+func newTestStub(t *testing.T) *testStub {
+	cc := new(SimpleChaincode)
+	s := &testStub{
+		MockStub: shim.NewMockStub("cp", cc),
+		t:        t,
+		cc:       cc,
+		now:      time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		attrs:    map[string]string{roleAttribute: roleAdmin, companyAttribute: "admin"},
+	}
+	s.mustInvoke("init")
+	return s
+}
+
+// as makes the following calls on behalf of a company holding role
+func (s *testStub) as(role string, company string) {
+	s.attrs[roleAttribute] = role
+	s.attrs[companyAttribute] = company
+}
+
+// timedStub gives a testStub a transaction time. The timestamp type is
+// vendored inside fabric where this package can't import it, so it is
+// taken from the signature of the mock's own GetTxTimestamp.
+type timedStub[T any] struct {
+	*testStub
+}
+
+func (s timedStub[T]) GetTxTimestamp() (T, error) {
+	var ts T
+	value := reflect.New(reflect.TypeOf(ts).Elem())
+	value.Elem().FieldByName("Seconds").SetInt(s.now.Unix())
+	value.Elem().FieldByName("Nanos").SetInt(int64(s.now.Nanosecond()))
+	return value.Interface().(T), nil
+}
+
+func withClock[T any](s *testStub, _ func() (T, error)) shim.ChaincodeStubInterface {
+	return any(timedStub[T]{s}).(shim.ChaincodeStubInterface)
+}
+
+// stub is what the chaincode is called with
+func (s *testStub) stub() shim.ChaincodeStubInterface {
+	return withClock(s, s.MockStub.GetTxTimestamp)
+}
+
+func (s *testStub) ReadCertAttribute(name string) ([]byte, error) {
+	value, ok := s.attrs[name]
+	if !ok {
+		return nil, &PermissionError{name, "no such attribute"}
+	}
+	return []byte(value), nil
+}
+
+func (s *testStub) VerifyAttribute(name string, value []byte) (bool, error) {
+	return s.attrs[name] == string(value), nil
+}
+
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	s.events = append(s.events, name)
+	return nil
+}
+
+func (s *testStub) RangeQueryState(startKey string, endKey string) (shim.StateRangeQueryIteratorInterface, error) {
+	var keys []string
+	for e := s.Keys.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		if key >= startKey && key < endKey {
+			keys = append(keys, key)
+		}
+	}
+	return &testIterator{stub: s, keys: keys}, nil
+}
+
+type testIterator struct {
+	stub *testStub
+	keys []string
+}
+
+func (it *testIterator) HasNext() bool { return len(it.keys) > 0 }
+
+func (it *testIterator) Next() (string, []byte, error) {
+	key := it.keys[0]
+	it.keys = it.keys[1:]
+	return key, it.stub.State[key], nil
+}
+
+func (it *testIterator) Close() error { return nil }
+
+// invoke runs an invoke in its own transaction. A failed transaction
+// leaves the state as it was, as it would on a peer.
+func (s *testStub) invoke(function string, args ...string) ([]byte, error) {
+	s.txn++
+	txID := "tx" + strconv.Itoa(s.txn)
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+
+	before := map[string][]byte{}
+	for key, value := range s.State {
+		before[key] = value
+	}
+	result, err := s.cc.Invoke(s.stub(), function, args)
+	if err != nil {
+		for key := range s.State {
+			if _, ok := before[key]; !ok {
+				s.DelState(key)
+			}
+		}
+		for key, value := range before {
+			s.PutState(key, value)
+		}
+	}
+	return result, err
+}
+
+// put writes a record straight to the state, as a bug or an old version
+// of the chaincode might have left it
+func (s *testStub) put(key string, record interface{}) {
+	s.t.Helper()
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.MockTransactionStart("put")
+	defer s.MockTransactionEnd("put")
+	s.PutState(key, recordBytes)
+}
+
+// lastTxID is the ID of the most recent invoke
+func (s *testStub) lastTxID() string {
+	return "tx" + strconv.Itoa(s.txn)
+}
+
+func (s *testStub) mustInvoke(function string, args ...string) []byte {
+	s.t.Helper()
+	result, err := s.invoke(function, args...)
+	if err != nil {
+		s.t.Fatalf("%s %v: %v", function, args, err)
+	}
+	return result
+}
+
+// mustFail checks an invoke fails with the given error code
+func (s *testStub) mustFail(code string, function string, args ...string) {
+	s.t.Helper()
+	_, err := s.invoke(function, args...)
+	checkCode(s.t, err, code)
+}
+
+func (s *testStub) query(args ...string) ([]byte, error) {
+	return s.cc.Query(s.stub(), "query", args)
+}
+
+// mustQuery runs a query and reads its result into v
+func (s *testStub) mustQuery(v interface{}, args ...string) {
+	s.t.Helper()
+	result, err := s.query(args...)
+	if err != nil {
+		s.t.Fatalf("query %v: %v", args, err)
+	}
+	err = json.Unmarshal(result, v)
+	if err != nil {
+		s.t.Fatalf("query %v: %v", args, err)
+	}
+}
+
+// checkCode checks err is a ChaincodeError with the given code
+func checkCode(t *testing.T, err error, code string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected a %s error, got none", code)
+	}
+	var failure ChaincodeError
+	if json.Unmarshal([]byte(err.Error()), &failure) != nil || failure.Code != code {
+		t.Fatalf("expected a %s error, got %v", code, err)
+	}
+}
+
+// cp reads a paper by CUSIP
+func (s *testStub) cp(cusip string) CP {
+	s.t.Helper()
+	var cp CP
+	s.mustQuery(&cp, "GetCP", cpPrefix+cusip)
+	return cp
+}
+
+// company reads an account, whoever the caller acts for
+func (s *testStub) company(id string) Account {
+	s.t.Helper()
+	account, err := GetCompany(id, s.stub())
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return account
+}
+
+// issue issues paper for company1 and returns its CUSIP
+func (s *testStub) issue(record string) string {
+	s.t.Helper()
+	s.mustInvoke("issueCommercialPaper", record)
+	var cps []CP
+	s.mustQuery(&cps, "GetAllCPs")
+	return cps[len(cps)-1].CUSIP
+}
+
+// newMarket creates three companies, each with the opening balance, and
+// issues 10 units of 30 day paper for company1
+func newMarket(t *testing.T) (*testStub, string) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "3")
+	s.mustInvoke("setProgram", "company1", `{"authorized":100000}`)
+	cusip := s.issue(`{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":30,"issuer":"company1"}`)
+	return s, cusip
+}
+
+// owner finds a company's position in a paper
+func owner(cp CP, company string) Owner {
+	for _, o := range cp.Owners {
+		if o.Company == company {
+			return o
+		}
+	}
+	return Owner{Company: company}
+}
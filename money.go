@@ -0,0 +1,262 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// RoundingMode says what to do with digits beyond the precision of a
+// fixed-point value
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest value, ties to the even neighbour
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest value, ties away from zero
+	RoundHalfUp
+	// RoundDown truncates towards zero
+	RoundDown
+	// RoundUp rounds away from zero
+	RoundUp
+)
+
+// Amounts read from JSON are rounded half-even, which is also how legacy
+// float64 balances are converted
+var jsonRoundingMode = RoundHalfEven
+
+// Money is an exact amount held as a whole number of minor units (cents).
+// It is written to JSON as a decimal string such as "1234.56".
+type Money int64
+
+const moneyScale = 2
+
+// Rate is an exact percentage held in millionths of a percent, so 7.5%
+// is Rate(7500000). It is written to JSON as a plain number such as 7.5.
+type Rate int64
+
+const rateScale = 6
+
+// fullRate is a rate of 100%
+const fullRate = Rate(100000000)
+
+// parseDecimal reads decimal text exactly, without going through float64
+func parseDecimal(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, "/_") {
+		return nil, errors.New("Invalid decimal " + s)
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, errors.New("Invalid decimal " + s)
+	}
+
+	return r, nil
+}
+
+// roundScaled returns r * 10^scale rounded to an integer using mode
+func roundScaled(r *big.Rat, scale int, mode RoundingMode) (int64, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+
+	q, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		// compare twice the remainder against the denominator to find ties
+		half := new(big.Int).Abs(rem)
+		half.Mul(half, big.NewInt(2))
+		cmp := half.Cmp(scaled.Denom())
+
+		awayFromZero := false
+		switch mode {
+		case RoundHalfEven:
+			awayFromZero = cmp > 0 || (cmp == 0 && q.Bit(0) == 1)
+		case RoundHalfUp:
+			awayFromZero = cmp >= 0
+		case RoundUp:
+			awayFromZero = true
+		case RoundDown:
+			awayFromZero = false
+		default:
+			return 0, errors.New("Unknown rounding mode")
+		}
+
+		if awayFromZero {
+			q.Add(q, big.NewInt(int64(scaled.Sign())))
+		}
+	}
+
+	if !q.IsInt64() {
+		return 0, errors.New("Decimal out of range " + r.FloatString(scale))
+	}
+	return q.Int64(), nil
+}
+
+// formatScaled writes v / 10^scale as decimal text, optionally dropping
+// trailing zeros from the fraction
+func formatScaled(v int64, scale int, trim bool) string {
+	s := new(big.Rat).SetFrac(big.NewInt(v), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)).FloatString(scale)
+	if trim && strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// decimalText unwraps a JSON number or string into decimal text. Empty
+// strings and null read as zero.
+func decimalText(data []byte) (string, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return "0", nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(s) == "" {
+			return "0", nil
+		}
+		return s, nil
+	}
+
+	return string(data), nil
+}
+
+// ParseMoney reads a decimal amount such as "1234.56", rounding any
+// fraction of a cent with mode
+func ParseMoney(s string, mode RoundingMode) (Money, error) {
+	r, err := parseDecimal(s)
+	if err != nil {
+		return 0, err
+	}
+	return MoneyFromRat(r, mode)
+}
+
+// MoneyFromRat rounds an exact value to the nearest cent using mode
+func MoneyFromRat(r *big.Rat, mode RoundingMode) (Money, error) {
+	v, err := roundScaled(r, moneyScale, mode)
+	if err != nil {
+		return 0, err
+	}
+	return Money(v), nil
+}
+
+// Rat returns the exact value of m in major units
+func (m Money) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(int64(m)), big.NewInt(100))
+}
+
+// Times returns m multiplied by a whole quantity
+func (m Money) Times(quantity int) Money {
+	return m * Money(quantity)
+}
+
+func (m Money) String() string {
+	return formatScaled(int64(m), moneyScale, false)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text, err := decimalText(data)
+	if err != nil {
+		return err
+	}
+
+	v, err := ParseMoney(text, jsonRoundingMode)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// ParseRate reads a percentage such as "7.5", rounding beyond a
+// millionth of a percent with mode
+func ParseRate(s string, mode RoundingMode) (Rate, error) {
+	r, err := parseDecimal(s)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := roundScaled(r, rateScale, mode)
+	if err != nil {
+		return 0, err
+	}
+	return Rate(v), nil
+}
+
+// RateFromFraction rounds a fraction such as 0.075 to a rate using mode
+func RateFromFraction(r *big.Rat, mode RoundingMode) (Rate, error) {
+	v, err := roundScaled(new(big.Rat).Mul(r, big.NewRat(100, 1)), rateScale, mode)
+	if err != nil {
+		return 0, err
+	}
+	return Rate(v), nil
+}
+
+// Percent returns the exact rate as a percentage, 7.5 for 7.5%
+func (r Rate) Percent() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(int64(r)), new(big.Int).Exp(big.NewInt(10), big.NewInt(rateScale), nil))
+}
+
+// Fraction returns the exact rate as a fraction, 0.075 for 7.5%
+func (r Rate) Fraction() *big.Rat {
+	return new(big.Rat).Quo(r.Percent(), big.NewRat(100, 1))
+}
+
+func (r Rate) String() string {
+	return formatScaled(int64(r), rateScale, true)
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	text, err := decimalText(data)
+	if err != nil {
+		return err
+	}
+
+	v, err := ParseRate(text, jsonRoundingMode)
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+// discountedAmount prices a face amount at a simple discount rate over a
+// fraction of a year, rounding to the cent with mode
+func discountedAmount(face Money, discount Rate, yearFraction *big.Rat, mode RoundingMode) (Money, error) {
+	// face * (1 - discount * yearFraction)
+	term := new(big.Rat).Mul(discount.Fraction(), yearFraction)
+	factor := new(big.Rat).Sub(big.NewRat(1, 1), term)
+
+	return MoneyFromRat(new(big.Rat).Mul(face.Rat(), factor), mode)
+}
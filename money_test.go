@@ -0,0 +1,144 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestParseMoneyRounding(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		mode RoundingMode
+		want Money
+	}{
+		{"1234.56", RoundHalfEven, 123456},
+		{"0.125", RoundHalfEven, 12},
+		{"0.135", RoundHalfEven, 14},
+		{"0.125", RoundHalfUp, 13},
+		{"-0.125", RoundHalfUp, -13},
+		{"-0.125", RoundHalfEven, -12},
+		{"0.129", RoundDown, 12},
+		{"-0.129", RoundDown, -12},
+		{"0.121", RoundUp, 13},
+		{"-0.121", RoundUp, -13},
+		{"0.126", RoundHalfEven, 13},
+		{"10", RoundDown, 1000},
+		{"1e3", RoundDown, 100000},
+	} {
+		got, err := ParseMoney(test.text, test.mode)
+		if err != nil {
+			t.Fatalf("%s: %v", test.text, err)
+		}
+		if got != test.want {
+			t.Errorf("%s with mode %d is %d cents, want %d", test.text, test.mode, got, test.want)
+		}
+	}
+
+	for _, text := range []string{"", "abc", "1/3", "1_000", "99999999999999999999"} {
+		_, err := ParseMoney(text, RoundHalfEven)
+		if err == nil {
+			t.Errorf("%q parsed as money", text)
+		}
+	}
+}
+
+func TestParseRateRounding(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		mode RoundingMode
+		want Rate
+	}{
+		{"7.5", RoundHalfEven, 7500000},
+		{"0.0000005", RoundHalfEven, 0},
+		{"0.0000015", RoundHalfEven, 2},
+		{"0.0000005", RoundHalfUp, 1},
+		{"0.0000009", RoundDown, 0},
+		{"0.0000001", RoundUp, 1},
+	} {
+		got, err := ParseRate(test.text, test.mode)
+		if err != nil {
+			t.Fatalf("%s: %v", test.text, err)
+		}
+		if got != test.want {
+			t.Errorf("%s with mode %d is %d, want %d", test.text, test.mode, got, test.want)
+		}
+	}
+
+	rate, err := RateFromFraction(big.NewRat(1, 3), RoundHalfEven)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 33333333 {
+		t.Errorf("a third is %s%%, want 33.333333%%", rate)
+	}
+}
+
+func TestMoneyAndRateText(t *testing.T) {
+	for _, test := range []struct {
+		value fmt.Stringer
+		want  string
+	}{
+		{Money(123456), "1234.56"},
+		{Money(-5), "-0.05"},
+		{Money(100), "1.00"},
+		{Rate(7500000), "7.5"},
+		{Rate(5000000), "5"},
+		{Rate(1), "0.000001"},
+	} {
+		if got := test.value.String(); got != test.want {
+			t.Errorf("%d is written %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestMoneyAndRateJSON(t *testing.T) {
+	var record struct {
+		Amount   Money `json:"amount"`
+		Discount Rate  `json:"discount"`
+	}
+	for _, test := range []struct {
+		json     string
+		amount   Money
+		discount Rate
+	}{
+		{`{"amount":"1234.565","discount":7.5}`, 123456, 7500000},
+		{`{"amount":1234.575,"discount":"7.25"}`, 123458, 7250000},
+		{`{"amount":"","discount":null}`, 0, 0},
+	} {
+		err := json.Unmarshal([]byte(test.json), &record)
+		if err != nil {
+			t.Fatalf("%s: %v", test.json, err)
+		}
+		if record.Amount != test.amount || record.Discount != test.discount {
+			t.Errorf("%s read as %s and %s", test.json, record.Amount, record.Discount)
+		}
+	}
+
+	out, err := json.Marshal(&record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"amount":"0.00","discount":0}` {
+		t.Errorf("written as %s", out)
+	}
+}
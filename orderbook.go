@@ -0,0 +1,549 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Orders are stored by ID under orderPrefix. Open orders also have an
+// entry in their paper's book, keyed so a range scan returns each side in
+// price-time priority.
+var orderPrefix = keyPrefix("order")
+var bookPrefix = keyPrefix("book")
+
+// Sides of the book
+const (
+	sideBid = "bid"
+	sideAsk = "ask"
+)
+
+// An order rests in the book until it is filled or cancelled
+var orderStatuses = statusMachine{
+	document: "order",
+	initial:  "open",
+	transitions: map[string][]string{
+		"open":      {"filled", "cancelled"},
+		"filled":    {},
+		"cancelled": {},
+	},
+}
+
+const (
+	orderOpen      = "open"
+	orderFilled    = "filled"
+	orderCancelled = "cancelled"
+)
+
+// Order is a limit order to buy or sell a paper at a discount rate. A bid
+// buys at its discount or any higher one, and an ask sells at its discount
+// or any lower one. Bids hold par for their remaining quantity in cash,
+// the most they can pay, and asks hold their remaining quantity of paper.
+type Order struct {
+	ID         string `json:"id"`
+	CUSIP      string `json:"cusip"`
+	Company    string `json:"company"`
+	Side       string `json:"side"`
+	Discount   Rate   `json:"discount"`
+	Quantity   int    `json:"quantity"`
+	Remaining  int    `json:"remaining"`
+	Status     string `json:"status"`
+	PlacedOn   string `json:"placedOn"`
+	ModifiedOn string `json:"modifiedOn"`
+}
+
+// bookEntry is what the book holds for an open order
+type bookEntry struct {
+	OrderID  string `json:"orderId"`
+	Discount Rate   `json:"discount"`
+}
+
+// PriceLevel is the open quantity at one discount on one side of a book
+type PriceLevel struct {
+	Discount Rate `json:"discount"`
+	Quantity int  `json:"quantity"`
+	Orders   int  `json:"orders"`
+}
+
+// OrderBook is the depth of a paper's book, best prices first
+type OrderBook struct {
+	CUSIP string       `json:"cusip"`
+	Bids  []PriceLevel `json:"bids"`
+	Asks  []PriceLevel `json:"asks"`
+}
+
+// bookSidePrefix is the prefix of every entry on one side of a paper's book
+func bookSidePrefix(cusip string, side string) string {
+	return bookPrefix + cusip + keySeparator + side + keySeparator
+}
+
+// bookKey orders bids by lowest discount, the highest price, and asks by
+// highest discount, the lowest price, then both by arrival. Orders placed
+// in the same millisecond fall back to the order of their IDs.
+func bookKey(order Order) string {
+	priority := int64(order.Discount)
+	if order.Side == sideAsk {
+		priority = math.MaxInt64 - priority
+	}
+	return fmt.Sprintf("%s%019d%s%019s%s%s", bookSidePrefix(order.CUSIP, order.Side), priority, keySeparator, order.PlacedOn, keySeparator, order.ID)
+}
+
+// crosses reports whether a resting order on the other side can fill order
+func (order Order) crosses(resting Rate) bool {
+	if order.Side == sideBid {
+		return resting >= order.Discount
+	}
+	return resting <= order.Discount
+}
+
+func GetOrder(orderID string, stub shim.ChaincodeStubInterface) (Order, error) {
+	var order Order
+
+	orderBytes, err := stub.GetState(orderPrefix + orderID)
+	if err != nil {
+		fmt.Println("Error retrieving order " + orderID)
+		return order, storageError(entityOrder, orderID, "retrieving")
+	}
+	if orderBytes == nil {
+		fmt.Println("Order " + orderID + " does not exist")
+		return order, notFound(entityOrder, orderID)
+	}
+
+	err = json.Unmarshal(orderBytes, &order)
+	if err != nil {
+		fmt.Println("Error unmarshalling order " + orderID)
+		return order, storageError(entityOrder, orderID, "unmarshalling")
+	}
+
+	return order, nil
+}
+
+func PutOrder(order Order, stub shim.ChaincodeStubInterface) error {
+	orderBytes, err := json.Marshal(&order)
+	if err != nil {
+		fmt.Println("Error marshalling order " + order.ID)
+		return storageError(entityOrder, order.ID, "marshalling")
+	}
+
+	err = putState(stub, orderPrefix+order.ID, orderBytes)
+	if err != nil {
+		fmt.Println("Error writing order " + order.ID)
+		return storageError(entityOrder, order.ID, "writing")
+	}
+
+	return nil
+}
+
+// closeOrder takes an order out of the book as filled or cancelled
+func closeOrder(stub shim.ChaincodeStubInterface, order *Order, status string, action string, now time.Time) error {
+	err := orderStatuses.move(order.Status, status)
+	if err != nil {
+		return err
+	}
+
+	err = stub.DelState(bookKey(*order))
+	if err != nil {
+		fmt.Println("Error removing order " + order.ID + " from the book")
+		return storageError(entityOrder, order.ID, "removing from the book")
+	}
+
+	oldStatus := order.Status
+	order.Status = status
+	order.ModifiedOn = timeToMs(now)
+	err = PutOrder(*order, stub)
+	if err != nil {
+		return err
+	}
+
+	recordEvent(stub, entityOrder, action, orderPrefix+order.ID, oldStatus, order.Status)
+	return nil
+}
+
+// reserveOrder holds what an order needs for quantity more of the paper,
+// or releases it when quantity is negative. A bid holds the most one unit
+// can cost, its redemption amount.
+func reserveOrder(stub shim.ChaincodeStubInterface, order Order, unit Money, quantity int) error {
+	if order.Side == sideAsk {
+		return reservePaper(stub, order.CUSIP, order.Company, quantity)
+	}
+	return reserveCash(stub, order.Company, unit.Times(quantity))
+}
+
+// fillOrders settles quantity between a bid and an ask at the resting
+// order's discount, releasing what both held for it
+func fillOrders(stub shim.ChaincodeStubInterface, bid *Order, ask *Order, discount Rate, quantity int, now time.Time) error {
+	cp, err := GetCP(cpPrefix+bid.CUSIP, stub)
+	if err != nil {
+		return err
+	}
+	price, err := paperPrice(cp, quantity, discount, now)
+	if err != nil {
+		fmt.Println("Error pricing the paper " + cp.CUSIP)
+		return newError(codeInvalidRecord, entityCP, cp.CUSIP, "", "Error pricing the paper "+cp.CUSIP)
+	}
+
+	unit, err := redemptionAmount(cp, 1)
+	if err != nil {
+		return err
+	}
+	err = reserveOrder(stub, *bid, unit, -quantity)
+	if err != nil {
+		return err
+	}
+	err = reserveOrder(stub, *ask, unit, -quantity)
+	if err != nil {
+		return err
+	}
+
+	// Releasing the reservations rewrote the paper
+	cp, err = GetCP(cpPrefix+bid.CUSIP, stub)
+	if err != nil {
+		return err
+	}
+	err = settleTransfer(stub, &cp, ask.Company, bid.Company, quantity, price)
+	if err != nil {
+		return err
+	}
+	recordEvent(stub, entityCP, actionTransferred, cpPrefix+cp.CUSIP, paperStatus(cp), paperStatus(cp))
+
+	bid.Remaining -= quantity
+	ask.Remaining -= quantity
+
+	// Each fill is kept as a settled trade. A pair of orders fills at most
+	// once, so their IDs name the trade.
+	trade := Trade{
+		ID:         bid.ID + "-" + ask.ID,
+		CUSIP:      cp.CUSIP,
+		Seller:     ask.Company,
+		Buyer:      bid.Company,
+		Quantity:   quantity,
+		Discount:   discount,
+		Price:      price,
+		Status:     tradeSettled,
+		ProposedOn: timeToMs(now),
+		ExpiresOn:  timeToMs(now),
+		ModifiedOn: timeToMs(now),
+	}
+	err = PutTrade(trade, stub)
+	if err != nil {
+		return err
+	}
+	recordEvent(stub, entityTrade, actionSettled, tradePrefix+trade.ID, "", trade.Status)
+
+	fmt.Println("Filled " + strconv.Itoa(quantity) + " of " + cp.CUSIP + " at " + discount.String() + " for " + price.String())
+	return nil
+}
+
+// matchOrder fills an incoming order against the other side of the book,
+// best price first and oldest first at each price
+func matchOrder(stub shim.ChaincodeStubInterface, order *Order, now time.Time) error {
+	otherSide := sideAsk
+	if order.Side == sideAsk {
+		otherSide = sideBid
+	}
+
+	var entries []bookEntry
+	prefix := bookSidePrefix(order.CUSIP, otherSide)
+	err := scanRange(stub, prefix, prefix, func(key string, value []byte) (bool, error) {
+		var entry bookEntry
+		err := json.Unmarshal(value, &entry)
+		if err != nil {
+			fmt.Println("Error unmarshalling " + key)
+			return false, storageError(entityOrder, key, "unmarshalling")
+		}
+		if !order.crosses(entry.Discount) {
+			return false, nil
+		}
+		entries = append(entries, entry)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if order.Remaining == 0 {
+			break
+		}
+
+		resting, err := GetOrder(entry.OrderID, stub)
+		if err != nil {
+			return err
+		}
+		// A company's orders never fill against each other
+		if resting.Company == order.Company {
+			continue
+		}
+
+		quantity := order.Remaining
+		if resting.Remaining < quantity {
+			quantity = resting.Remaining
+		}
+
+		if order.Side == sideBid {
+			err = fillOrders(stub, order, &resting, resting.Discount, quantity, now)
+		} else {
+			err = fillOrders(stub, &resting, order, resting.Discount, quantity, now)
+		}
+		if err != nil {
+			return err
+		}
+
+		if resting.Remaining == 0 {
+			err = closeOrder(stub, &resting, orderFilled, actionFilled, now)
+		} else {
+			resting.ModifiedOn = timeToMs(now)
+			err = PutOrder(resting, stub)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *SimpleChaincode) placeOrder(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		json
+	  	{
+			  "cusip": "",
+			  "company": "",
+			  "side": "bid", // or "ask"
+			  "discount": 7.5,
+			  "quantity": 1
+		}
+	*/
+	if len(args) != 1 {
+		return nil, badArguments("placeOrder", "order record")
+	}
+
+	var order Order
+	fmt.Println("Unmarshalling Order")
+	err := json.Unmarshal([]byte(args[0]), &order)
+	if err != nil {
+		fmt.Println("Error unmarshalling order")
+		return nil, invalidRecord(entityOrder, err)
+	}
+
+	// Companies only place orders for themselves
+	err = requireCompany(stub, "placeOrder", order.Company)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	if order.Side != sideBid && order.Side != sideAsk {
+		fmt.Println("Invalid side " + order.Side)
+		return nil, invalidField(entityOrder, "", "side", "Order side must be "+sideBid+" or "+sideAsk)
+	}
+	if order.Quantity <= 0 {
+		fmt.Println("Invalid quantity " + strconv.Itoa(order.Quantity))
+		return nil, invalidField(entityOrder, "", "quantity", "Invalid quantity "+strconv.Itoa(order.Quantity))
+	}
+	if order.Discount < 0 {
+		fmt.Println("Invalid discount " + order.Discount.String())
+		return nil, invalidField(entityOrder, "", "discount", "Invalid discount "+order.Discount.String())
+	}
+
+	cp, err := GetCP(cpPrefix+order.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Matured {
+		fmt.Println("The paper " + order.CUSIP + " has matured")
+		return nil, newError(codeInvalidStatus, entityCP, order.CUSIP, "matured", "The paper "+order.CUSIP+" has matured and can no longer be traded")
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityOrder, "")
+	}
+
+	order.ID = recordID(stub)
+	err = requireNew(stub, entityOrder, orderPrefix+order.ID)
+	if err != nil {
+		return nil, err
+	}
+	order.Remaining = order.Quantity
+	order.Status = orderStatuses.initial
+	order.PlacedOn = timeToMs(now)
+	order.ModifiedOn = order.PlacedOn
+
+	unit, err := redemptionAmount(cp, 1)
+	if err != nil {
+		return nil, err
+	}
+	err = reserveOrder(stub, order, unit, order.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	recordEvent(stub, entityOrder, actionPlaced, orderPrefix+order.ID, "", order.Status)
+
+	err = matchOrder(stub, &order, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Remaining == 0 {
+		order.Status = orderFilled
+		recordEvent(stub, entityOrder, actionFilled, orderPrefix+order.ID, orderOpen, order.Status)
+	} else {
+		entryBytes, err := json.Marshal(&bookEntry{order.ID, order.Discount})
+		if err != nil {
+			fmt.Println("Error marshalling book entry")
+			return nil, storageError(entityOrder, order.ID, "marshalling the book entry of")
+		}
+		err = stub.PutState(bookKey(order), entryBytes)
+		if err != nil {
+			fmt.Println("Error adding order to the book")
+			return nil, storageError(entityOrder, order.ID, "adding to the book")
+		}
+	}
+
+	err = PutOrder(order, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Placed order " + order.ID)
+	return json.Marshal(&order)
+}
+
+func (t *SimpleChaincode) cancelOrder(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		order ID
+	*/
+	if len(args) != 1 {
+		return nil, badArguments("cancelOrder", "order ID")
+	}
+
+	order, err := GetOrder(args[0], stub)
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireCompany(stub, "cancelOrder", order.Company)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	if order.Status != orderOpen {
+		fmt.Println("Order " + order.ID + " is " + order.Status)
+		return nil, invalidStatus(entityOrder, order.ID, "Order "+order.ID+" is already "+order.Status)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityOrder, order.ID)
+	}
+
+	cp, err := GetCP(cpPrefix+order.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := redemptionAmount(cp, 1)
+	if err != nil {
+		return nil, err
+	}
+	err = reserveOrder(stub, order, unit, -order.Remaining)
+	if err != nil {
+		return nil, err
+	}
+
+	err = closeOrder(stub, &order, orderCancelled, actionCancelled, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Cancelled order " + order.ID)
+	return json.Marshal(&order)
+}
+
+// GetOrderBook returns the open quantity at each discount on both sides of
+// a paper's book
+func GetOrderBook(cusip string, stub shim.ChaincodeStubInterface) (OrderBook, error) {
+	book := OrderBook{CUSIP: cusip}
+
+	for _, side := range []string{sideBid, sideAsk} {
+		var levels []PriceLevel
+		err := scanPrefix(stub, bookSidePrefix(cusip, side), func(key string, value []byte) error {
+			var entry bookEntry
+			err := json.Unmarshal(value, &entry)
+			if err != nil {
+				fmt.Println("Error unmarshalling " + key)
+				return storageError(entityOrder, key, "unmarshalling")
+			}
+			order, err := GetOrder(entry.OrderID, stub)
+			if err != nil {
+				return err
+			}
+
+			if len(levels) == 0 || levels[len(levels)-1].Discount != order.Discount {
+				levels = append(levels, PriceLevel{Discount: order.Discount})
+			}
+			levels[len(levels)-1].Quantity += order.Remaining
+			levels[len(levels)-1].Orders++
+			return nil
+		})
+		if err != nil {
+			return book, err
+		}
+
+		if side == sideBid {
+			book.Bids = levels
+		} else {
+			book.Asks = levels
+		}
+	}
+
+	return book, nil
+}
+
+// GetOpenOrders returns a company's orders still resting in a book
+func GetOpenOrders(company string, stub shim.ChaincodeStubInterface) ([]Order, error) {
+	var orders []Order
+
+	err := scanCollection(stub, collections["order"], func(key string, value []byte) error {
+		var order Order
+		err := json.Unmarshal(value, &order)
+		if err != nil {
+			fmt.Println("Error unmarshalling " + key)
+			return storageError(entityOrder, key, "unmarshalling")
+		}
+		if order.Company == company && order.Status == orderOpen {
+			orders = append(orders, order)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
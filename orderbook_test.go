@@ -0,0 +1,163 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// order places an order for company and returns its ID
+func (s *testStub) order(role string, company string, cusip string, side string, discount string, quantity int) string {
+	s.t.Helper()
+	s.as(role, company)
+	s.mustInvoke("placeOrder", fmt.Sprintf(`{"cusip":%q,"company":%q,"side":%q,"discount":%s,"quantity":%d}`, cusip, company, side, discount, quantity))
+	return s.lastTxID()
+}
+
+func TestFillsAreNamedByTheirOrders(t *testing.T) {
+	s, cusip := newMarket(t)
+	bid2 := s.order(roleInvestor, "company2", cusip, sideBid, "5", 3)
+	bid3 := s.order(roleInvestor, "company3", cusip, sideBid, "5", 3)
+	ask := s.order(roleIssuer, "company1", cusip, sideAsk, "5", 6)
+
+	for _, bid := range []string{bid2, bid3} {
+		trade, err := GetTrade(bid+"-"+ask, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trade.Quantity != 3 || trade.Status != tradeSettled {
+			t.Fatalf("trade %s is %d %s, want 3 %s", trade.ID, trade.Quantity, trade.Status, tradeSettled)
+		}
+	}
+}
+
+func TestOrderMatchingPriceTimePriority(t *testing.T) {
+	type order struct {
+		company  string
+		side     string
+		discount string
+		quantity int
+	}
+	type fill struct {
+		resting  int
+		quantity int
+		discount string
+	}
+	for _, test := range []struct {
+		name      string
+		resting   []order
+		incoming  order
+		fills     []fill
+		remaining int
+	}{
+		{
+			name:     "the highest discount ask fills a bid first",
+			resting:  []order{{"company1", sideAsk, "5", 2}, {"company2", sideAsk, "6", 2}},
+			incoming: order{"company3", sideBid, "5", 2},
+			fills:    []fill{{1, 2, "6"}},
+		},
+		{
+			name:     "the lowest discount bid fills an ask first",
+			resting:  []order{{"company2", sideBid, "5", 2}, {"company3", sideBid, "4", 2}},
+			incoming: order{"company1", sideAsk, "5", 3},
+			fills:    []fill{{1, 2, "4"}, {0, 1, "5"}},
+		},
+		{
+			name:     "the earlier order fills first at the same discount",
+			resting:  []order{{"company1", sideAsk, "5", 2}, {"company2", sideAsk, "5", 2}},
+			incoming: order{"company3", sideBid, "5", 3},
+			fills:    []fill{{0, 2, "5"}, {1, 1, "5"}},
+		},
+		{
+			name:      "orders that don't cross both rest",
+			resting:   []order{{"company1", sideAsk, "4", 2}},
+			incoming:  order{"company3", sideBid, "5", 2},
+			remaining: 2,
+		},
+		{
+			name:      "the unfilled part of an order rests",
+			resting:   []order{{"company1", sideAsk, "5", 1}},
+			incoming:  order{"company3", sideBid, "4", 3},
+			fills:     []fill{{0, 1, "5"}},
+			remaining: 2,
+		},
+		{
+			name:     "a company's own orders are passed over",
+			resting:  []order{{"company3", sideAsk, "6", 2}, {"company2", sideAsk, "5", 2}},
+			incoming: order{"company3", sideBid, "5", 2},
+			fills:    []fill{{1, 2, "5"}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s, cusip := newMarket(t)
+			s.mustInvoke("transferPaper", `{"CUSIP":"`+cusip+`","fromCompany":"company1","toCompany":"company2","quantity":3}`)
+			s.mustInvoke("transferPaper", `{"CUSIP":"`+cusip+`","fromCompany":"company1","toCompany":"company3","quantity":3}`)
+
+			place := func(o order) string {
+				s.now = s.now.Add(time.Minute)
+				role := roleInvestor
+				if o.company == "company1" {
+					role = roleIssuer
+				}
+				return s.order(role, o.company, cusip, o.side, o.discount, o.quantity)
+			}
+			var resting []string
+			for _, o := range test.resting {
+				resting = append(resting, place(o))
+			}
+			incoming := place(test.incoming)
+
+			trades := 0
+			for key := range s.State {
+				if strings.HasPrefix(key, tradePrefix) {
+					trades++
+				}
+			}
+			if trades != len(test.fills) {
+				t.Fatalf("%d fills, want %d", trades, len(test.fills))
+			}
+			for _, f := range test.fills {
+				// Fills are named bid first
+				id := incoming + "-" + resting[f.resting]
+				if test.incoming.side == sideAsk {
+					id = resting[f.resting] + "-" + incoming
+				}
+				trade, err := GetTrade(id, s)
+				if err != nil {
+					t.Fatalf("resting order %d: %v", f.resting, err)
+				}
+				discount, _ := ParseRate(f.discount, RoundHalfEven)
+				if trade.Quantity != f.quantity || trade.Discount != discount {
+					t.Errorf("resting order %d filled %d at %s, want %d at %s", f.resting, trade.Quantity, trade.Discount, f.quantity, discount)
+				}
+			}
+
+			placed, err := GetOrder(incoming, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if placed.Remaining != test.remaining {
+				t.Errorf("the incoming order has %d left, want %d", placed.Remaining, test.remaining)
+			}
+		})
+	}
+}
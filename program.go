@@ -0,0 +1,243 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Commercial paper may not run longer than 270 days unless an issuer's
+// program says otherwise
+const defaultMaxTenor = 270
+
+// Paper issued without a currency is in dollars
+const defaultCurrency = "USD"
+
+// Program is the issuance program an issuer's paper is issued under.
+// Authorized caps the face amount outstanding, added up across currencies
+// without conversion.
+type Program struct {
+	Authorized      Money    `json:"authorized"`
+	MaxTenor        int      `json:"maxTenor"`
+	MinDenomination Money    `json:"minDenomination"`
+	Currencies      []string `json:"currencies"`
+}
+
+// program is the issuance program of a company, and whether it has set
+// one. Accounts written before the program was optional carry an empty
+// one, which setProgram never stores as it always sets a tenor.
+func (a Account) program() (Program, bool) {
+	if a.Program == nil || a.Program.MaxTenor == 0 {
+		return Program{}, false
+	}
+	return *a.Program, true
+}
+
+// ProgramUsage compares an issuer's outstanding paper with its program.
+// Available is zero when the issuer has no program.
+type ProgramUsage struct {
+	Company     string  `json:"company"`
+	Program     Program `json:"program"`
+	Outstanding Money   `json:"outstanding"`
+	Available   Money   `json:"available"`
+}
+
+// currencyOf is the currency of a paper, which is dollars for paper issued
+// before papers had one
+func currencyOf(cp CP) string {
+	if cp.Currency == "" {
+		return defaultCurrency
+	}
+	return cp.Currency
+}
+
+// validCurrency reports whether code looks like an ISO 4217 code
+func validCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// allows reports whether the program allows paper in currency
+func (p Program) allows(currency string) bool {
+	for _, c := range p.Currencies {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// outstandingFace adds up the face amount of an issuer's paper that has
+// not matured
+func outstandingFace(issuer string, stub shim.ChaincodeStubInterface) (Money, error) {
+	var outstanding Money
+
+	err := scanCollection(stub, collections["cp"], func(key string, value []byte) error {
+		var cp CP
+		err := json.Unmarshal(value, &cp)
+		if err != nil {
+			fmt.Println("Error unmarshalling " + key)
+			return storageError(entityCP, key, "unmarshalling")
+		}
+		if cp.Issuer == issuer && !cp.Matured {
+			outstanding += cp.Par.Times(cp.Qty)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return outstanding, nil
+}
+
+// checkProgram makes sure issuing quantity more of a paper stays within
+// its issuer's program
+func checkProgram(stub shim.ChaincodeStubInterface, cp CP, quantity int) error {
+	issuer, err := GetCompany(cp.Issuer, stub)
+	if err != nil {
+		return err
+	}
+	// Issuers may not issue until a program caps what they may have
+	// outstanding
+	program, ok := issuer.program()
+	if !ok {
+		fmt.Println("The company " + cp.Issuer + " has no issuance program")
+		return programLimit(cp.Issuer, "program", "The company "+cp.Issuer+" has no issuance program, an admin has to set one with setProgram")
+	}
+
+	if cp.Maturity <= 0 || cp.Maturity > program.MaxTenor {
+		fmt.Println("Invalid maturity " + strconv.Itoa(cp.Maturity))
+		return programLimit(cp.Issuer, "maturity", "Maturity must be between 1 and "+strconv.Itoa(program.MaxTenor)+" days")
+	}
+	if cp.Par < program.MinDenomination {
+		fmt.Println("Par below minimum denomination " + program.MinDenomination.String())
+		return programLimit(cp.Issuer, "par", "Par must be at least "+program.MinDenomination.String())
+	}
+	if !program.allows(currencyOf(cp)) {
+		fmt.Println("Currency " + currencyOf(cp) + " is not in the program")
+		return programLimit(cp.Issuer, "currency", "The program of "+cp.Issuer+" does not allow paper in "+currencyOf(cp))
+	}
+
+	outstanding, err := outstandingFace(cp.Issuer, stub)
+	if err != nil {
+		return err
+	}
+	if outstanding+cp.Par.Times(quantity) > program.Authorized {
+		fmt.Println("Issue exceeds the program of " + cp.Issuer)
+		return programLimit(cp.Issuer, "qty", "Issuing "+cp.Par.Times(quantity).String()+" would exceed the program of "+cp.Issuer+", "+(program.Authorized-outstanding).String()+" is available")
+	}
+
+	return nil
+}
+
+func (t *SimpleChaincode) setProgram(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0			1
+		company		json
+	  				{
+						"authorized": 1000000.00,
+						"maxTenor": 270, // optional, in days
+						"minDenomination": 1000.00,
+						"currencies": ["USD"] // optional
+					}
+	*/
+	if len(args) != 2 {
+		return nil, badArguments("setProgram", "company and program record")
+	}
+
+	var program Program
+	fmt.Println("Unmarshalling Program")
+	err := json.Unmarshal([]byte(args[1]), &program)
+	if err != nil {
+		fmt.Println("Error unmarshalling program")
+		return nil, invalidRecord(entityProgram, err)
+	}
+
+	if program.MaxTenor == 0 {
+		program.MaxTenor = defaultMaxTenor
+	}
+	if len(program.Currencies) == 0 {
+		program.Currencies = []string{defaultCurrency}
+	}
+	if program.Authorized <= 0 {
+		fmt.Println("Invalid authorized amount " + program.Authorized.String())
+		return nil, invalidField(entityProgram, args[0], "authorized", "The authorized amount must be positive")
+	}
+	if program.MinDenomination < 0 || program.MaxTenor < 0 {
+		fmt.Println("Invalid program")
+		return nil, invalidField(entityProgram, args[0], "minDenomination", "Program amounts and tenor cannot be negative")
+	}
+	for _, currency := range program.Currencies {
+		if !validCurrency(currency) {
+			fmt.Println("Invalid currency " + currency)
+			return nil, invalidField(entityProgram, args[0], "currencies", "Invalid currency "+currency)
+		}
+	}
+
+	company, err := GetCompany(args[0], stub)
+	if err != nil {
+		return nil, err
+	}
+	company.Program = &program
+	err = PutCompany(company, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityAccount, actionUpdated, accountPrefix+company.ID, "", "")
+	fmt.Println("Set the issuance program of " + company.ID)
+	return nil, nil
+}
+
+// GetProgramUsage returns how much of an issuer's program is used
+func GetProgramUsage(companyID string, stub shim.ChaincodeStubInterface) (ProgramUsage, error) {
+	usage := ProgramUsage{Company: companyID}
+
+	company, err := GetCompany(companyID, stub)
+	if err != nil {
+		return usage, err
+	}
+	program, ok := company.program()
+	usage.Program = program
+
+	usage.Outstanding, err = outstandingFace(companyID, stub)
+	if err != nil {
+		return usage, err
+	}
+	if !ok {
+		return usage, nil
+	}
+	usage.Available = usage.Program.Authorized - usage.Outstanding
+	if usage.Available < 0 {
+		usage.Available = 0
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import "testing"
+
+func TestIssueIgnoresClientOwners(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "3")
+	s.mustInvoke("setProgram", "company1", `{"authorized":100000}`)
+	cusip := s.issue(`{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":30,"issuer":"company1","matured":true,
+		"owner":[{"company":"company2","quantity":1000,"reserved":4,"pledged":3}]}`)
+
+	cp := s.cp(cusip)
+	if len(cp.Owners) != 1 || cp.Owners[0] != (Owner{Company: "company1", Quantity: 10}) {
+		t.Fatalf("owners are %+v, want company1 holding all 10", cp.Owners)
+	}
+	if cp.Matured {
+		t.Fatal("new paper is marked matured")
+	}
+}
+
+func TestIssueRejectsNonPositiveTerms(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "1")
+	s.mustFail(codeInvalidField, "issueCommercialPaper", `{"ticker":"ABC","par":1000,"qty":-5,"discount":5,"maturity":30,"issuer":"company1"}`)
+	s.mustFail(codeInvalidField, "issueCommercialPaper", `{"ticker":"ABC","par":0,"qty":5,"discount":5,"maturity":30,"issuer":"company1"}`)
+	s.mustFail(codeInvalidField, "issueCommercialPaper", `{"ticker":"ABC","par":1000,"qty":5,"discount":-0.5,"maturity":30,"issuer":"company1"}`)
+	s.mustFail(codeInvalidField, "issueCommercialPaper", `{"ticker":"ABC","par":1000,"qty":5,"discount":100,"maturity":30,"issuer":"company1"}`)
+	s.mustFail(codeInvalidField, "issueCommercialPaper", `{"ticker":"ABC","par":1000,"qty":5,"discount":250,"maturity":30,"issuer":"company1"}`)
+
+	s.mustInvoke("setProgram", "company1", `{"authorized":100000}`)
+	s.issue(`{"ticker":"ABC","par":1000,"qty":5,"discount":0,"maturity":30,"issuer":"company1"}`)
+	s.issue(`{"ticker":"ABC","par":1000,"qty":5,"discount":99.5,"maturity":30,"issuer":"company1"}`)
+}
+
+func TestIssueRequiresAProgram(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "1")
+	s.mustFail(codeProgramLimit, "issueCommercialPaper", `{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":30,"issuer":"company1"}`)
+	s.mustFail(codeInvalidField, "setProgram", "company1", `{"authorized":0}`)
+	s.mustFail(codeInvalidField, "setProgram", "company1", `{"authorized":-1}`)
+
+	s.mustInvoke("setProgram", "company1", `{"authorized":100000}`)
+	s.issue(`{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":270,"issuer":"company1"}`)
+	s.mustFail(codeProgramLimit, "issueCommercialPaper", `{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":271,"issuer":"company1"}`)
+
+	var usage ProgramUsage
+	s.mustQuery(&usage, "GetProgramUsage", "company1")
+	if usage.Program.MaxTenor != defaultMaxTenor || usage.Outstanding != Money(1000000) || usage.Available != Money(9000000) {
+		t.Fatalf("usage is %+v, want the default tenor with 10000.00 outstanding and 90000.00 available", usage)
+	}
+}
+
+func TestProgramCapsOutstandingFace(t *testing.T) {
+	s, _ := newMarket(t)
+	s.mustFail(codeProgramLimit, "issueCommercialPaper", `{"ticker":"ABC","par":1000,"qty":91,"discount":5,"maturity":30,"issuer":"company1"}`)
+	s.issue(`{"ticker":"ABC","par":1000,"qty":90,"discount":5,"maturity":30,"issuer":"company1"}`)
+
+	var usage ProgramUsage
+	s.mustQuery(&usage, "GetProgramUsage", "company1")
+	if usage.Available != 0 {
+		t.Fatalf("%s of the program is available, want none", usage.Available)
+	}
+}
+
+func TestProgramKeepsItsLimits(t *testing.T) {
+	s := newTestStub(t)
+	s.mustInvoke("createAccounts", "1")
+	s.mustInvoke("setProgram", "company1", `{"authorized":100000,"maxTenor":90,"minDenomination":5000,"currencies":["EUR"]}`)
+	s.mustFail(codeProgramLimit, "issueCommercialPaper", `{"ticker":"ABC","par":5000,"qty":10,"discount":5,"maturity":91,"issuer":"company1","currency":"EUR"}`)
+	s.mustFail(codeProgramLimit, "issueCommercialPaper", `{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":90,"issuer":"company1","currency":"EUR"}`)
+	s.mustFail(codeProgramLimit, "issueCommercialPaper", `{"ticker":"ABC","par":5000,"qty":10,"discount":5,"maturity":90,"issuer":"company1"}`)
+	s.issue(`{"ticker":"ABC","par":5000,"qty":20,"discount":5,"maturity":90,"issuer":"company1","currency":"EUR"}`)
+
+	var usage ProgramUsage
+	s.mustQuery(&usage, "GetProgramUsage", "company1")
+	if usage.Program.MaxTenor != 90 || usage.Available != 0 {
+		t.Fatalf("usage is %+v, want a 90 day tenor with the program used up", usage)
+	}
+}
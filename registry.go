@@ -0,0 +1,432 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Kinds of function the chaincode serves
+const (
+	kindInvoke = "invoke"
+	kindQuery  = "query"
+)
+
+// Types an argument can have, as listed by ListFunctions
+const (
+	argJSON    = "json"
+	argString  = "string"
+	argInteger = "integer"
+	argAmount  = "amount"
+	argRate    = "rate"
+	argTime    = "milliseconds"
+)
+
+// handler runs a registered function. Queries get their arguments without
+// the query name.
+type handler func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error)
+
+// Arg describes one argument of a registered function
+type Arg struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Optional    bool   `json:"optional,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Function is an invoke or query the chaincode serves. Roles lists who may
+// call it; an admin may call anything, so admin-only functions list no
+// roles. Anyone may call a public query.
+type Function struct {
+	Name        string   `json:"name"`
+	Kind        string   `json:"kind"`
+	Description string   `json:"description"`
+	Roles       []string `json:"roles"`
+	Public      bool     `json:"public,omitempty"`
+	Args        []Arg    `json:"args"`
+	run         handler
+}
+
+// Argument lists shared by several functions
+var (
+	noArgs    = []Arg{}
+	cusipArg  = []Arg{{Name: "cusip", Type: argString}}
+	tradeArg  = []Arg{{Name: "tradeId", Type: argString}}
+	repoArg   = []Arg{{Name: "repoId", Type: argString}}
+	cashArg   = []Arg{{Name: "company", Type: argString}, {Name: "amount", Type: argAmount}, {Name: "reference", Type: argString}}
+	statusArg = func(number string) []Arg {
+		return []Arg{{Name: number, Type: argString}, {Name: "status", Type: argString}}
+	}
+	recordArg = func(record string) []Arg {
+		return []Arg{{Name: record, Type: argJSON}}
+	}
+	companyArg = []Arg{{Name: "company", Type: argString}}
+)
+
+// Roles for invokes any trading party may call
+var traders = []string{roleIssuer, roleInvestor, roleBank}
+
+// Roles for the property registry
+var landParties = []string{roleRegistrar, roleInvestor, roleBank}
+
+// Roles for queries any party may call
+var parties = []string{roleIssuer, roleInvestor, roleBank, roleCarrier, roleRegistrar}
+
+var invokeFunctions = []Function{
+	{Name: "init", Description: "Checks the key layout", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			return t.Init(stub, "init", args)
+		}},
+	{Name: "createAccounts", Description: "Creates numbered test accounts", Args: []Arg{{Name: "count", Type: argInteger}}, run: (*SimpleChaincode).createAccounts},
+	{Name: "createAccount", Description: "Creates an account", Args: []Arg{{Name: "name", Type: argString}}, run: (*SimpleChaincode).createAccount},
+	{Name: "migrateMoney", Description: "Rewrites amounts as fixed point", Args: noArgs, run: (*SimpleChaincode).migrateMoney},
+	{Name: "dropKeyArrays", Description: "Removes the old key collections", Args: noArgs, run: (*SimpleChaincode).dropKeyArrays},
+	{Name: "migrateKeys", Description: "Moves records to prefixed keys", Args: noArgs, run: (*SimpleChaincode).migrateKeys},
+	{Name: "migrateDates", Description: "Rewrites record times in milliseconds", Args: noArgs, run: (*SimpleChaincode).migrateDates},
+	{Name: "setProgram", Description: "Sets an issuer's paper program", Args: []Arg{{Name: "company", Type: argString}, {Name: "program", Type: argJSON}}, run: (*SimpleChaincode).setProgram},
+	{Name: "openJournals", Description: "Writes opening journal entries", Args: noArgs, run: (*SimpleChaincode).openJournals},
+	{Name: "rebuildHoldings", Description: "Rebuilds holdings from paper owners", Args: noArgs, run: (*SimpleChaincode).rebuildHoldings},
+	{Name: "depositCash", Roles: []string{roleBank}, Description: "Pays cash into an account", Args: cashArg, run: (*SimpleChaincode).depositCash},
+	{Name: "withdrawCash", Roles: []string{roleBank}, Description: "Pays cash out of an account", Args: cashArg, run: (*SimpleChaincode).withdrawCash},
+	{Name: "issueCommercialPaper", Roles: []string{roleIssuer}, Description: "Issues paper or adds to an issue", Args: recordArg("paper"), run: (*SimpleChaincode).issueCommercialPaper},
+	{Name: "transferPaper", Roles: traders, Description: "Sells paper for cash", Args: recordArg("transfer"), run: (*SimpleChaincode).transferPaper},
+	{Name: "redeemPaper", Roles: []string{roleIssuer}, Description: "Pays off matured paper", Args: cusipArg, run: (*SimpleChaincode).redeemPaper},
+	{Name: "proposeTrade", Roles: traders, Description: "Proposes a trade", Args: recordArg("trade"), run: (*SimpleChaincode).proposeTrade},
+	{Name: "acceptTrade", Roles: traders, Description: "Accepts a proposed trade", Args: tradeArg, run: (*SimpleChaincode).acceptTrade},
+	{Name: "settleTrade", Roles: traders, Description: "Settles an accepted trade", Args: tradeArg, run: (*SimpleChaincode).settleTrade},
+	{Name: "cancelTrade", Roles: traders, Description: "Cancels an open trade", Args: tradeArg, run: (*SimpleChaincode).cancelTrade},
+	{Name: "expireTrade", Roles: traders, Description: "Expires a trade past its deadline", Args: tradeArg, run: (*SimpleChaincode).expireTrade},
+	{Name: "openRepo", Roles: traders, Description: "Pledges paper for a repo", Args: recordArg("repo"), run: (*SimpleChaincode).openRepo},
+	{Name: "fundRepo", Roles: traders, Description: "Lends the cash of a repo", Args: repoArg, run: (*SimpleChaincode).fundRepo},
+	{Name: "closeRepo", Roles: traders, Description: "Repays a repo", Args: repoArg, run: (*SimpleChaincode).closeRepo},
+	{Name: "defaultRepo", Roles: traders, Description: "Takes the collateral of an unpaid repo", Args: repoArg, run: (*SimpleChaincode).defaultRepo},
+	{Name: "cancelRepo", Roles: traders, Description: "Cancels an unfunded repo", Args: repoArg, run: (*SimpleChaincode).cancelRepo},
+	{Name: "placeOrder", Roles: traders, Description: "Places an order on the book", Args: recordArg("order"), run: (*SimpleChaincode).placeOrder},
+	{Name: "cancelOrder", Roles: traders, Description: "Cancels an order", Args: []Arg{{Name: "orderId", Type: argString}}, run: (*SimpleChaincode).cancelOrder},
+	{Name: "announceAuction", Roles: []string{roleIssuer}, Description: "Announces a paper auction", Args: recordArg("auction"), run: (*SimpleChaincode).announceAuction},
+	{Name: "submitAuctionBid", Roles: []string{roleInvestor, roleBank}, Description: "Bids in an auction", Args: recordArg("bid"), run: (*SimpleChaincode).submitAuctionBid},
+	{Name: "closeAuction", Roles: []string{roleIssuer}, Description: "Allocates an auction", Args: []Arg{{Name: "auctionId", Type: argString}}, run: (*SimpleChaincode).closeAuction},
+	{Name: "expireAuction", Roles: traders, Description: "Expires an auction its issuer did not close", Args: []Arg{{Name: "auctionId", Type: argString}}, run: (*SimpleChaincode).expireAuction},
+	{Name: "issueQuote", Roles: []string{roleIssuer, roleInvestor}, Description: "Creates or adds to a quote", Args: recordArg("quote"), run: (*SimpleChaincode).issueQuote},
+	{Name: "ChangeStatusQuote", Roles: []string{roleIssuer, roleInvestor}, Description: "Changes the status and price of a quote", Args: []Arg{{Name: "quoteNo", Type: argString}, {Name: "status", Type: argString}, {Name: "price", Type: argAmount}}, run: (*SimpleChaincode).ChangeStatusQuote},
+	{Name: "issuePurchaseOrder", Roles: []string{roleIssuer, roleInvestor}, Description: "Creates or updates a purchase order", Args: recordArg("purchaseOrder"), run: (*SimpleChaincode).issuePurchaseOrder},
+	{Name: "ChangeStatusPO", Roles: []string{roleIssuer, roleInvestor}, Description: "Changes the status of a purchase order", Args: statusArg("poNumber"), run: (*SimpleChaincode).ChangeStatusPO},
+	{Name: "issueLetter_Credit", Roles: []string{roleBank}, Description: "Creates or updates a letter of credit", Args: recordArg("letterOfCredit"), run: (*SimpleChaincode).issueLetter_Credit},
+	{Name: "ChangeStatusLC", Roles: []string{roleBank}, Description: "Changes the status of a letter of credit", Args: statusArg("lcNumber"), run: (*SimpleChaincode).ChangeStatusLC},
+	{Name: "issueBill_Lading", Roles: []string{roleCarrier}, Description: "Creates or updates a bill of lading", Args: recordArg("billOfLading"), run: (*SimpleChaincode).issueBill_Lading},
+	{Name: "ChangeStatusBL", Roles: []string{roleCarrier}, Description: "Changes the status of a bill of lading", Args: statusArg("blNumber"), run: (*SimpleChaincode).ChangeStatusBL},
+	{Name: "addProperty", Roles: []string{roleRegistrar}, Description: "Registers a property", Args: recordArg("property"), run: (*SimpleChaincode).addProperty},
+	{Name: "addNotification", Roles: []string{roleRegistrar}, Description: "Adds a notification", Args: recordArg("notification"), run: (*SimpleChaincode).addNotification},
+	{Name: "issueProposal", Roles: []string{roleInvestor, roleBank}, Description: "Proposes a property sale", Args: recordArg("proposal"), run: (*SimpleChaincode).issueProposal},
+	{Name: "issueSaleAgreement", Roles: []string{roleInvestor, roleBank}, Description: "Records a sale agreement", Args: recordArg("saleAgreement"), run: (*SimpleChaincode).issueSaleAgreement},
+	{Name: "issueSaleDeeds", Roles: []string{roleRegistrar}, Description: "Records a sale deed", Args: recordArg("saleDeed"), run: (*SimpleChaincode).issueSaleDeeds},
+	// Each step of a batch is checked against its own policy
+	{Name: batchFunction, Roles: parties, Description: "Runs several invokes in one transaction", Args: recordArg("steps"), run: (*SimpleChaincode).batch},
+}
+
+var queryFunctions = []Function{
+	{Name: "ListFunctions", Public: true, Description: "Lists the invokes and queries", Args: noArgs, run: listFunctions},
+	{Name: "GetAllCPs", Roles: traders, Description: "All commercial paper", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allCPs, err := GetAllCPs(stub)
+			return queryResult("allcps", &allCPs, err)
+		}},
+	{Name: "GetCP", Public: true, Description: "One commercial paper", Args: []Arg{{Name: "key", Type: argString, Description: "CUSIP or cp: key of the paper"}},
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			// Only paper can be read this way, whatever key is given
+			key := args[0]
+			if !strings.HasPrefix(key, cpPrefix) {
+				key = cpPrefix + key
+			}
+			cp, err := GetCP(key, stub)
+			return queryResult("the cp", &cp, err)
+		}},
+	{Name: "GetCompany", Roles: parties, Description: "One account", Args: companyArg,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			err := requireCompany(stub, "GetCompany", args[0])
+			if err != nil {
+				return nil, err
+			}
+			company, err := GetCompany(args[0], stub)
+			return queryResult("the company", &company, err)
+		}},
+	{Name: "GetAllQuotes", Roles: []string{roleIssuer, roleInvestor}, Description: "All quotes", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allQuotes, err := GetAllQuotes(stub)
+			return queryResult("all quotes", &allQuotes, err)
+		}},
+	{Name: "GetAllPo", Roles: []string{roleIssuer, roleInvestor}, Description: "All purchase orders", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allPo, err := GetAllPo(stub)
+			return queryResult("all po", &allPo, err)
+		}},
+	{Name: "GetAllLcs", Roles: []string{roleBank}, Description: "All letters of credit", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allLc, err := GetAllLcs(stub)
+			return queryResult("all lc", &allLc, err)
+		}},
+	{Name: "GetAllBl", Roles: []string{roleCarrier}, Description: "All bills of lading", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allBl, err := GetAllBl(stub)
+			return queryResult("all bl", &allBl, err)
+		}},
+	{Name: "GetAllProperties", Roles: landParties, Description: "All properties", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allProperties, err := GetAllProperties(stub)
+			return queryResult("all properties", &allProperties, err)
+		}},
+	{Name: "GetAllproposal", Roles: landParties, Description: "All sale proposals", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allProposal, err := GetAllproposal(stub)
+			return queryResult("all proposals", &allProposal, err)
+		}},
+	{Name: "GetAllAgreement", Roles: landParties, Description: "All sale agreements", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allSaleAgreement, err := GetAllAgreement(stub)
+			return queryResult("all agreements", &allSaleAgreement, err)
+		}},
+	{Name: "GetAllDeed", Roles: landParties, Description: "All sale deeds", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allSaleDeed, err := GetAllDeed(stub)
+			return queryResult("all deeds", &allSaleDeed, err)
+		}},
+	{Name: "GetAllNotifications", Roles: landParties, Description: "All notifications", Args: noArgs,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			allNotification, err := GetAllNotifications(stub)
+			return queryResult("all notifications", &allNotification, err)
+		}},
+	{Name: "GetPage", Roles: parties, Description: "A page of a collection", Args: []Arg{
+		{Name: "collection", Type: argString},
+		{Name: "pageSize", Type: argInteger},
+		{Name: "startKey", Type: argString, Optional: true, Description: "the nextKey of the previous page"},
+	}, run: queryPage},
+	{Name: "GetTrade", Roles: traders, Description: "One trade", Args: tradeArg,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			trade, err := GetTrade(args[0], stub)
+			if err == nil {
+				err = requireCompany(stub, "GetTrade", trade.Seller, trade.Buyer)
+			}
+			return queryResult("the trade", &trade, err)
+		}},
+	{Name: "GetRepo", Roles: traders, Description: "One repo", Args: repoArg,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			repo, err := GetRepo(args[0], stub)
+			if err == nil {
+				err = requireCompany(stub, "GetRepo", repo.Borrower, repo.Lender)
+			}
+			return queryResult("the repo", &repo, err)
+		}},
+	{Name: "GetOrderBook", Public: true, Description: "The open orders for a paper", Args: cusipArg,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			book, err := GetOrderBook(args[0], stub)
+			return queryResult("the order book", &book, err)
+		}},
+	{Name: "GetOpenOrders", Roles: traders, Description: "A company's open orders", Args: companyArg,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			err := requireCompany(stub, "GetOpenOrders", args[0])
+			if err != nil {
+				return nil, err
+			}
+			orders, err := GetOpenOrders(args[0], stub)
+			return queryResult("open orders", &orders, err)
+		}},
+	{Name: "GetAuction", Roles: traders, Description: "One auction", Args: []Arg{{Name: "auctionId", Type: argString}},
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			auction, err := GetAuction(args[0], stub)
+			return queryResult("the auction", &auction, err)
+		}},
+	{Name: "GetAuctionBids", Roles: traders, Description: "The bids in an auction", Args: []Arg{{Name: "auctionId", Type: argString}},
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			bids, err := GetAuctionBids(args[0], stub)
+			return queryResult("auction bids", &bids, err)
+		}},
+	{Name: "GetProgramUsage", Roles: []string{roleIssuer}, Description: "How much of an issuer's program is used", Args: companyArg,
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			err := requireCompany(stub, "GetProgramUsage", args[0])
+			if err != nil {
+				return nil, err
+			}
+			usage, err := GetProgramUsage(args[0], stub)
+			return queryResult("program usage", &usage, err)
+		}},
+	{Name: "GetPortfolio", Roles: traders, Description: "A company's holdings marked to market", Args: []Arg{
+		{Name: "company", Type: argString},
+		{Name: "asOf", Type: argTime, Optional: true, Description: "defaults to the transaction time"},
+	}, run: queryPortfolio},
+	{Name: "GetYield", Roles: traders, Description: "Price and yields of a paper", Args: []Arg{
+		{Name: "cusip", Type: argString},
+		{Name: "settlement", Type: argTime},
+		{Name: "discount", Type: argRate, Optional: true, Description: "defaults to the discount of the paper"},
+	}, run: queryYield},
+	{Name: "GetStatement", Roles: traders, Description: "A company's cash statement", Args: []Arg{
+		{Name: "company", Type: argString},
+		{Name: "from", Type: argTime},
+		{Name: "to", Type: argTime},
+	}, run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+		err := requireCompany(stub, "GetStatement", args[0])
+		if err != nil {
+			return nil, err
+		}
+		statement, err := GetStatement(args[0], args[1], args[2], stub)
+		return queryResult("the statement", &statement, err)
+	}},
+	{Name: "GetRequest", Roles: parties, Description: "The invoke made with an idempotency key", Args: []Arg{{Name: "key", Type: argString}}, run: queryRequest},
+	// Auditors see every version of a record, whichever company wrote it
+	{Name: "GetHistory", Roles: []string{roleAuditor}, Description: "The versions of a record", Args: []Arg{{Name: "key", Type: argString}},
+		run: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			history, err := GetHistory(args[0], stub)
+			return queryResult("history", &history, err)
+		}},
+}
+
+// registry finds the functions by kind and name. It is filled in init, as
+// ListFunctions reads it.
+var registry = map[string]map[string]*Function{}
+
+func init() {
+	for _, kind := range []struct {
+		name      string
+		functions []Function
+	}{{kindInvoke, invokeFunctions}, {kindQuery, queryFunctions}} {
+		registry[kind.name] = map[string]*Function{}
+		for i := range kind.functions {
+			function := &kind.functions[i]
+			function.Kind = kind.name
+			if function.Roles == nil {
+				function.Roles = []string{}
+			}
+			registry[kind.name][function.Name] = function
+		}
+	}
+}
+
+// lookupFunction returns the registered function, or nil if there is none
+func lookupFunction(kind string, name string) *Function {
+	return registry[kind][name]
+}
+
+// checkArgs makes sure the function got its required arguments
+func (f *Function) checkArgs(args []string) error {
+	required := 0
+	var names []string
+	for _, arg := range f.Args {
+		if arg.Optional {
+			names = append(names, "optional "+arg.Name)
+			continue
+		}
+		required++
+		names = append(names, arg.Name)
+	}
+	if len(args) >= required {
+		return nil
+	}
+	return badArguments(f.Name, strings.Join(names, ", "))
+}
+
+// authorize checks the caller holds one of the roles allowed to call the
+// function
+func (f *Function) authorize(stub shim.ChaincodeStubInterface) error {
+	if f.Public {
+		return nil
+	}
+
+	for _, role := range append([]string{roleAdmin}, f.Roles...) {
+		ok, err := hasRole(stub, role)
+		if err != nil {
+			return &PermissionError{f.Name, "the caller certificate has no " + roleAttribute + " attribute"}
+		}
+		if ok {
+			fmt.Println("Caller has role " + role + " for " + f.Name)
+			return nil
+		}
+	}
+
+	if len(f.Roles) == 0 {
+		return &PermissionError{f.Name, "requires the " + roleAdmin + " role"}
+	}
+	if len(f.Roles) == 1 {
+		return &PermissionError{f.Name, "requires the " + f.Roles[0] + " role"}
+	}
+	return &PermissionError{f.Name, "requires one of the roles " + strings.Join(f.Roles, ", ")}
+}
+
+// call checks the arguments and runs the function
+func (f *Function) call(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	err := f.checkArgs(args)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+	fmt.Println("Firing " + f.Name)
+	return f.run(t, stub, args)
+}
+
+// queryResult marshals what a query found
+func queryResult(what string, result interface{}, err error) ([]byte, error) {
+	if err != nil {
+		fmt.Println("Error getting " + what)
+		return nil, err
+	}
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		fmt.Println("Error marshalling " + what)
+		return nil, err
+	}
+	fmt.Println("All success, returning " + what)
+	return resultBytes, nil
+}
+
+// listFunctions returns the registered invokes and queries, by name
+func listFunctions(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var functions []Function
+	for _, kind := range []string{kindInvoke, kindQuery} {
+		var names []string
+		for name := range registry[kind] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			functions = append(functions, *registry[kind][name])
+		}
+	}
+	return queryResult("the functions", &functions, nil)
+}
+
+// rawState reads any key directly. Only an admin may, since it bypasses
+// every query's checks.
+func rawState(stub shim.ChaincodeStubInterface, key string) ([]byte, error) {
+	admin, err := hasRole(stub, roleAdmin)
+	if err != nil || !admin {
+		return nil, &PermissionError{key, "unknown query, reading raw state requires the " + roleAdmin + " role"}
+	}
+
+	fmt.Println("Generic Query call")
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		fmt.Println("Error reading " + key)
+		return nil, storageError(entityRecord, key, "reading")
+	}
+	fmt.Println("All success, returning from generic")
+	return stateBytes, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import "testing"
+
+func TestRawKeyQueriesAreScoped(t *testing.T) {
+	s, cusip := newMarket(t)
+
+	var cp CP
+	s.mustQuery(&cp, "GetCP", cusip)
+	if cp.CUSIP != cusip {
+		t.Fatalf("GetCP by CUSIP returned %s", cp.CUSIP)
+	}
+	_, err := s.query("GetCP", accountPrefix+"company1")
+	checkCode(t, err, codeNotFound)
+
+	s.as(roleInvestor, "company2")
+	_, err = s.query("GetHistory", accountPrefix+"company1")
+	checkCode(t, err, codePermission)
+
+	s.as(roleAuditor, "auditor")
+	var history []Version
+	s.mustQuery(&history, "GetHistory", accountPrefix+"company1")
+	if len(history) == 0 {
+		t.Fatal("an auditor sees no history for company1")
+	}
+	_, err = s.query("GetHistory", requestPrefix+"company1:k1")
+	checkCode(t, err, codeInvalidField)
+}
+
+func TestQueriesCheckRolesAndCompany(t *testing.T) {
+	s, cusip := newMarket(t)
+
+	s.as(roleInvestor, "company2")
+	var company Account
+	s.mustQuery(&company, "GetCompany", "company2")
+	for _, args := range [][]string{
+		{"GetCompany", "company1"},
+		{"GetOpenOrders", "company1"},
+		{"GetPortfolio", "company1"},
+		{"GetStatement", "company1", "0", timeToMs(s.now)},
+		{"GetAllLcs"},
+	} {
+		_, err := s.query(args...)
+		checkCode(t, err, codePermission)
+	}
+
+	s.as(roleCarrier, "company3")
+	var book OrderBook
+	s.mustQuery(&book, "GetOrderBook", cusip)
+	var cp CP
+	s.mustQuery(&cp, "GetCP", cusip)
+	_, err := s.query("GetAllCPs")
+	checkCode(t, err, codePermission)
+
+	var functions []Function
+	s.mustQuery(&functions, "ListFunctions")
+	for _, function := range functions {
+		if function.Kind == kindQuery && function.Public != (function.Name == "ListFunctions" || function.Name == "GetCP" || function.Name == "GetOrderBook") {
+			t.Errorf("query %s is public: %v", function.Name, function.Public)
+		}
+	}
+}
@@ -0,0 +1,563 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var repoPrefix = keyPrefix("repo")
+
+// Repo interest accrues on the actual days over a 360 day year
+const repoBasis = 360
+
+// A repo is proposed by the borrower and opened when the lender funds it,
+// which pledges the borrower's paper to the lender. The borrower closes it
+// by paying back the cash with interest, or after the repurchase deadline
+// the lender can take title to the collateral. Until it is funded either
+// side can cancel it, and the paper stays free to sell or redeem.
+var repoStatuses = statusMachine{
+	document: "repo",
+	initial:  "proposed",
+	transitions: map[string][]string{
+		"proposed":  {"open", "cancelled"},
+		"open":      {"closed", "defaulted"},
+		"closed":    {},
+		"defaulted": {},
+		"cancelled": {},
+	},
+}
+
+const (
+	repoProposed  = "proposed"
+	repoOpen      = "open"
+	repoClosed    = "closed"
+	repoDefaulted = "defaulted"
+	repoCancelled = "cancelled"
+)
+
+// Repo is a loan of cash against paper pledged as collateral. The cash
+// lent is the collateral's value less the haircut, and the repurchase
+// amount adds interest at the repo rate from funding to the deadline.
+type Repo struct {
+	ID           string `json:"id"`
+	CUSIP        string `json:"cusip"`
+	Borrower     string `json:"borrower"`
+	Lender       string `json:"lender"`
+	Quantity     int    `json:"quantity"`
+	Haircut      Rate   `json:"haircut"`
+	Rate         Rate   `json:"rate"`
+	Collateral   Money  `json:"collateral"`
+	Cash         Money  `json:"cash"`
+	Repurchase   Money  `json:"repurchase"`
+	RepurchaseBy string `json:"repurchaseBy"`
+	Status       string `json:"status"`
+	ProposedOn   string `json:"proposedOn"`
+	OpenedOn     string `json:"openedOn"`
+	ModifiedOn   string `json:"modifiedOn"`
+}
+
+func GetRepo(repoID string, stub shim.ChaincodeStubInterface) (Repo, error) {
+	var repo Repo
+
+	repoBytes, err := stub.GetState(repoPrefix + repoID)
+	if err != nil {
+		fmt.Println("Error retrieving repo " + repoID)
+		return repo, storageError(entityRepo, repoID, "retrieving")
+	}
+	if repoBytes == nil {
+		fmt.Println("Repo " + repoID + " does not exist")
+		return repo, notFound(entityRepo, repoID)
+	}
+
+	err = json.Unmarshal(repoBytes, &repo)
+	if err != nil {
+		fmt.Println("Error unmarshalling repo " + repoID)
+		return repo, storageError(entityRepo, repoID, "unmarshalling")
+	}
+
+	return repo, nil
+}
+
+func PutRepo(repo Repo, stub shim.ChaincodeStubInterface) error {
+	repoBytes, err := json.Marshal(&repo)
+	if err != nil {
+		fmt.Println("Error marshalling repo " + repo.ID)
+		return storageError(entityRepo, repo.ID, "marshalling")
+	}
+
+	err = putState(stub, repoPrefix+repo.ID, repoBytes)
+	if err != nil {
+		fmt.Println("Error writing repo " + repo.ID)
+		return storageError(entityRepo, repo.ID, "writing")
+	}
+
+	return nil
+}
+
+// moveRepo changes the status of a repo and records the event for it
+func moveRepo(stub shim.ChaincodeStubInterface, repo *Repo, status string, action string, now time.Time) error {
+	oldStatus := repo.Status
+	err := repoStatuses.move(oldStatus, status)
+	if err != nil {
+		return err
+	}
+
+	repo.Status = status
+	repo.ModifiedOn = timeToMs(now)
+	err = PutRepo(*repo, stub)
+	if err != nil {
+		return err
+	}
+
+	recordEvent(stub, entityRepo, action, repoPrefix+repo.ID, oldStatus, repo.Status)
+	return nil
+}
+
+// pledgePaper locks quantity of a holder's paper as collateral, or frees
+// it when quantity is negative. Pledged paper can't be sold or reserved.
+func pledgePaper(stub shim.ChaincodeStubInterface, cusip string, holder string, quantity int) error {
+	cp, err := GetCP(cpPrefix+cusip, stub)
+	if err != nil {
+		return err
+	}
+
+	for i, owner := range cp.Owners {
+		if owner.Company != holder {
+			continue
+		}
+		if owner.available() < quantity {
+			fmt.Println("The company " + holder + " doesn't own enough of this paper")
+			return insufficientPaper(cusip, "The company "+holder+" doesn't own enough unencumbered "+cusip)
+		}
+		if owner.Pledged+quantity < 0 {
+			fmt.Println("The company " + holder + " has less of this paper pledged")
+			return insufficientPaper(cusip, "The company "+holder+" has less than "+strconv.Itoa(-quantity)+" of "+cusip+" pledged")
+		}
+
+		cp.Owners[i].Pledged += quantity
+		return PutCP(cp, stub)
+	}
+
+	fmt.Println("The company " + holder + " doesn't own any of this paper")
+	return insufficientPaper(cusip, "The company "+holder+" doesn't own any of "+cusip)
+}
+
+// repurchaseAmount is the cash lent plus repo interest from opened to the
+// repurchase deadline
+func repurchaseAmount(repo Repo, opened time.Time) (Money, error) {
+	deadline, err := msToTime(repo.RepurchaseBy)
+	if err != nil {
+		return 0, err
+	}
+
+	days := actualDays(opened, deadline)
+	if days < 0 {
+		days = 0
+	}
+	interest := new(big.Rat).Mul(repo.Rate.Fraction(), big.NewRat(int64(days), repoBasis))
+	factor := interest.Add(interest, big.NewRat(1, 1))
+	return MoneyFromRat(new(big.Rat).Mul(repo.Cash.Rat(), factor), RoundHalfEven)
+}
+
+func (t *SimpleChaincode) openRepo(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		json
+	  	{
+			  "cusip": "",
+			  "borrower": "",
+			  "lender": "",
+			  "quantity": 1,
+			  "haircut": 2.0, // percent taken off the collateral's value
+			  "rate": 4.5, // repo rate, simple interest on ACT/360
+			  "repurchaseBy": "" // deadline in milliseconds, before the paper matures
+		}
+	*/
+	if len(args) != 1 {
+		return nil, badArguments("openRepo", "repo record")
+	}
+
+	var repo Repo
+	fmt.Println("Unmarshalling Repo")
+	err := json.Unmarshal([]byte(args[0]), &repo)
+	if err != nil {
+		fmt.Println("Error unmarshalling repo")
+		return nil, invalidRecord(entityRepo, err)
+	}
+
+	// Only the borrower may pledge its paper
+	err = requireCompany(stub, "openRepo", repo.Borrower)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	if repo.Borrower == repo.Lender {
+		fmt.Println("The borrower and lender are the same company")
+		return nil, invalidField(entityRepo, "", "lender", "The company "+repo.Borrower+" cannot lend to itself")
+	}
+	if repo.Quantity <= 0 {
+		fmt.Println("Invalid quantity " + strconv.Itoa(repo.Quantity))
+		return nil, invalidField(entityRepo, "", "quantity", "Invalid quantity "+strconv.Itoa(repo.Quantity))
+	}
+	if repo.Haircut < 0 || repo.Haircut >= Rate(100*1000000) {
+		fmt.Println("Invalid haircut " + repo.Haircut.String())
+		return nil, invalidField(entityRepo, "", "haircut", "The haircut must be at least 0 and less than 100, not "+repo.Haircut.String())
+	}
+	if repo.Rate < 0 {
+		fmt.Println("Invalid repo rate " + repo.Rate.String())
+		return nil, invalidField(entityRepo, "", "rate", "Invalid repo rate "+repo.Rate.String())
+	}
+
+	cp, err := GetCP(cpPrefix+repo.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Matured {
+		fmt.Println("The paper " + repo.CUSIP + " has matured")
+		return nil, newError(codeInvalidStatus, entityCP, repo.CUSIP, "matured", "The paper "+repo.CUSIP+" has matured and can no longer be pledged")
+	}
+
+	// The paper is only pledged once the repo is funded, but the borrower
+	// has to hold it now
+	available := 0
+	for _, owner := range cp.Owners {
+		if owner.Company == repo.Borrower {
+			available = owner.available()
+		}
+	}
+	if available < repo.Quantity {
+		fmt.Println("The company " + repo.Borrower + " doesn't own enough of this paper")
+		return nil, insufficientPaper(repo.CUSIP, "The company "+repo.Borrower+" doesn't own enough unencumbered "+repo.CUSIP)
+	}
+
+	// The lender has to have an account to fund from
+	_, err = GetCompany(repo.Lender, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityRepo, "")
+	}
+
+	// The collateral has to still be outstanding when the repo is due
+	deadline, err := msToTime(repo.RepurchaseBy)
+	if err != nil {
+		fmt.Println("Invalid repurchase deadline " + repo.RepurchaseBy)
+		return nil, invalidField(entityRepo, "", "repurchaseBy", "Invalid repurchase deadline "+repo.RepurchaseBy)
+	}
+	maturity, err := maturityDate(cp)
+	if err != nil {
+		fmt.Println("Error reading the issue date of " + repo.CUSIP)
+		return nil, invalidField(entityCP, repo.CUSIP, "issueDate", "Error reading the issue date of "+repo.CUSIP)
+	}
+	if !deadline.After(now) || !deadline.Before(maturity) {
+		fmt.Println("Invalid repurchase deadline " + repo.RepurchaseBy)
+		return nil, invalidField(entityRepo, "", "repurchaseBy", "The repurchase deadline must be after "+timeToMs(now)+" and before the paper matures on "+timeToMs(maturity))
+	}
+
+	repo.Collateral, err = paperPrice(cp, repo.Quantity, cp.Discount, now)
+	if err != nil {
+		fmt.Println("Error pricing the paper " + repo.CUSIP)
+		return nil, newError(codeInvalidRecord, entityCP, repo.CUSIP, "", "Error pricing the paper "+repo.CUSIP)
+	}
+	repo.Cash, err = MoneyFromRat(new(big.Rat).Mul(repo.Collateral.Rat(), new(big.Rat).Sub(big.NewRat(1, 1), repo.Haircut.Fraction())), RoundDown)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.ID = recordID(stub)
+	err = requireNew(stub, entityRepo, repoPrefix+repo.ID)
+	if err != nil {
+		return nil, err
+	}
+	repo.Status = repoStatuses.initial
+	repo.ProposedOn = timeToMs(now)
+	repo.ModifiedOn = repo.ProposedOn
+	repo.OpenedOn = ""
+	repo.Repurchase = 0
+
+	err = PutRepo(repo, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityRepo, actionProposed, repoPrefix+repo.ID, "", repo.Status)
+	fmt.Println("Proposed repo " + repo.ID)
+	return json.Marshal(&repo)
+}
+
+// loadRepo loads the repo a step is taken on and checks the caller acts for
+// one of the companies allowed to take it
+func loadRepo(stub shim.ChaincodeStubInterface, function string, args []string, companies func(repo Repo) []string) (Repo, time.Time, error) {
+	var now time.Time
+	if len(args) != 1 {
+		return Repo{}, now, badArguments(function, "repo ID")
+	}
+
+	repo, err := GetRepo(args[0], stub)
+	if err != nil {
+		return repo, now, err
+	}
+
+	err = requireCompany(stub, function, companies(repo)...)
+	if err != nil {
+		fmt.Println(err.Error())
+		return repo, now, err
+	}
+
+	now, err = txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return repo, now, timestampError(entityRepo, repo.ID)
+	}
+
+	return repo, now, nil
+}
+
+// requireRepoStatus rejects a step on a repo that isn't in status
+func requireRepoStatus(repo Repo, status string, step string) error {
+	if repo.Status != status {
+		fmt.Println("Repo " + repo.ID + " is " + repo.Status)
+		return invalidStatus(entityRepo, repo.ID, "Repo "+repo.ID+" is "+repo.Status+" and cannot be "+step)
+	}
+	return nil
+}
+
+func (t *SimpleChaincode) fundRepo(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		repo ID
+	*/
+	repo, now, err := loadRepo(stub, "fundRepo", args, func(repo Repo) []string {
+		return []string{repo.Lender}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = requireRepoStatus(repo, repoProposed, "funded")
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, err := msToTime(repo.RepurchaseBy)
+	if err != nil {
+		return nil, storageError(entityRepo, repo.ID, "reading the deadline of")
+	}
+	if !now.Before(deadline) {
+		fmt.Println("Repo " + repo.ID + " is past its deadline")
+		return nil, invalidStatus(entityRepo, repo.ID, "Repo "+repo.ID+" was due on "+repo.RepurchaseBy+" and can no longer be funded")
+	}
+
+	lender, err := GetCompany(repo.Lender, stub)
+	if err != nil {
+		return nil, err
+	}
+	borrower, err := GetCompany(repo.Borrower, stub)
+	if err != nil {
+		return nil, err
+	}
+	if lender.availableCash() < repo.Cash {
+		fmt.Println("The company " + repo.Lender + " doesn't have enough cash")
+		return nil, insufficientFunds(repo.Lender, "The company "+repo.Lender+" doesn't have "+repo.Cash.String()+" of unreserved cash")
+	}
+
+	// The borrower may have sold the paper since proposing the repo
+	err = pledgePaper(stub, repo.CUSIP, repo.Borrower, repo.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveCash(stub, &lender, &borrower, repo.Cash, "repo "+repo.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = PutCompany(lender, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = PutCompany(borrower, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.OpenedOn = timeToMs(now)
+	repo.Repurchase, err = repurchaseAmount(repo, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveRepo(stub, &repo, repoOpen, actionFunded, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Funded repo " + repo.ID)
+	return json.Marshal(&repo)
+}
+
+func (t *SimpleChaincode) closeRepo(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		repo ID
+	*/
+	// The borrower may repurchase until the lender defaults the repo
+	repo, now, err := loadRepo(stub, "closeRepo", args, func(repo Repo) []string {
+		return []string{repo.Borrower}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = requireRepoStatus(repo, repoOpen, "closed")
+	if err != nil {
+		return nil, err
+	}
+
+	borrower, err := GetCompany(repo.Borrower, stub)
+	if err != nil {
+		return nil, err
+	}
+	lender, err := GetCompany(repo.Lender, stub)
+	if err != nil {
+		return nil, err
+	}
+	if borrower.availableCash() < repo.Repurchase {
+		fmt.Println("The company " + repo.Borrower + " doesn't have enough cash")
+		return nil, insufficientFunds(repo.Borrower, "The company "+repo.Borrower+" doesn't have "+repo.Repurchase.String()+" of unreserved cash")
+	}
+
+	err = moveCash(stub, &borrower, &lender, repo.Repurchase, "repurchase of repo "+repo.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = PutCompany(borrower, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = PutCompany(lender, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pledgePaper(stub, repo.CUSIP, repo.Borrower, -repo.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveRepo(stub, &repo, repoClosed, actionClosed, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Closed repo " + repo.ID)
+	return json.Marshal(&repo)
+}
+
+func (t *SimpleChaincode) defaultRepo(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		repo ID
+	*/
+	repo, now, err := loadRepo(stub, "defaultRepo", args, func(repo Repo) []string {
+		return []string{repo.Lender}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = requireRepoStatus(repo, repoOpen, "defaulted")
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, err := msToTime(repo.RepurchaseBy)
+	if err != nil {
+		return nil, storageError(entityRepo, repo.ID, "reading the deadline of")
+	}
+	if !now.After(deadline) {
+		fmt.Println("Repo " + repo.ID + " is not past its deadline")
+		return nil, invalidStatus(entityRepo, repo.ID, "Repo "+repo.ID+" is not due until "+repo.RepurchaseBy)
+	}
+
+	// The lender takes title to the collateral in place of the repurchase
+	err = pledgePaper(stub, repo.CUSIP, repo.Borrower, -repo.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := GetCP(cpPrefix+repo.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = settleTransfer(stub, &cp, repo.Borrower, repo.Lender, repo.Quantity, 0)
+	if err != nil {
+		return nil, err
+	}
+	recordEvent(stub, entityCP, actionTransferred, cpPrefix+cp.CUSIP, paperStatus(cp), paperStatus(cp))
+
+	// What the lender paid for the collateral is the cash it lent
+	lender, err := GetCompany(repo.Lender, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = adjustHolding(stub, &lender, repo.CUSIP, 0, repo.Cash)
+	if err != nil {
+		return nil, err
+	}
+	err = PutCompany(lender, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveRepo(stub, &repo, repoDefaulted, actionDefaulted, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Defaulted repo " + repo.ID)
+	return json.Marshal(&repo)
+}
+
+func (t *SimpleChaincode) cancelRepo(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		repo ID
+	*/
+	repo, now, err := loadRepo(stub, "cancelRepo", args, func(repo Repo) []string {
+		return []string{repo.Borrower, repo.Lender}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = requireRepoStatus(repo, repoProposed, "cancelled")
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveRepo(stub, &repo, repoCancelled, actionCancelled, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Cancelled repo " + repo.ID)
+	return json.Marshal(&repo)
+}
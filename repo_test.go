@@ -0,0 +1,132 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// openRepo has company1 propose borrowing against quantity of its paper
+// from company2, repurchasing in ten days, and returns the repo ID
+func openRepo(s *testStub, cusip string, quantity int) string {
+	s.t.Helper()
+	s.as(roleIssuer, "company1")
+	repurchaseBy := timeToMs(s.now.Add(10 * 24 * time.Hour))
+	var repo Repo
+	result := s.mustInvoke("openRepo", `{"cusip":"`+cusip+`","borrower":"company1","lender":"company2","quantity":`+strconv.Itoa(quantity)+`,"haircut":2,"rate":5,"repurchaseBy":"`+repurchaseBy+`"}`)
+	if err := json.Unmarshal(result, &repo); err != nil {
+		s.t.Fatal(err)
+	}
+	return repo.ID
+}
+
+func TestRepoPledgesOnlyOnceFunded(t *testing.T) {
+	s, cusip := newMarket(t)
+	repoID := openRepo(s, cusip, 5)
+	if got := owner(s.cp(cusip), "company1").Pledged; got != 0 {
+		t.Fatalf("a proposed repo pledged %d, want 0", got)
+	}
+
+	s.as(roleInvestor, "company2")
+	s.mustInvoke("fundRepo", repoID)
+	if got := owner(s.cp(cusip), "company1").Pledged; got != 5 {
+		t.Fatalf("a funded repo pledged %d, want 5", got)
+	}
+
+	var repo Repo
+	s.mustQuery(&repo, "GetRepo", repoID)
+	if got := s.company("company1").CashBalance; got != initialCashBalance+repo.Cash {
+		t.Fatalf("company1 has %s after borrowing %s", got, repo.Cash)
+	}
+
+	s.as(roleIssuer, "company1")
+	s.mustInvoke("closeRepo", repoID)
+	if got := owner(s.cp(cusip), "company1").Pledged; got != 0 {
+		t.Fatalf("a closed repo still pledges %d", got)
+	}
+}
+
+func TestUnfundedRepoLeavesPaperFree(t *testing.T) {
+	s, cusip := newMarket(t)
+	repoID := openRepo(s, cusip, 5)
+
+	s.mustInvoke("transferPaper", `{"CUSIP":"`+cusip+`","fromCompany":"company1","toCompany":"company3","quantity":8}`)
+	s.as(roleInvestor, "company2")
+	s.mustFail(codeInsufficientPaper, "fundRepo", repoID)
+
+	s.mustInvoke("cancelRepo", repoID)
+	var repo Repo
+	s.mustQuery(&repo, "GetRepo", repoID)
+	if repo.Status != repoCancelled {
+		t.Fatalf("repo is %s, want %s", repo.Status, repoCancelled)
+	}
+}
+
+func TestDefaultedRepoGivesLenderTheCollateral(t *testing.T) {
+	s, cusip := newMarket(t)
+	repoID := openRepo(s, cusip, 5)
+	s.as(roleInvestor, "company2")
+	s.mustInvoke("fundRepo", repoID)
+
+	s.mustFail(codeInvalidStatus, "defaultRepo", repoID)
+	s.now = s.now.Add(11 * 24 * time.Hour)
+	s.mustInvoke("defaultRepo", repoID)
+
+	cp := s.cp(cusip)
+	if got := owner(cp, "company2").Quantity; got != 5 {
+		t.Fatalf("company2 holds %d, want 5", got)
+	}
+	if got := owner(cp, "company1"); got.Quantity != 5 || got.Pledged != 0 {
+		t.Fatalf("company1 position is %+v, want 5 unpledged", got)
+	}
+}
+
+func TestRepoFailuresCarryTheirCodes(t *testing.T) {
+	s, cusip := newMarket(t)
+	s.as(roleIssuer, "company1")
+	repurchaseBy := timeToMs(s.now.Add(10 * 24 * time.Hour))
+	s.mustFail(codeInvalidField, "openRepo", `{"cusip":"`+cusip+`","borrower":"company1","lender":"company1","quantity":5,"repurchaseBy":"`+repurchaseBy+`"}`)
+	s.mustFail(codeInsufficientPaper, "openRepo", `{"cusip":"`+cusip+`","borrower":"company1","lender":"company2","quantity":11,"repurchaseBy":"`+repurchaseBy+`"}`)
+
+	repoID := openRepo(s, cusip, 5)
+	s.as(roleAdmin, "admin")
+	s.mustInvoke("withdrawCash", "company2", initialCashBalance.String(), "ref")
+	s.as(roleInvestor, "company2")
+	s.mustFail(codeInsufficientFunds, "fundRepo", repoID)
+}
+
+func TestRepoArgumentsAndStepsCarryTheirCodes(t *testing.T) {
+	s, cusip := newMarket(t)
+	repurchaseBy := timeToMs(s.now.Add(10 * 24 * time.Hour))
+	repo := func(fields string) string {
+		return `{"cusip":"` + cusip + `","borrower":"company1","lender":"company2",` + fields + `}`
+	}
+	s.mustFail(codeBadArguments, "openRepo")
+	s.mustFail(codeInvalidRecord, "openRepo", `{"quantity":"x"}`)
+	s.mustFail(codeInvalidField, "openRepo", repo(`"quantity":0,"repurchaseBy":"`+repurchaseBy+`"`))
+	s.mustFail(codeInvalidField, "openRepo", repo(`"quantity":1,"haircut":100,"repurchaseBy":"`+repurchaseBy+`"`))
+	s.mustFail(codeInvalidField, "openRepo", repo(`"quantity":1,"rate":-1,"repurchaseBy":"`+repurchaseBy+`"`))
+	s.mustFail(codeInvalidField, "openRepo", repo(`"quantity":1,"repurchaseBy":"soon"`))
+
+	repoID := openRepo(s, cusip, 5)
+	s.mustFail(codeInvalidStatus, "closeRepo", repoID)
+}
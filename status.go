@@ -0,0 +1,124 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"fmt"
+)
+
+// statusMachine declares the statuses a document can be in and the
+// statuses each one may move to. Statuses with no transitions are final.
+type statusMachine struct {
+	entity      string
+	document    string
+	initial     string
+	transitions map[string][]string
+}
+
+// Letters of credit are drafted by the applicant's bank, issued, then paid
+// or rejected once the shipping documents are presented
+var lcStatuses = statusMachine{
+	entity:   entityLetterCredit,
+	document: "letter of credit",
+	initial:  "draft",
+	transitions: map[string][]string{
+		"draft":     {"issued", "cancelled"},
+		"issued":    {"amended", "presented", "cancelled"},
+		"amended":   {"presented", "cancelled"},
+		"presented": {"paid", "rejected"},
+		"rejected":  {"presented", "cancelled"},
+		"paid":      {},
+		"cancelled": {},
+	},
+}
+
+// Purchase orders can be cancelled until the goods have shipped
+var poStatuses = statusMachine{
+	entity:   entityPurchaseOrder,
+	document: "purchase order",
+	initial:  "draft",
+	transitions: map[string][]string{
+		"draft":        {"issued", "cancelled"},
+		"issued":       {"acknowledged", "cancelled"},
+		"acknowledged": {"shipped", "cancelled"},
+		"shipped":      {"closed"},
+		"closed":       {},
+		"cancelled":    {},
+	},
+}
+
+// Bills of lading follow the goods from the carrier to the consignee
+var blStatuses = statusMachine{
+	entity:   entityBillLading,
+	document: "bill of lading",
+	initial:  "issued",
+	transitions: map[string][]string{
+		"issued":      {"in-transit", "cancelled"},
+		"in-transit":  {"delivered"},
+		"delivered":   {"surrendered"},
+		"surrendered": {},
+		"cancelled":   {},
+	},
+}
+
+// valid reports whether status is one of the machine's statuses
+func (m statusMachine) valid(status string) bool {
+	_, ok := m.transitions[status]
+	return ok
+}
+
+// start returns the status a new document is created with, which is
+// always the initial status
+func (m statusMachine) start(status string) (string, error) {
+	if status != "" && status != m.initial {
+		fmt.Println("A new " + m.document + " cannot start as " + status)
+		return "", newError(codeInvalidStatus, m.entity, "", "status", "A new "+m.document+" must be created in status "+m.initial+", not "+status)
+	}
+	return m.initial, nil
+}
+
+// current is the status a stored document is in. Documents written before
+// their statuses were declared are taken to be in the initial status.
+func (m statusMachine) current(status string) string {
+	if !m.valid(status) {
+		return m.initial
+	}
+	return status
+}
+
+// move checks a document may go from one status to another. Keeping the
+// same status is always allowed.
+func (m statusMachine) move(from string, to string) error {
+	from = m.current(from)
+	if !m.valid(to) {
+		fmt.Println("Unknown " + m.document + " status " + to)
+		return newError(codeInvalidStatus, m.entity, "", "status", "Unknown "+m.document+" status "+to)
+	}
+	if from == to {
+		return nil
+	}
+	for _, next := range m.transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+
+	fmt.Println("Cannot move " + m.document + " from " + from + " to " + to)
+	return newError(codeInvalidStatus, m.entity, "", "status", "Cannot move "+m.document+" from status "+from+" to "+to)
+}
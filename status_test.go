@@ -0,0 +1,82 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import "testing"
+
+func TestStatusMachines(t *testing.T) {
+	for _, test := range []struct {
+		machine statusMachine
+		from    string
+		to      string
+		ok      bool
+	}{
+		{lcStatuses, "draft", "issued", true},
+		{lcStatuses, "issued", "presented", true},
+		{lcStatuses, "presented", "rejected", true},
+		{lcStatuses, "rejected", "presented", true},
+		{lcStatuses, "presented", "paid", true},
+		{lcStatuses, "draft", "paid", false},
+		{lcStatuses, "issued", "draft", false},
+		{lcStatuses, "paid", "cancelled", false},
+		{lcStatuses, "draft", "settled", false},
+		{poStatuses, "draft", "issued", true},
+		{poStatuses, "issued", "acknowledged", true},
+		{poStatuses, "acknowledged", "shipped", true},
+		{poStatuses, "shipped", "closed", true},
+		{poStatuses, "shipped", "cancelled", false},
+		{poStatuses, "draft", "closed", false},
+		{poStatuses, "closed", "issued", false},
+		{blStatuses, "issued", "in-transit", true},
+		{blStatuses, "in-transit", "delivered", true},
+		{blStatuses, "delivered", "surrendered", true},
+		{blStatuses, "issued", "surrendered", false},
+		{blStatuses, "in-transit", "cancelled", false},
+		{blStatuses, "surrendered", "issued", false},
+		{blStatuses, "delivered", "delivered", true},
+		// Legacy statuses are taken to be the initial one
+		{lcStatuses, "Approved", "issued", true},
+		{lcStatuses, "Approved", "paid", false},
+		{poStatuses, "pending", "closed", false},
+		{blStatuses, "loaded", "in-transit", true},
+		{blStatuses, "loaded", "surrendered", false},
+	} {
+		err := test.machine.move(test.from, test.to)
+		if (err == nil) != test.ok {
+			t.Errorf("moving a %s from %s to %s gave %v", test.machine.document, test.from, test.to, err)
+		}
+	}
+}
+
+func TestDocumentsStartInTheInitialStatus(t *testing.T) {
+	for _, machine := range []statusMachine{lcStatuses, poStatuses, blStatuses} {
+		for status, ok := range map[string]bool{"": true, machine.initial: true, "cancelled": false, "closed": false, "bogus": false} {
+			got, err := machine.start(status)
+			if (err == nil) != ok || (ok && got != machine.initial) {
+				t.Errorf("starting a %s as %q gave %q, %v", machine.document, status, got, err)
+			}
+		}
+	}
+
+	s := newTestStub(t)
+	s.mustFail(codeInvalidStatus, "issueLetter_Credit", `{"lcNo":"LC1","status":"paid"}`)
+	s.mustInvoke("issueLetter_Credit", `{"lcNo":"LC1"}`)
+	s.mustFail(codeInvalidStatus, "ChangeStatusLC", "LC1", "paid")
+	s.mustInvoke("ChangeStatusLC", "LC1", "issued")
+}
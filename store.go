@@ -0,0 +1,230 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Largest page GetPage will return in one call
+const maxPageSize = 500
+
+// collection describes one kind of record stored under a key prefix
+type collection struct {
+	prefix string
+}
+
+// collections maps the names used by GetPage to where the records live
+var collections = map[string]collection{
+	"cp":           {cpPrefix},
+	"quote":        {quotePrefix},
+	"lc":           {letter_creditPrefix},
+	"po":           {purchase_orderPrefix},
+	"bl":           {bill_ladingPrefix},
+	"property":     {propertyPrefix},
+	"proposal":     {proposalPrefix},
+	"agreement":    {agreementPrefix},
+	"deed":         {deedPrefix},
+	"notification": {notificationPrefix},
+	"trade":        {tradePrefix},
+	"order":        {orderPrefix},
+	"auction":      {auctionPrefix},
+	"repo":         {repoPrefix},
+}
+
+// legacyKeyCollections are the JSON key arrays that used to index each
+// collection before lookups moved to range scans. Accounts were listed
+// under "accounts".
+var legacyKeyCollections = []string{
+	"PaperKeys",
+	"PropertyKeys",
+	"ProposalKeys",
+	"AgreementKeys",
+	"DeedKeys",
+	"NotificationKeys",
+	"QuoteKeys",
+	"letter_creditKeys",
+	"PurchaseOrderKeys",
+	"Bill_LadingKeys",
+	"accounts",
+}
+
+// requireNew refuses to create a record over one that already exists.
+// Puts overwrite, so every handler that creates a record checks first.
+func requireNew(stub shim.ChaincodeStubInterface, entity string, key string) error {
+	existing, err := stub.GetState(key)
+	if err != nil {
+		return storageError(entity, key, "reading")
+	}
+	if existing != nil {
+		return alreadyExists(entity, key)
+	}
+	return nil
+}
+
+// prefixRangeEnd is an end key that sorts after every key starting with prefix
+func prefixRangeEnd(prefix string) string {
+	return prefix + string(utf8.MaxRune)
+}
+
+// hasField reports whether a JSON object has a non-empty value for field
+func hasField(value []byte, field string) bool {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(value, &fields)
+	if err != nil {
+		return false
+	}
+
+	raw, ok := fields[field]
+	return ok && string(raw) != `""` && string(raw) != "null"
+}
+
+// scanRange calls visit for each key and value from startKey up to the end
+// of prefix, stopping early when visit returns false
+func scanRange(stub shim.ChaincodeStubInterface, prefix string, startKey string, visit func(key string, value []byte) (bool, error)) error {
+	iter, err := stub.RangeQueryState(startKey, prefixRangeEnd(prefix))
+	if err != nil {
+		fmt.Println("Error scanning keys with prefix " + prefix)
+		return storageError(entityCollection, prefix, "scanning")
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			fmt.Println("Error scanning keys with prefix " + prefix)
+			return storageError(entityCollection, prefix, "scanning")
+		}
+
+		more, err := visit(key, value)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+
+	return nil
+}
+
+// scanPrefix calls visit for every key and value starting with prefix
+func scanPrefix(stub shim.ChaincodeStubInterface, prefix string, visit func(key string, value []byte) error) error {
+	return scanRange(stub, prefix, prefix, func(key string, value []byte) (bool, error) {
+		return true, visit(key, value)
+	})
+}
+
+// scanCollection calls visit for every record in c
+func scanCollection(stub shim.ChaincodeStubInterface, c collection, visit func(key string, value []byte) error) error {
+	return scanPrefix(stub, c.prefix, visit)
+}
+
+// collectionKeys lists the key of every record in c
+func collectionKeys(stub shim.ChaincodeStubInterface, c collection) ([]string, error) {
+	var keys []string
+	err := scanCollection(stub, c, func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// rangeKeys lists every key in the state that starts with prefix
+func rangeKeys(stub shim.ChaincodeStubInterface, prefix string) ([]string, error) {
+	var keys []string
+	err := scanPrefix(stub, prefix, func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Page is one page of records from GetPage. NextKey is passed back to get
+// the following page and is empty on the last one.
+type Page struct {
+	Records []json.RawMessage `json:"records"`
+	NextKey string            `json:"nextKey"`
+}
+
+// GetPage returns up to pageSize records of a collection, starting from
+// startKey or from the beginning of the collection when it is empty
+func GetPage(name string, pageSize int, startKey string, stub shim.ChaincodeStubInterface) (Page, error) {
+	var page Page
+
+	c, ok := collections[name]
+	if !ok {
+		fmt.Println("Unknown collection " + name)
+		return page, notFound(entityCollection, name)
+	}
+	if pageSize < 1 || pageSize > maxPageSize {
+		fmt.Println("Invalid page size")
+		return page, invalidField(entityCollection, name, "pageSize", fmt.Sprintf("Page size must be between 1 and %d", maxPageSize))
+	}
+	if startKey == "" {
+		startKey = c.prefix
+	} else if len(startKey) < len(c.prefix) || startKey[:len(c.prefix)] != c.prefix {
+		fmt.Println("Start key " + startKey + " is not in collection " + name)
+		return page, invalidField(entityCollection, name, "startKey", "Start key "+startKey+" is not in collection "+name)
+	}
+
+	err := scanRange(stub, c.prefix, startKey, func(key string, value []byte) (bool, error) {
+		if len(page.Records) == pageSize {
+			page.NextKey = key
+			return false, nil
+		}
+
+		page.Records = append(page.Records, json.RawMessage(value))
+		return true, nil
+	})
+	if err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+func queryPage(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0            1          2
+			"collection" "pageSize" "startKey" (optional, the nextKey of the previous page)
+	*/
+	pageSize, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, invalidField(entityCollection, args[0], "pageSize", "Page size must be an integer")
+	}
+	startKey := ""
+	if len(args) > 2 {
+		startKey = args[2]
+	}
+	page, err := GetPage(args[0], pageSize, startKey, stub)
+	return queryResult("page", &page, err)
+}
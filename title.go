@@ -0,0 +1,175 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A sale agreement is pending until a deed registered against it
+// transfers the property
+const (
+	agreementPending  = "pending"
+	agreementExecuted = "executed"
+)
+
+// Party types on a sale agreement
+const (
+	partySeller = "seller"
+	partyBuyer  = "buyer"
+)
+
+func GetSaleAgreement(agreementNo string, stub shim.ChaincodeStubInterface) (SaleAgreement, error) {
+	var agreement SaleAgreement
+
+	agreementBytes, err := stub.GetState(agreementPrefix + agreementNo)
+	if err != nil {
+		fmt.Println("Error retrieving sale agreement " + agreementNo)
+		return agreement, storageError(entityAgreement, agreementNo, "retrieving")
+	}
+	if agreementBytes == nil {
+		fmt.Println("Sale agreement " + agreementNo + " does not exist")
+		return agreement, notFound(entityAgreement, agreementNo)
+	}
+
+	err = json.Unmarshal(agreementBytes, &agreement)
+	if err != nil {
+		fmt.Println("Error unmarshalling sale agreement " + agreementNo)
+		return agreement, storageError(entityAgreement, agreementNo, "unmarshalling")
+	}
+
+	return agreement, nil
+}
+
+func GetProperty(propId string, stub shim.ChaincodeStubInterface) (Property, error) {
+	var property Property
+
+	propertyBytes, err := stub.GetState(propertyPrefix + propId)
+	if err != nil {
+		fmt.Println("Error retrieving property " + propId)
+		return property, storageError(entityProperty, propId, "retrieving")
+	}
+	if propertyBytes == nil {
+		fmt.Println("Property " + propId + " does not exist")
+		return property, notFound(entityProperty, propId)
+	}
+
+	err = json.Unmarshal(propertyBytes, &property)
+	if err != nil {
+		fmt.Println("Error unmarshalling property " + propId)
+		return property, storageError(entityProperty, propId, "unmarshalling")
+	}
+
+	return property, nil
+}
+
+// partyNames joins the names of the parties of one type, the way joint
+// owners are written in PropOwner
+func partyNames(parties []Party, partyType string) string {
+	var names []string
+	for _, party := range parties {
+		if strings.EqualFold(party.PartyType, partyType) {
+			names = append(names, party.PartyName)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// registerDeed transfers the property sold under the deed's agreement from
+// the sellers to the buyers, closing the sellers' entry in the property
+// history, and marks the agreement executed
+func registerDeed(deed SaleDeed, stub shim.ChaincodeStubInterface) error {
+	if deed.AgreementNo == "" {
+		fmt.Println("Deed " + deed.DeedNo + " has no agreement")
+		return invalidField(entityDeed, deed.DeedNo, "agreementNo", "Sale deed "+deed.DeedNo+" must name the sale agreement it registers")
+	}
+
+	agreement, err := GetSaleAgreement(deed.AgreementNo, stub)
+	if err != nil {
+		return err
+	}
+	if agreement.Status == agreementExecuted {
+		fmt.Println("Agreement " + agreement.AgreementNo + " is already executed")
+		return invalidStatus(entityAgreement, agreement.AgreementNo, "Sale agreement "+agreement.AgreementNo+" has already been executed")
+	}
+
+	seller := partyNames(agreement.Parties, partySeller)
+	buyer := partyNames(agreement.Parties, partyBuyer)
+	if seller == "" || buyer == "" {
+		fmt.Println("Agreement " + agreement.AgreementNo + " needs a seller and a buyer")
+		return invalidField(entityAgreement, agreement.AgreementNo, "parties", "Sale agreement "+agreement.AgreementNo+" must have a seller and a buyer")
+	}
+
+	property, err := GetProperty(agreement.PropId, stub)
+	if err != nil {
+		return err
+	}
+	if property.PropOwner != seller {
+		fmt.Println("Seller " + seller + " does not own property " + property.PropId)
+		return newError(codeConflict, entityProperty, property.PropId, "propOwner", "Seller "+seller+" is not the owner of property "+property.PropId)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting transaction time")
+		return timestampError(entityDeed, deed.DeedNo)
+	}
+	transferDate := timeToMs(now)
+
+	for i := range property.Histories {
+		if property.Histories[i].To == "" {
+			property.Histories[i].To = transferDate
+		}
+	}
+	property.Histories = append(property.Histories, History{HistoryOwner: buyer, Location: property.Location, From: transferDate})
+	property.PropOwner = buyer
+
+	propertyBytes, err := json.Marshal(&property)
+	if err != nil {
+		fmt.Println("Error marshalling property " + property.PropId)
+		return storageError(entityProperty, property.PropId, "marshalling")
+	}
+	err = putState(stub, propertyPrefix+property.PropId, propertyBytes)
+	if err != nil {
+		fmt.Println("Error writing property " + property.PropId)
+		return storageError(entityProperty, property.PropId, "writing")
+	}
+	recordEvent(stub, entityProperty, actionTransferred, propertyPrefix+property.PropId, "", "")
+
+	oldStatus := agreement.Status
+	agreement.Status = agreementExecuted
+	agreementBytes, err := json.Marshal(&agreement)
+	if err != nil {
+		fmt.Println("Error marshalling sale agreement " + agreement.AgreementNo)
+		return storageError(entityAgreement, agreement.AgreementNo, "marshalling")
+	}
+	err = putState(stub, agreementPrefix+agreement.AgreementNo, agreementBytes)
+	if err != nil {
+		fmt.Println("Error writing sale agreement " + agreement.AgreementNo)
+		return storageError(entityAgreement, agreement.AgreementNo, "writing")
+	}
+	recordEvent(stub, entityAgreement, actionStatusChanged, agreementPrefix+agreement.AgreementNo, oldStatus, agreement.Status)
+
+	fmt.Println("Property " + property.PropId + " transferred from " + seller + " to " + buyer)
+	return nil
+}
@@ -0,0 +1,526 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var tradePrefix = keyPrefix("trade")
+
+// How long a trade stays open when its proposal sets no expiry
+const defaultTradeLifetime = 24 * time.Hour
+
+// A trade is proposed by the seller, who reserves the paper, and accepted
+// by the buyer, who reserves the cash. Settlement then swaps the two.
+// Until it settles, either side can cancel, and once it expires anyone can
+// release the reservations.
+var tradeStatuses = statusMachine{
+	document: "trade",
+	initial:  "proposed",
+	transitions: map[string][]string{
+		"proposed":  {"accepted", "cancelled", "expired"},
+		"accepted":  {"settled", "cancelled", "expired"},
+		"settled":   {},
+		"cancelled": {},
+		"expired":   {},
+	},
+}
+
+const (
+	tradeProposed  = "proposed"
+	tradeAccepted  = "accepted"
+	tradeSettled   = "settled"
+	tradeCancelled = "cancelled"
+	tradeExpired   = "expired"
+)
+
+// Trade is a delivery-versus-payment sale of paper between two companies.
+// The price is fixed when the seller proposes the trade, so the buyer
+// agrees to it by accepting.
+type Trade struct {
+	ID         string `json:"id"`
+	CUSIP      string `json:"cusip"`
+	Seller     string `json:"seller"`
+	Buyer      string `json:"buyer"`
+	Quantity   int    `json:"quantity"`
+	Discount   Rate   `json:"discount"`
+	Price      Money  `json:"price"`
+	Status     string `json:"status"`
+	ProposedOn string `json:"proposedOn"`
+	ExpiresOn  string `json:"expiresOn"`
+	ModifiedOn string `json:"modifiedOn"`
+}
+
+func GetTrade(tradeID string, stub shim.ChaincodeStubInterface) (Trade, error) {
+	var trade Trade
+
+	tradeBytes, err := stub.GetState(tradePrefix + tradeID)
+	if err != nil {
+		fmt.Println("Error retrieving trade " + tradeID)
+		return trade, storageError(entityTrade, tradeID, "retrieving")
+	}
+	if tradeBytes == nil {
+		fmt.Println("Trade " + tradeID + " does not exist")
+		return trade, notFound(entityTrade, tradeID)
+	}
+
+	err = json.Unmarshal(tradeBytes, &trade)
+	if err != nil {
+		fmt.Println("Error unmarshalling trade " + tradeID)
+		return trade, storageError(entityTrade, tradeID, "unmarshalling")
+	}
+
+	return trade, nil
+}
+
+func PutTrade(trade Trade, stub shim.ChaincodeStubInterface) error {
+	tradeBytes, err := json.Marshal(&trade)
+	if err != nil {
+		fmt.Println("Error marshalling trade " + trade.ID)
+		return storageError(entityTrade, trade.ID, "marshalling")
+	}
+
+	err = putState(stub, tradePrefix+trade.ID, tradeBytes)
+	if err != nil {
+		fmt.Println("Error writing trade " + trade.ID)
+		return storageError(entityTrade, trade.ID, "writing")
+	}
+
+	return nil
+}
+
+// open reports whether the trade is still waiting to settle
+func (trade Trade) open() bool {
+	return trade.Status == tradeProposed || trade.Status == tradeAccepted
+}
+
+// hasExpired reports whether the trade's expiry has passed at now
+func hasExpired(trade Trade, now time.Time) (bool, error) {
+	expiry, err := msToTime(trade.ExpiresOn)
+	if err != nil {
+		fmt.Println("Error reading the expiry of trade " + trade.ID)
+		return false, invalidField(entityTrade, trade.ID, "expiresOn", "Error reading the expiry of trade "+trade.ID)
+	}
+	return !now.Before(expiry), nil
+}
+
+// moveTrade changes the status of a trade and records the event for it
+func moveTrade(stub shim.ChaincodeStubInterface, trade *Trade, status string, action string, now time.Time) error {
+	oldStatus := trade.Status
+	err := tradeStatuses.move(oldStatus, status)
+	if err != nil {
+		return err
+	}
+
+	trade.Status = status
+	trade.ModifiedOn = timeToMs(now)
+	err = PutTrade(*trade, stub)
+	if err != nil {
+		return err
+	}
+
+	recordEvent(stub, entityTrade, action, tradePrefix+trade.ID, oldStatus, trade.Status)
+	return nil
+}
+
+// reservePaper holds quantity of the seller's paper for a trade, or
+// releases it when quantity is negative
+func reservePaper(stub shim.ChaincodeStubInterface, cusip string, seller string, quantity int) error {
+	cp, err := GetCP(cpPrefix+cusip, stub)
+	if err != nil {
+		return err
+	}
+
+	for i, owner := range cp.Owners {
+		if owner.Company != seller {
+			continue
+		}
+		if owner.available() < quantity {
+			fmt.Println("The company " + seller + " doesn't own enough of this paper")
+			return insufficientPaper(cusip, "The company "+seller+" doesn't own enough unreserved "+cusip)
+		}
+		if owner.Reserved+quantity < 0 {
+			fmt.Println("The company " + seller + " has less of this paper reserved")
+			return insufficientPaper(cusip, "The company "+seller+" has less than "+strconv.Itoa(-quantity)+" of "+cusip+" reserved")
+		}
+
+		cp.Owners[i].Reserved += quantity
+		return PutCP(cp, stub)
+	}
+
+	fmt.Println("The company " + seller + " doesn't own any of this paper")
+	return insufficientPaper(cusip, "The company "+seller+" doesn't own any of "+cusip)
+}
+
+// reserveCash holds amount of the buyer's cash for a trade, or releases it
+// when amount is negative
+func reserveCash(stub shim.ChaincodeStubInterface, buyer string, amount Money) error {
+	company, err := GetCompany(buyer, stub)
+	if err != nil {
+		return err
+	}
+
+	if company.availableCash() < amount {
+		fmt.Println("The company " + buyer + " doesn't have enough cash")
+		return insufficientFunds(buyer, "The company "+buyer+" doesn't have "+amount.String()+" of unreserved cash")
+	}
+	if company.ReservedCash+amount < 0 {
+		fmt.Println("The company " + buyer + " has less cash reserved")
+		return insufficientFunds(buyer, "The company "+buyer+" has less than "+(-amount).String()+" of cash reserved")
+	}
+
+	company.ReservedCash += amount
+	return PutCompany(company, stub)
+}
+
+// releaseTrade gives back whatever the trade has reserved
+func releaseTrade(stub shim.ChaincodeStubInterface, trade Trade) error {
+	err := reservePaper(stub, trade.CUSIP, trade.Seller, -trade.Quantity)
+	if err != nil {
+		return err
+	}
+	if trade.Status == tradeAccepted {
+		return reserveCash(stub, trade.Buyer, -trade.Price)
+	}
+	return nil
+}
+
+func (t *SimpleChaincode) proposeTrade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		json
+	  	{
+			  "cusip": "",
+			  "seller": "",
+			  "buyer": "",
+			  "quantity": 1,
+			  "discount": 7.5, // optional, the paper's discount is used when 0
+			  "expiresOn": "" // optional, in milliseconds, a day from now by default and never after maturity
+		}
+	*/
+	if len(args) != 1 {
+		return nil, badArguments("proposeTrade", "trade record")
+	}
+
+	var trade Trade
+	fmt.Println("Unmarshalling Trade")
+	err := json.Unmarshal([]byte(args[0]), &trade)
+	if err != nil {
+		fmt.Println("Error unmarshalling trade")
+		return nil, invalidRecord(entityTrade, err)
+	}
+
+	// Only the seller may offer its paper
+	err = requireCompany(stub, "proposeTrade", trade.Seller)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	if trade.Seller == trade.Buyer {
+		fmt.Println("The seller and buyer are the same company")
+		return nil, invalidField(entityTrade, "", "buyer", "The company "+trade.Seller+" cannot trade with itself")
+	}
+	if trade.Quantity <= 0 {
+		fmt.Println("Invalid quantity " + strconv.Itoa(trade.Quantity))
+		return nil, invalidField(entityTrade, "", "quantity", "Invalid quantity "+strconv.Itoa(trade.Quantity))
+	}
+	if trade.Discount < 0 {
+		fmt.Println("Invalid discount " + trade.Discount.String())
+		return nil, invalidField(entityTrade, "", "discount", "Invalid discount "+trade.Discount.String())
+	}
+
+	cp, err := GetCP(cpPrefix+trade.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Matured {
+		fmt.Println("The paper " + trade.CUSIP + " has matured")
+		return nil, newError(codeInvalidStatus, entityCP, trade.CUSIP, "matured", "The paper "+trade.CUSIP+" has matured and can no longer be traded")
+	}
+	if trade.Discount == 0 {
+		trade.Discount = cp.Discount
+	}
+
+	// The buyer has to have an account to settle against
+	_, err = GetCompany(trade.Buyer, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return nil, timestampError(entityTrade, "")
+	}
+
+	trade.ID = recordID(stub)
+	err = requireNew(stub, entityTrade, tradePrefix+trade.ID)
+	if err != nil {
+		return nil, err
+	}
+	trade.Status = tradeStatuses.initial
+	trade.ProposedOn = timeToMs(now)
+	trade.ModifiedOn = trade.ProposedOn
+
+	expiry := now.Add(defaultTradeLifetime)
+	if trade.ExpiresOn != "" {
+		expiry, err = msToTime(trade.ExpiresOn)
+		if err != nil {
+			fmt.Println("Invalid expiry " + trade.ExpiresOn)
+			return nil, invalidField(entityTrade, trade.ID, "expiresOn", "Invalid expiresOn "+trade.ExpiresOn+", expecting milliseconds")
+		}
+		if !expiry.After(now) {
+			fmt.Println("The trade expires before it is proposed")
+			return nil, invalidField(entityTrade, trade.ID, "expiresOn", "The trade must expire after "+trade.ProposedOn)
+		}
+	}
+
+	// The trade keeps the paper reserved while it is open, and reserved
+	// paper can't be redeemed, so it expires at maturity at the latest
+	maturity, err := maturityDate(cp)
+	if err != nil {
+		fmt.Println("Error reading the issue date of " + trade.CUSIP)
+		return nil, invalidField(entityCP, trade.CUSIP, "issueDate", "Error reading the issue date of "+trade.CUSIP)
+	}
+	if expiry.After(maturity) {
+		expiry = maturity
+	}
+	if !expiry.After(now) {
+		fmt.Println("The paper " + trade.CUSIP + " has reached maturity")
+		return nil, newError(codeInvalidStatus, entityCP, trade.CUSIP, "matured", "The paper "+trade.CUSIP+" has reached maturity and can no longer be traded")
+	}
+	trade.ExpiresOn = timeToMs(expiry)
+
+	trade.Price, err = paperPrice(cp, trade.Quantity, trade.Discount, now)
+	if err != nil {
+		fmt.Println("Error pricing the paper " + trade.CUSIP)
+		return nil, newError(codeInvalidRecord, entityCP, trade.CUSIP, "", "Error pricing the paper "+trade.CUSIP)
+	}
+
+	err = reservePaper(stub, trade.CUSIP, trade.Seller, trade.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = PutTrade(trade, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvent(stub, entityTrade, actionProposed, tradePrefix+trade.ID, "", trade.Status)
+	fmt.Println("Proposed trade " + trade.ID)
+	return json.Marshal(&trade)
+}
+
+// openTrade loads the trade a step is taken on and checks the caller acts
+// for one of the companies allowed to take it, when the step has any
+func openTrade(stub shim.ChaincodeStubInterface, function string, args []string, companies func(trade Trade) []string) (Trade, time.Time, error) {
+	var now time.Time
+	if len(args) != 1 {
+		return Trade{}, now, badArguments(function, "trade ID")
+	}
+
+	trade, err := GetTrade(args[0], stub)
+	if err != nil {
+		return trade, now, err
+	}
+
+	if companies != nil {
+		err = requireCompany(stub, function, companies(trade)...)
+		if err != nil {
+			fmt.Println(err.Error())
+			return trade, now, err
+		}
+	}
+
+	now, err = txTime(stub)
+	if err != nil {
+		fmt.Println("Error getting the transaction timestamp")
+		return trade, now, timestampError(entityTrade, trade.ID)
+	}
+
+	return trade, now, nil
+}
+
+// requireUnexpired rejects a step on a trade whose expiry has passed
+func requireUnexpired(trade Trade, now time.Time) error {
+	expired, err := hasExpired(trade, now)
+	if err != nil {
+		return err
+	}
+	if expired {
+		fmt.Println("Trade " + trade.ID + " has expired")
+		return invalidStatus(entityTrade, trade.ID, "Trade "+trade.ID+" expired on "+trade.ExpiresOn)
+	}
+	return nil
+}
+
+func (t *SimpleChaincode) acceptTrade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		trade ID
+	*/
+	trade, now, err := openTrade(stub, "acceptTrade", args, func(trade Trade) []string {
+		return []string{trade.Buyer}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if trade.Status != tradeProposed {
+		fmt.Println("Trade " + trade.ID + " is " + trade.Status)
+		return nil, invalidStatus(entityTrade, trade.ID, "Trade "+trade.ID+" is "+trade.Status+" and cannot be accepted")
+	}
+	err = requireUnexpired(trade, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = reserveCash(stub, trade.Buyer, trade.Price)
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveTrade(stub, &trade, tradeAccepted, actionAccepted, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Accepted trade " + trade.ID)
+	return json.Marshal(&trade)
+}
+
+func (t *SimpleChaincode) settleTrade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		trade ID
+	*/
+	trade, now, err := openTrade(stub, "settleTrade", args, func(trade Trade) []string {
+		return []string{trade.Seller, trade.Buyer}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if trade.Status != tradeAccepted {
+		fmt.Println("Trade " + trade.ID + " is " + trade.Status)
+		return nil, invalidStatus(entityTrade, trade.ID, "Trade "+trade.ID+" is "+trade.Status+" and cannot be settled")
+	}
+	err = requireUnexpired(trade, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// The reserved paper and cash are exactly what changes hands
+	err = releaseTrade(stub, trade)
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := GetCP(cpPrefix+trade.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Matured {
+		fmt.Println("The paper " + trade.CUSIP + " has matured")
+		return nil, newError(codeInvalidStatus, entityCP, trade.CUSIP, "matured", "The paper "+trade.CUSIP+" has matured and can no longer be traded")
+	}
+
+	err = settleTransfer(stub, &cp, trade.Seller, trade.Buyer, trade.Quantity, trade.Price)
+	if err != nil {
+		return nil, err
+	}
+	recordEvent(stub, entityCP, actionTransferred, cpPrefix+trade.CUSIP, paperStatus(cp), paperStatus(cp))
+
+	err = moveTrade(stub, &trade, tradeSettled, actionSettled, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Settled trade " + trade.ID)
+	return json.Marshal(&trade)
+}
+
+func (t *SimpleChaincode) cancelTrade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		trade ID
+	*/
+	trade, now, err := openTrade(stub, "cancelTrade", args, func(trade Trade) []string {
+		return []string{trade.Seller, trade.Buyer}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !trade.open() {
+		fmt.Println("Trade " + trade.ID + " is " + trade.Status)
+		return nil, invalidStatus(entityTrade, trade.ID, "Trade "+trade.ID+" is already "+trade.Status)
+	}
+	err = releaseTrade(stub, trade)
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveTrade(stub, &trade, tradeCancelled, actionCancelled, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Cancelled trade " + trade.ID)
+	return json.Marshal(&trade)
+}
+
+func (t *SimpleChaincode) expireTrade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0
+		trade ID
+	*/
+	// Anyone may clear out an expired trade
+	trade, now, err := openTrade(stub, "expireTrade", args, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !trade.open() {
+		fmt.Println("Trade " + trade.ID + " is " + trade.Status)
+		return nil, invalidStatus(entityTrade, trade.ID, "Trade "+trade.ID+" is already "+trade.Status)
+	}
+	expired, err := hasExpired(trade, now)
+	if err != nil {
+		return nil, err
+	}
+	if !expired {
+		fmt.Println("Trade " + trade.ID + " has not expired")
+		return nil, invalidStatus(entityTrade, trade.ID, "Trade "+trade.ID+" does not expire until "+trade.ExpiresOn)
+	}
+
+	err = releaseTrade(stub, trade)
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveTrade(stub, &trade, tradeExpired, actionExpired, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Expired trade " + trade.ID)
+	return json.Marshal(&trade)
+}
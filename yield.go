@@ -0,0 +1,200 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Money-market yields are quoted on a 360 day year and bond-equivalent
+// yields on a 365 day year, whatever convention the paper is priced with
+const (
+	moneyMarketBasis    = 360
+	bondEquivalentBasis = 365
+)
+
+// Paper with longer to run than this is compared with a coupon bond paying
+// semi-annually, so its bond-equivalent yield compounds once
+const bondEquivalentHalfYear = 182
+
+// YieldAnalytics describes what a paper is worth and yields when settled on
+// a day at a discount
+type YieldAnalytics struct {
+	CUSIP           string `json:"cusip"`
+	InstrumentType  string `json:"instrumentType"`
+	Coupon          Rate   `json:"coupon,omitempty"`
+	Settlement      string `json:"settlement"`
+	Maturity        string `json:"maturity"`
+	DayCount        string `json:"dayCount"`
+	Days            int    `json:"days"`
+	ActualDays      int    `json:"actualDays"`
+	Discount        Rate   `json:"discount"`
+	Price           Money  `json:"price"`
+	PricePer100     Rate   `json:"pricePer100"` // percent of par
+	AccruedInterest Money  `json:"accruedInterest,omitempty"`
+	Redemption      Money  `json:"redemption"`
+	MoneyMarket     Rate   `json:"moneyMarketYield"`
+	BondEquivalent  Rate   `json:"bondEquivalentYield"`
+}
+
+// bondEquivalentYield converts the holding period return of a paper into
+// an annual yield on a 365 day year. Paper running longer than half a year
+// is matched with a bond paying one coupon before maturity.
+func bondEquivalentYield(gain *big.Rat, actual int) (*big.Rat, error) {
+	if actual <= bondEquivalentHalfYear {
+		return new(big.Rat).Mul(gain, big.NewRat(bondEquivalentBasis, int64(actual))), nil
+	}
+
+	// Solve (t/2B - 1/4) y^2 + (t/B) y - gain = 0 for y
+	t, _ := big.NewRat(int64(actual), bondEquivalentBasis).Float64()
+	g, _ := gain.Float64()
+	a := t/2 - 0.25
+	y := (-t + math.Sqrt(t*t+4*a*g)) / (2 * a)
+
+	r := new(big.Rat)
+	if r.SetFloat64(y) == nil {
+		return nil, errors.New("Cannot compute the bond-equivalent yield")
+	}
+	return r, nil
+}
+
+// GetYield prices a paper for settlement on settle at discount and works
+// out its yields. The dollar price uses the paper's own day count, exactly
+// as transfers and trades do, so the two always agree. Interest-bearing
+// paper takes discount as its money-market yield and is priced with the
+// interest accrued to settlement.
+func GetYield(cusip string, settle time.Time, discount Rate, stub shim.ChaincodeStubInterface) (YieldAnalytics, error) {
+	analytics := YieldAnalytics{CUSIP: cusip, Settlement: timeToMs(settle), Discount: discount}
+
+	cp, err := GetCP(cpPrefix+cusip, stub)
+	if err != nil {
+		return analytics, err
+	}
+	analytics.InstrumentType = instrumentOf(cp)
+	analytics.Coupon = cp.Coupon
+	analytics.DayCount = cp.DayCount
+	if analytics.DayCount == "" {
+		analytics.DayCount = defaultDayCount
+	}
+
+	issued, err := msToTime(cp.IssueDate)
+	if err != nil {
+		fmt.Println("Error reading the issue date of " + cusip)
+		return analytics, invalidField(entityCP, cusip, "issueDate", "Error reading the issue date of "+cusip)
+	}
+	maturity, err := maturityDate(cp)
+	if err != nil {
+		fmt.Println("Error reading the issue date of " + cusip)
+		return analytics, invalidField(entityCP, cusip, "issueDate", "Error reading the issue date of "+cusip)
+	}
+	analytics.Maturity = timeToMs(maturity)
+
+	if utcDate(settle).Before(utcDate(issued)) {
+		return analytics, invalidField(entityCP, cusip, "settlement", "The paper "+cusip+" is not issued until "+issued.UTC().Format(time.RFC3339))
+	}
+	analytics.ActualDays = actualDays(settle, maturity)
+	if analytics.ActualDays <= 0 {
+		return analytics, invalidField(entityCP, cusip, "settlement", "The paper "+cusip+" matures on "+maturity.UTC().Format(time.RFC3339)+", before settlement")
+	}
+
+	analytics.Days, _, err = dayCount(cp.DayCount, settle, maturity)
+	if err != nil {
+		return analytics, invalidField(entityCP, cusip, "dayCount", err.Error())
+	}
+
+	price, err := priceFraction(cp, discount, settle)
+	if err != nil {
+		return analytics, err
+	}
+	if price.Sign() <= 0 {
+		return analytics, invalidField(entityCP, cusip, "discount", "A discount of "+discount.String()+" leaves the paper with no value")
+	}
+
+	analytics.Price, err = paperPrice(cp, 1, discount, settle)
+	if err != nil {
+		return analytics, err
+	}
+	analytics.PricePer100, err = RateFromFraction(price, RoundHalfEven)
+	if err != nil {
+		return analytics, err
+	}
+
+	analytics.AccruedInterest, err = accruedInterest(cp, 1, settle)
+	if err != nil {
+		return analytics, err
+	}
+	analytics.Redemption, err = redemptionAmount(cp, 1)
+	if err != nil {
+		return analytics, err
+	}
+
+	// (redemption/price - 1) * 360 / actual days
+	redemption, err := redemptionFraction(cp)
+	if err != nil {
+		return analytics, err
+	}
+	gain := new(big.Rat).Sub(new(big.Rat).Quo(redemption, price), big.NewRat(1, 1))
+	mmy := new(big.Rat).Mul(gain, big.NewRat(moneyMarketBasis, int64(analytics.ActualDays)))
+	analytics.MoneyMarket, err = RateFromFraction(mmy, RoundHalfEven)
+	if err != nil {
+		return analytics, err
+	}
+
+	bey, err := bondEquivalentYield(gain, analytics.ActualDays)
+	if err != nil {
+		return analytics, invalidField(entityCP, cusip, "discount", err.Error())
+	}
+	analytics.BondEquivalent, err = RateFromFraction(bey, RoundHalfEven)
+	if err != nil {
+		return analytics, err
+	}
+
+	return analytics, nil
+}
+
+func queryYield(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*		0       1            2
+			"cusip" "settlement" "discount" (optional, defaults to the discount of the paper)
+	*/
+	settle, err := msToTime(args[1])
+	if err != nil {
+		return nil, invalidField(entityCP, args[0], "settlement", "Invalid settlement time "+args[1])
+	}
+	var discount Rate
+	if len(args) > 2 {
+		discount, err = ParseRate(args[2], jsonRoundingMode)
+		if err != nil || discount < 0 {
+			return nil, invalidField(entityCP, args[0], "discount", "Invalid discount "+args[2])
+		}
+	} else {
+		cp, err := GetCP(cpPrefix+args[0], stub)
+		if err != nil {
+			return nil, err
+		}
+		discount = cp.Discount
+	}
+	analytics, err := GetYield(args[0], settle, discount, stub)
+	return queryResult("the yield", &analytics, err)
+}
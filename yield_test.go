@@ -0,0 +1,63 @@
+/*
+Copyright 2016 IBM
+
+Licensed under the Apache License, Version 2.0 (the "License")
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+Licensed Materials - Property of IBM
+© Copyright IBM Corp. 2016
+*/
+package main
+
+import "testing"
+
+func TestYieldMatchesTransferPrice(t *testing.T) {
+	for _, test := range []struct {
+		maturity string
+		days     int
+		price    Money
+		mmy      Rate
+		bey      Rate
+	}{
+		// 1000 * (1 - 5% * 90/360) = 987.50, a gain of 12.50/987.50.
+		// MMY = gain * 360/90, BEY = gain * 365/90.
+		{"90", 90, Money(98750), Rate(5063291), Rate(5133615)},
+		// 1000 * (1 - 5% * 270/360) = 962.50, a gain of 37.50/962.50.
+		// MMY = gain * 360/270; BEY solves the semi-annual bond quadratic
+		// with t = 270/365.
+		{"270", 270, Money(96250), Rate(5194805), Rate(5222756)},
+	} {
+		s := newTestStub(t)
+		s.mustInvoke("createAccounts", "2")
+		s.mustInvoke("setProgram", "company1", `{"authorized":100000}`)
+		cusip := s.issue(`{"ticker":"ABC","par":1000,"qty":10,"discount":5,"maturity":` + test.maturity + `,"issuer":"company1"}`)
+
+		var analytics YieldAnalytics
+		s.mustQuery(&analytics, "GetYield", cusip, timeToMs(s.now))
+		if analytics.ActualDays != test.days || analytics.Days != test.days {
+			t.Fatalf("%s day paper runs %d actual and %d counted days, want %d", test.maturity, analytics.ActualDays, analytics.Days, test.days)
+		}
+		if analytics.Price != test.price || analytics.Redemption != Money(100000) {
+			t.Fatalf("%s day paper is priced at %v redeeming %v, want %v redeeming 1000.00", test.maturity, analytics.Price, analytics.Redemption, test.price)
+		}
+		if analytics.MoneyMarket != test.mmy || analytics.BondEquivalent != test.bey {
+			t.Fatalf("%s day paper yields %v MMY and %v BEY, want %v and %v", test.maturity, analytics.MoneyMarket, analytics.BondEquivalent, test.mmy, test.bey)
+		}
+
+		// A transfer settled the same day charges the quoted price
+		before := s.company("company2").CashBalance
+		s.mustInvoke("transferPaper", `{"CUSIP":"`+cusip+`","fromCompany":"company1","toCompany":"company2","quantity":2}`)
+		if paid := before - s.company("company2").CashBalance; paid != analytics.Price.Times(2) {
+			t.Fatalf("company2 paid %v for 2 units of %s day paper, want %v", paid, test.maturity, analytics.Price.Times(2))
+		}
+	}
+}